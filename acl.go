@@ -0,0 +1,363 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+	"github.com/saucelabs/forwarder/ruleset"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrProxyUserDenied is returned when no ACL rule matches the authenticated user.
+var ErrProxyUserDenied = denyError{errors.New("proxying denied for user")}
+
+// ACL holds per-user access control rules.
+// Rules are evaluated in order, the first rule that matches the user or one of the user's groups applies.
+// The user's groups are the groups defined in the ACL, and the groups provided by the authentication method e.g. token claims.
+// If no rule matches, the request is denied.
+type ACL struct {
+	groups map[string][]string
+	rules  []*ACLRule
+}
+
+// ACLRule defines the egress rights of users and groups.
+type ACLRule struct {
+	Name string
+	// Users and Groups the rule applies to, "*" matches any authenticated user.
+	Users  []string
+	Groups []string
+	// AllowDomains if set, only requests to matching domains are allowed.
+	AllowDomains Matcher
+	// DenyDomains denies requests to matching domains.
+	DenyDomains Matcher
+	// ConnectPorts if set, only CONNECT requests to these ports are allowed.
+	ConnectPorts []PortRange
+	// AllowTimeFrame if set, requests are allowed only within the time frames.
+	AllowTimeFrame []ruleset.TimeFrameEntry
+	// UpstreamProxy if set, forces the upstream proxy, Direct forces direct connections.
+	UpstreamProxy *url.URL
+	Direct        bool
+}
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Start, End int
+}
+
+// ParsePortRange parses a port or a range of ports in the form <start>-<end>.
+func ParsePortRange(val string) (PortRange, error) {
+	s, e, ok := strings.Cut(val, "-")
+	if !ok {
+		e = s
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port %q", val)
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(e))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port %q", val)
+	}
+	if start < 1 || end > 65535 || start > end {
+		return PortRange{}, fmt.Errorf("invalid port range %q", val)
+	}
+	return PortRange{Start: start, End: end}, nil
+}
+
+func (r PortRange) Contains(port int) bool {
+	return port >= r.Start && port <= r.End
+}
+
+func (r PortRange) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(r.Start)
+	}
+	return strconv.Itoa(r.Start) + "-" + strconv.Itoa(r.End)
+}
+
+type aclFile struct {
+	Groups map[string][]string `yaml:"groups"`
+	Rules  []aclFileRule       `yaml:"rules"`
+}
+
+type aclFileRule struct {
+	Name           string   `yaml:"name"`
+	Users          []string `yaml:"users"`
+	Groups         []string `yaml:"groups"`
+	AllowDomains   []string `yaml:"allow_domains"`
+	DenyDomains    []string `yaml:"deny_domains"`
+	ConnectPorts   []string `yaml:"connect_ports"`
+	AllowTimeFrame []string `yaml:"allow_time_frame"`
+	TimeZone       string   `yaml:"time_zone"`
+	UpstreamProxy  string   `yaml:"upstream_proxy"`
+}
+
+// ParseACL reads ACL from YAML, the format is:
+//
+//	groups:
+//	  qa: [alice, bob]
+//	rules:
+//	  - name: qa
+//	    groups: [qa]
+//	    allow_domains: ['.*\.example\.com$']
+//	    deny_domains: ['admin\.example\.com']
+//	    connect_ports: ["443", "8000-8999"]
+//	    allow_time_frame: ["mon/9-17", "tue/08:30-17:45", "-2025-12-25"]
+//	    time_zone: Europe/Berlin
+//	    upstream_proxy: http://proxy.example.com:3128
+//	  - name: default
+//	    users: ["*"]
+//	    upstream_proxy: direct
+//
+// Domains use the same syntax as the --deny-domains flag, time frames the same syntax as the --allow-time-frame flag.
+// Time frames are evaluated in the time zone of the rule, the local time zone by default, see SetDefaultLocation.
+// Groups provided by the authentication method must be defined, they may have no members e.g. ci: [].
+func ParseACL(r io.Reader) (*ACL, error) {
+	var f aclFile
+	d := yaml.NewDecoder(r)
+	d.KnownFields(true)
+	if err := d.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	a := &ACL{
+		groups: f.Groups,
+	}
+	for i := range f.Rules {
+		rule, err := f.Rules[i].parse()
+		if err != nil {
+			name := f.Rules[i].Name
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		for _, g := range rule.Groups {
+			if _, ok := a.groups[g]; !ok {
+				return nil, fmt.Errorf("rule %s: unknown group %q", rule.Name, g)
+			}
+		}
+		a.rules = append(a.rules, rule)
+	}
+
+	return a, nil
+}
+
+// SetDefaultLocation sets the location the time frames of rules without time_zone are evaluated in.
+func (a *ACL) SetDefaultLocation(loc *time.Location) {
+	if loc == nil {
+		return
+	}
+	for _, r := range a.rules {
+		for i := range r.AllowTimeFrame {
+			if r.AllowTimeFrame[i].Location == nil {
+				r.AllowTimeFrame[i].Location = loc
+			}
+		}
+	}
+}
+
+// ReadACLFile reads ACL from a YAML file, see ParseACL.
+func ReadACLFile(path string) (*ACL, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a, err := ParseACL(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return a, nil
+}
+
+func (fr *aclFileRule) parse() (*ACLRule, error) {
+	if len(fr.Users) == 0 && len(fr.Groups) == 0 {
+		return nil, errors.New("users or groups must be set")
+	}
+
+	r := &ACLRule{
+		Name:   fr.Name,
+		Users:  fr.Users,
+		Groups: fr.Groups,
+	}
+
+	matcher := func(l []string) (Matcher, error) {
+		if len(l) == 0 {
+			return nil, nil //nolint:nilnil // nil is a valid value
+		}
+		items := make([]ruleset.RegexpListItem, len(l))
+		for i, v := range l {
+			item, err := ruleset.ParseRegexpListItem(v)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return ruleset.NewRegexpMatcherFromList(items)
+	}
+
+	var err error
+	if r.AllowDomains, err = matcher(fr.AllowDomains); err != nil {
+		return nil, fmt.Errorf("allow domains: %w", err)
+	}
+	if r.DenyDomains, err = matcher(fr.DenyDomains); err != nil {
+		return nil, fmt.Errorf("deny domains: %w", err)
+	}
+	for _, v := range fr.ConnectPorts {
+		pr, err := ParsePortRange(v)
+		if err != nil {
+			return nil, fmt.Errorf("connect ports: %w", err)
+		}
+		r.ConnectPorts = append(r.ConnectPorts, pr)
+	}
+	for _, v := range fr.AllowTimeFrame {
+		tf, err := ruleset.ParseTimeFrameEntry(v)
+		if err != nil {
+			return nil, fmt.Errorf("allow time frame: %w", err)
+		}
+		r.AllowTimeFrame = append(r.AllowTimeFrame, tf)
+	}
+	if fr.TimeZone != "" {
+		loc, err := time.LoadLocation(fr.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("time zone: %w", err)
+		}
+		r.AllowTimeFrame = ruleset.InLocation(r.AllowTimeFrame, loc)
+	}
+	switch fr.UpstreamProxy {
+	case "":
+	case "direct":
+		r.Direct = true
+	default:
+		u, err := ParseProxyURL(fr.UpstreamProxy)
+		if err != nil {
+			return nil, fmt.Errorf("upstream proxy: %w", err)
+		}
+		if err := validateProxyURL(u); err != nil {
+			return nil, fmt.Errorf("upstream proxy: %w", err)
+		}
+		r.UpstreamProxy = u
+	}
+
+	return r, nil
+}
+
+// Match returns the first rule that applies to the user, or nil if there is none.
+// The groups are the groups of the user provided by the authentication method, they extend the ACL groups.
+func (a *ACL) Match(user string, groups ...string) *ACLRule {
+	if user == "" {
+		return nil
+	}
+	for _, r := range a.rules {
+		if slices.Contains(r.Users, user) || slices.Contains(r.Users, "*") {
+			return r
+		}
+		for _, g := range r.Groups {
+			if slices.Contains(a.groups[g], user) || slices.Contains(groups, g) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+type userGroupsContextKey struct{}
+
+func setContextUserGroups(ctx context.Context, groups []string) {
+	if len(groups) > 0 {
+		martian.SetContextValue(ctx, userGroupsContextKey{}, groups)
+	}
+}
+
+func contextUserGroups(ctx context.Context) []string {
+	groups, _ := martian.ContextValue(ctx, userGroupsContextKey{}).([]string)
+	return groups
+}
+
+// Allows returns an error if the rule does not allow the request at time t.
+func (r *ACLRule) Allows(req *http.Request, t time.Time) error {
+	host := req.URL.Hostname()
+	if r.AllowDomains != nil && !r.AllowDomains.Match(host) {
+		return ErrProxyDenied
+	}
+	if r.DenyDomains != nil && r.DenyDomains.Match(host) {
+		return ErrProxyDenied
+	}
+	if len(r.ConnectPorts) > 0 && req.Method == http.MethodConnect {
+		_, p, err := net.SplitHostPort(req.URL.Host)
+		if err != nil {
+			return ErrProxyDenied
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return ErrProxyDenied
+		}
+		if !slices.ContainsFunc(r.ConnectPorts, func(pr PortRange) bool { return pr.Contains(port) }) {
+			return ErrProxyDenied
+		}
+	}
+	if len(r.AllowTimeFrame) > 0 && !ruleset.MatchTimeFrame(r.AllowTimeFrame, t) {
+		return ErrProxyOutsideAllowedTimeframe
+	}
+	return nil
+}
+
+func (hp *HTTPProxy) userACL(a *ACL) martian.RequestModifier {
+	return martian.RequestModifierFunc(func(req *http.Request) error {
+		user := martian.ContextUser(req.Context())
+		r := a.Match(user, contextUserGroups(req.Context())...)
+		if r == nil {
+			return ErrProxyUserDenied
+		}
+		return r.Allows(req, time.Now())
+	})
+}
+
+// userUpstreamProxy returns a proxy function that uses the upstream proxy forced by the user ACL rule,
+// and falls back to fn if the rule does not force it.
+func (hp *HTTPProxy) userUpstreamProxy(a *ACL, fn ProxyFunc) ProxyFunc {
+	return func(req *http.Request) (*url.URL, error) {
+		if r := a.Match(martian.ContextUser(req.Context()), contextUserGroups(req.Context())...); r != nil {
+			if r.Direct {
+				return nil, nil
+			}
+			if r.UpstreamProxy != nil {
+				u := r.UpstreamProxy
+				if u.User == nil {
+					if ui := hp.creds.MatchURL(u); ui != nil {
+						uu := *u
+						uu.User = ui
+						u = &uu
+					}
+				}
+				return u, nil
+			}
+		}
+		if fn != nil {
+			return fn(req)
+		}
+		if hp.transportProxy != nil {
+			return hp.transportProxy(req)
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/forwarder/log/slog"
+)
+
+const testACL = `
+groups:
+  qa: [alice, bob]
+rules:
+  - name: qa
+    groups: [qa]
+    allow_domains: ['.*\.example\.com$']
+    deny_domains: ['admin\.example\.com']
+    connect_ports: ["443", "8000-8999"]
+    upstream_proxy: http://proxy.example.com:3128
+  - name: night
+    users: [carol]
+    allow_time_frame: ["mon/22-23"]
+  - name: default
+    users: ["*"]
+    upstream_proxy: direct
+`
+
+func TestACLMatch(t *testing.T) {
+	a, err := ParseACL(strings.NewReader(testACL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user string
+		rule string
+	}{
+		{"alice", "qa"},
+		{"bob", "qa"},
+		{"carol", "night"},
+		{"dave", "default"},
+	}
+	for _, tc := range tests {
+		r := a.Match(tc.user)
+		if r == nil || r.Name != tc.rule {
+			t.Errorf("Match(%q) = %v, want %q", tc.user, r, tc.rule)
+		}
+	}
+
+	if r := a.Match("eve", "qa"); r == nil || r.Name != "qa" {
+		t.Errorf("Match(%q, %q) = %v, want %q", "eve", "qa", r, "qa")
+	}
+}
+
+func TestACLRuleAllows(t *testing.T) {
+	a, err := ParseACL(strings.NewReader(testACL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	monday := time.Date(2026, 10, 19, 10, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		url    string
+		t      time.Time
+		err    error
+	}{
+		{"allowed domain", "alice", http.MethodGet, "http://www.example.com/", monday, nil},
+		{"not allowed domain", "alice", http.MethodGet, "http://www.saucelabs.com/", monday, ErrProxyDenied},
+		{"denied domain", "alice", http.MethodGet, "http://admin.example.com/", monday, ErrProxyDenied},
+		{"connect port", "alice", http.MethodConnect, "//www.example.com:443", monday, nil},
+		{"connect port range", "alice", http.MethodConnect, "//www.example.com:8080", monday, nil},
+		{"connect port denied", "alice", http.MethodConnect, "//www.example.com:22", monday, ErrProxyDenied},
+		{"outside time frame", "carol", http.MethodGet, "http://www.saucelabs.com/", monday, ErrProxyOutsideAllowedTimeframe},
+		{"within time frame", "carol", http.MethodGet, "http://www.saucelabs.com/", monday.Add(12 * time.Hour), nil},
+		{"default", "dave", http.MethodConnect, "//www.saucelabs.com:22", monday, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := &http.Request{Method: tc.method, URL: u}
+			if err := a.Match(tc.user).Allows(req, tc.t); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestACLParseErrors(t *testing.T) {
+	tests := []struct {
+		name, data, err string
+	}{
+		{"unknown field", "rules:\n  - users: [a]\n    foo: bar\n", "field foo not found"},
+		{"no users", "rules:\n  - name: x\n", "rule x: users or groups must be set"},
+		{"unknown group", "rules:\n  - groups: [qa]\n", "unknown group"},
+		{"bad port", "rules:\n  - users: [a]\n    connect_ports: [\"99999\"]\n", "connect ports"},
+		{"bad domain", "rules:\n  - users: [a]\n    deny_domains: [\"(\"]\n", "deny domains"},
+		{"bad proxy", "rules:\n  - users: [a]\n    upstream_proxy: ftp://x:1\n", "upstream proxy"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseACL(strings.NewReader(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestACLUpstreamProxy(t *testing.T) {
+	a, err := ParseACL(strings.NewReader(testACL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultHTTPProxyConfig()
+	cfg.BasicAuth = url.UserPassword("alice", "pass")
+	cfg.UpstreamProxy = &url.URL{Scheme: "http", Host: "global.example.com:3128"}
+	cfg.ACL = a
+
+	p, err := newHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", http.NoBody)
+	u, err := p.upstreamProxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "global.example.com:3128" {
+		t.Fatalf("expected global upstream proxy for unauthenticated request, got %v", u)
+	}
+}
+
+func TestACLSetDefaultLocation(t *testing.T) {
+	a, err := ParseACL(strings.NewReader(`
+rules:
+  - name: berlin
+    users: [alice]
+    allow_time_frame: ["mon/9-17"]
+    time_zone: Europe/Berlin
+  - name: default
+    users: ["*"]
+    allow_time_frame: ["mon/9-17"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetDefaultLocation(tokyo)
+
+	if loc := a.Match("alice").AllowTimeFrame[0].Location; loc.String() != "Europe/Berlin" {
+		t.Errorf("expected rule time zone to be kept, got %v", loc)
+	}
+	if loc := a.Match("bob").AllowTimeFrame[0].Location; loc != tokyo {
+		t.Errorf("expected default time zone, got %v", loc)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package activation implements the systemd socket activation protocol.
+// The service manager passes pre-bound sockets to the process as file descriptors starting at 3,
+// and describes them with the LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES environment variables.
+//
+// See https://www.freedesktop.org/software/systemd/man/latest/sd_listen_fds.html
+package activation
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	listenPIDEnv     = "LISTEN_PID"
+	listenFDsEnv     = "LISTEN_FDS"
+	listenFDNamesEnv = "LISTEN_FDNAMES"
+
+	// listenFDsStart is the first file descriptor passed by the service manager.
+	listenFDsStart = 3
+)
+
+// UnnamedSocket is the name systemd assigns to sockets without the FileDescriptorName= option.
+const UnnamedSocket = "unknown"
+
+// Files returns files passed to the process by the service manager.
+// If the LISTEN_PID variable is set, it must match the current process ID, otherwise no files are returned.
+// The files are named after the LISTEN_FDNAMES entries, missing names default to UnnamedSocket.
+// If unsetEnv is true, the environment variables are removed so that child processes do not inherit them.
+func Files(unsetEnv bool) ([]*os.File, error) {
+	if unsetEnv {
+		defer func() {
+			os.Unsetenv(listenPIDEnv)
+			os.Unsetenv(listenFDsEnv)
+			os.Unsetenv(listenFDNamesEnv)
+		}()
+	}
+
+	if pid := os.Getenv(listenPIDEnv); pid != "" {
+		n, err := strconv.Atoi(pid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", listenPIDEnv, err)
+		}
+		if n != os.Getpid() {
+			return nil, nil
+		}
+	}
+
+	fds := os.Getenv(listenFDsEnv)
+	if fds == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", listenFDsEnv, err)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("invalid %s: %d", listenFDsEnv, n)
+	}
+
+	var names []string
+	if v := os.Getenv(listenFDNamesEnv); v != "" {
+		names = strings.Split(v, ":")
+	}
+
+	files := make([]*os.File, 0, n)
+	for i := range n {
+		fd := listenFDsStart + i
+		closeOnExec(fd)
+
+		name := UnnamedSocket
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files = append(files, os.NewFile(uintptr(fd), name)) //nolint:gosec // fd is never negative
+	}
+
+	return files, nil
+}
+
+// ListenersWithNames returns stream listeners passed by the service manager grouped by the socket name.
+// The environment variables are removed.
+// Files that are not listening sockets are closed and ignored.
+func ListenersWithNames() (map[string][]net.Listener, error) {
+	files, err := Files(true)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make(map[string][]net.Listener, len(files))
+	for _, f := range files {
+		l, err := net.FileListener(f)
+		f.Close() // FileListener dups the file descriptor.
+		if err != nil {
+			continue
+		}
+		listeners[f.Name()] = append(listeners[f.Name()], l)
+	}
+
+	return listeners, nil
+}
+
+// Env returns environment variables describing files passed to a child process with [os/exec.Cmd.ExtraFiles].
+// The files must be passed in the order of names, before any other extra files.
+// LISTEN_PID is not set as the child process ID is not known before it is started.
+func Env(names []string) []string {
+	return []string{
+		listenFDsEnv + "=" + strconv.Itoa(len(names)),
+		listenFDNamesEnv + "=" + strings.Join(names, ":"),
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:build unix
+
+package activation
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const helperEnv = "ACTIVATION_TEST_HELPER"
+
+// TestMain allows the test binary to act as an activated process.
+// It prints the inherited listeners as name=address lines.
+func TestMain(m *testing.M) {
+	if os.Getenv(helperEnv) == "" {
+		os.Exit(m.Run())
+	}
+
+	ll, err := ListenersWithNames()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for name, ls := range ll {
+		for _, l := range ls {
+			fmt.Printf("%s=%s\n", name, l.Addr())
+		}
+	}
+	if v := os.Getenv(listenFDsEnv); v != "" {
+		fmt.Fprintf(os.Stderr, "%s not unset: %s\n", listenFDsEnv, v)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestListenersWithNames(t *testing.T) {
+	listen := func() (*net.TCPListener, *os.File) {
+		t.Helper()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		f, err := l.(*net.TCPListener).File() //nolint:forcetypeassert // tcp listener
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return l.(*net.TCPListener), f //nolint:forcetypeassert // tcp listener
+	}
+
+	proxy, proxyFile := listen()
+	api, apiFile := listen()
+	unnamed, unnamedFile := listen()
+
+	run := func(t *testing.T, pid string, extraEnv ...string) []string {
+		t.Helper()
+
+		// Use shell exec to keep the PID so that LISTEN_PID can be set to the helper process ID.
+		cmd := exec.Command("/bin/sh", "-c", "LISTEN_PID="+pid+" exec \"$0\"", os.Args[0]) //nolint:noctx // test
+		cmd.Env = append(os.Environ(), helperEnv+"=1", listenFDsEnv+"=3")
+		cmd.Env = append(cmd.Env, extraEnv...)
+		cmd.ExtraFiles = []*os.File{proxyFile, apiFile, unnamedFile}
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Fields(string(out))
+		slices.Sort(lines)
+		return lines
+	}
+
+	t.Run("names", func(t *testing.T) {
+		got := run(t, "$$", listenFDNamesEnv+"=proxy:api")
+		want := []string{
+			"api=" + api.Addr().String(),
+			"proxy=" + proxy.Addr().String(),
+			UnnamedSocket + "=" + unnamed.Addr().String(),
+		}
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("pid mismatch", func(t *testing.T) {
+		if got := run(t, "1"); len(got) != 0 {
+			t.Fatalf("expected no listeners, got %v", got)
+		}
+	})
+}
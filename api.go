@@ -9,6 +9,7 @@ package forwarder
 import (
 	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/pprof"
 	"sort"
@@ -26,7 +27,7 @@ const APIUnixSocket = "/tmp/forwarder.sock"
 // It provides health and readiness endpoints prometheus metrics, and pprof debug endpoints.
 type APIHandler struct {
 	mux   *http.ServeMux
-	ready func(ctx context.Context) bool
+	ready func(ctx context.Context) error
 
 	title    string
 	patterns []string
@@ -37,7 +38,26 @@ type APIEndpoint struct {
 	Handler http.Handler
 }
 
+// errNotReady is reported by /readyz if the ready function passed to NewAPIHandler returns false.
+var errNotReady = errors.New("not ready")
+
+// NewAPIHandler creates a new API handler, if ready is nil the /readyz endpoint always reports ready.
 func NewAPIHandler(title string, r prometheus.Gatherer, ready func(ctx context.Context) bool, extraEndpoints ...APIEndpoint) *APIHandler {
+	var readyErr func(ctx context.Context) error
+	if ready != nil {
+		readyErr = func(ctx context.Context) error {
+			if !ready(ctx) {
+				return errNotReady
+			}
+			return nil
+		}
+	}
+	return NewAPIHandlerWithReadiness(title, r, readyErr, extraEndpoints...)
+}
+
+// NewAPIHandlerWithReadiness is like NewAPIHandler but ready returns an error,
+// which is written in the /readyz response body, see ReadinessChecks.
+func NewAPIHandlerWithReadiness(title string, r prometheus.Gatherer, ready func(ctx context.Context) error, extraEndpoints ...APIEndpoint) *APIHandler {
 	m := http.NewServeMux()
 	a := &APIHandler{
 		mux:   m,
@@ -81,14 +101,22 @@ func (h *APIHandler) healthz(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (h *APIHandler) readyz(w http.ResponseWriter, r *http.Request) {
-	if h.ready == nil || h.ready(r.Context()) {
+	var err error
+	if h.ready != nil {
+		err = h.ready(r.Context())
+	}
+	if err == nil {
 		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "text/plain")
 		w.Write([]byte("OK"))
 	} else {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte("Service Unavailable"))
+		if errors.Is(err, errNotReady) {
+			w.Write([]byte("Service Unavailable"))
+		} else {
+			w.Write([]byte("Service Unavailable\n" + err.Error() + "\n"))
+		}
 	}
 }
 
@@ -135,3 +163,31 @@ func (h *APIHandler) index(w http.ResponseWriter, _ *http.Request) {
 func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.mux.ServeHTTP(w, r)
 }
+
+// errNotFound is wrapped by errors of POST handlers that result in 404 Not Found status code, see postHandler.
+var errNotFound = errors.New("not found")
+
+// postHandler returns a handler that only accepts POST requests and calls fn.
+// If fn returns an error wrapping errNotFound the response status code is 404 Not Found,
+// for other errors it is 400 Bad Request, otherwise OK is written.
+func postHandler(fn func(r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := fn(r); err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, errNotFound) {
+				code = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("OK"))
+	})
+}
@@ -0,0 +1,319 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrProxyAuthLocked is returned when the client IP or user is locked out after too many failed authentications.
+var ErrProxyAuthLocked = errors.New("too many failed proxy authentication attempts")
+
+type authLockedError struct {
+	retryAfter time.Duration
+}
+
+func (e authLockedError) Error() string {
+	return ErrProxyAuthLocked.Error()
+}
+
+func (e authLockedError) Is(target error) bool {
+	return target == ErrProxyAuthLocked
+}
+
+func (e authLockedError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+type AuthLockoutConfig struct {
+	// MaxFailures is the number of failed authentications after which the client IP or user is locked out.
+	// Zero disables lockout.
+	MaxFailures int
+	// Window is the time after the last failed authentication after which failures are forgotten.
+	Window time.Duration
+	// Duration is the duration of the first lockout, every subsequent lockout is twice as long as the previous one.
+	Duration time.Duration
+	// MaxDuration is the maximum lockout duration.
+	MaxDuration time.Duration
+}
+
+func DefaultAuthLockoutConfig() *AuthLockoutConfig {
+	return &AuthLockoutConfig{
+		Window:      10 * time.Minute,
+		Duration:    time.Minute,
+		MaxDuration: time.Hour,
+	}
+}
+
+func (c *AuthLockoutConfig) Validate() error {
+	if c.MaxFailures < 0 {
+		return errors.New("max failures must not be negative")
+	}
+	if c.MaxFailures == 0 {
+		return nil
+	}
+	if c.Window <= 0 {
+		return errors.New("window must be positive")
+	}
+	if c.Duration <= 0 {
+		return errors.New("duration must be positive")
+	}
+	if c.MaxDuration < c.Duration {
+		return errors.New("max duration must not be less than duration")
+	}
+	return nil
+}
+
+// Lockout kinds.
+const (
+	AuthLockoutIP   = "ip"
+	AuthLockoutUser = "user"
+)
+
+// maxAuthLockoutEntries limits the number of tracked client IPs and users.
+const maxAuthLockoutEntries = 100000
+
+type authLockoutKey struct {
+	kind, value string
+}
+
+type authLockoutEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockouts    int
+	lockedUntil time.Time
+}
+
+// authLockout tracks failed authentications per client IP and user,
+// and locks them out with exponential backoff.
+type authLockout struct {
+	config  AuthLockoutConfig
+	metrics *httpProxyMetrics
+
+	mu        sync.Mutex
+	entries   map[authLockoutKey]*authLockoutEntry
+	lastSweep time.Time
+}
+
+func newAuthLockout(cfg *AuthLockoutConfig, metrics *httpProxyMetrics) *authLockout {
+	return &authLockout{
+		config:  *cfg,
+		metrics: metrics,
+		entries: make(map[authLockoutKey]*authLockoutEntry),
+	}
+}
+
+// check returns an error if any of the keys is locked out.
+func (l *authLockout) check(keys ...authLockoutKey) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, k := range keys {
+		if e, ok := l.entries[k]; ok && now.Before(e.lockedUntil) {
+			retryAfter = max(retryAfter, e.lockedUntil.Sub(now))
+		}
+	}
+	if retryAfter > 0 {
+		return authLockedError{retryAfter: retryAfter}
+	}
+	return nil
+}
+
+// failure records a failed authentication for the keys.
+func (l *authLockout) failure(keys ...authLockoutKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	for _, k := range keys {
+		e, ok := l.entries[k]
+		if !ok {
+			if len(l.entries) >= maxAuthLockoutEntries {
+				continue
+			}
+			e = new(authLockoutEntry)
+			l.entries[k] = e
+		}
+		if now.Sub(e.lastFailure) > l.config.Window {
+			e.failures = 0
+		}
+		e.failures++
+		e.lastFailure = now
+
+		if e.failures >= l.config.MaxFailures {
+			e.failures = 0
+			e.lockouts++
+			e.lockedUntil = now.Add(l.lockoutDuration(e.lockouts))
+			l.metrics.authLockout(k.kind)
+		}
+	}
+}
+
+func (l *authLockout) lockoutDuration(n int) time.Duration {
+	d := l.config.Duration
+	for i := 1; i < n && d < l.config.MaxDuration; i++ {
+		d *= 2
+	}
+	return min(d, l.config.MaxDuration)
+}
+
+// success forgets failed authentications for the keys.
+// It is only called with user keys, client IP entries expire in sweep.
+func (l *authLockout) success(keys ...authLockoutKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, k := range keys {
+		delete(l.entries, k)
+	}
+}
+
+// sweep removes entries that are not locked out and have no recent failures.
+// Entries are kept for MaxDuration after the last failure so that repeated lockouts grow exponentially.
+func (l *authLockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute && len(l.entries) < maxAuthLockoutEntries {
+		return
+	}
+	l.lastSweep = now
+
+	ttl := max(l.config.Window, l.config.MaxDuration)
+	for k, e := range l.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.lastFailure) > ttl {
+			delete(l.entries, k)
+		}
+	}
+}
+
+// AuthLockoutInfo describes a client IP or user with failed authentications.
+type AuthLockoutInfo struct {
+	Kind        string     `json:"kind"`
+	Value       string     `json:"value"`
+	Failures    int        `json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	Lockouts    int        `json:"lockouts"`
+	Locked      bool       `json:"locked"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+func (l *authLockout) list() []AuthLockoutInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	res := make([]AuthLockoutInfo, 0, len(l.entries))
+	for k, e := range l.entries {
+		li := AuthLockoutInfo{
+			Kind:        k.kind,
+			Value:       k.value,
+			Failures:    e.failures,
+			LastFailure: e.lastFailure,
+			Lockouts:    e.lockouts,
+			Locked:      now.Before(e.lockedUntil),
+		}
+		if li.Locked {
+			t := e.lockedUntil
+			li.LockedUntil = &t
+		}
+		res = append(res, li)
+	}
+	slices.SortFunc(res, func(a, b AuthLockoutInfo) int {
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+
+	return res
+}
+
+func (l *authLockout) clear(k authLockoutKey) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.entries[k]
+	delete(l.entries, k)
+	return ok
+}
+
+func clientIPKey(req *http.Request) authLockoutKey {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	return authLockoutKey{AuthLockoutIP, ip}
+}
+
+func userKey(user string) authLockoutKey {
+	return authLockoutKey{AuthLockoutUser, user}
+}
+
+// AuthLockouts returns client IPs and users with failed proxy authentications.
+// It returns nil if lockout is disabled.
+func (hp *HTTPProxy) AuthLockouts() []AuthLockoutInfo {
+	if hp.authLockout == nil {
+		return nil
+	}
+	return hp.authLockout.list()
+}
+
+// ClearAuthLockout forgets failed authentications of the client IP or user, kind is "ip" or "user".
+// It returns false if there were none.
+func (hp *HTTPProxy) ClearAuthLockout(kind, value string) bool {
+	if hp.authLockout == nil {
+		return false
+	}
+	return hp.authLockout.clear(authLockoutKey{kind, value})
+}
+
+// LockoutzHandler returns a handler that lists client IPs and users with failed proxy authentications in JSON format.
+func (hp *HTTPProxy) LockoutzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		res := hp.AuthLockouts()
+		if res == nil {
+			res = []AuthLockoutInfo{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res) //nolint:errcheck // ignore error
+	})
+}
+
+// ClearLockoutHandler returns a handler that clears the lockout of the client IP or user
+// given in the ip or user query parameter.
+// It only accepts POST requests.
+func (hp *HTTPProxy) ClearLockoutHandler() http.Handler {
+	return postHandler(func(r *http.Request) error {
+		q := r.URL.Query()
+		var kind, value string
+		switch {
+		case q.Has(AuthLockoutIP):
+			kind, value = AuthLockoutIP, q.Get(AuthLockoutIP)
+		case q.Has(AuthLockoutUser):
+			kind, value = AuthLockoutUser, q.Get(AuthLockoutUser)
+		default:
+			return errors.New("ip or user query parameter is required")
+		}
+		if !hp.ClearAuthLockout(kind, value) {
+			return fmt.Errorf("lockout %w", errNotFound)
+		}
+
+		hp.log.Info("cleared auth lockout on API request", kind, value)
+
+		return nil
+	})
+}
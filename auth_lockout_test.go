@@ -0,0 +1,137 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/forwarder/log/slog"
+)
+
+func TestAuthLockoutDuration(t *testing.T) {
+	l := newAuthLockout(&AuthLockoutConfig{
+		MaxFailures: 1,
+		Window:      time.Minute,
+		Duration:    time.Minute,
+		MaxDuration: 5 * time.Minute,
+	}, newHTTPProxyMetrics(nil, ""))
+
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		if d := l.lockoutDuration(i + 1); d != w {
+			t.Errorf("lockout %d: expected %s, got %s", i+1, w, d)
+		}
+	}
+}
+
+func TestAuthLockout(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	cfg := DefaultHTTPProxyConfig()
+	cfg.ProxyLocalhost = AllowProxyLocalhost
+	cfg.BasicAuth = url.UserPassword("alice", "pass")
+	cfg.AuthLockout.MaxFailures = 3
+
+	p, err := newHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(user, pass string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, target.URL, http.NoBody)
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+		rw := httptest.NewRecorder()
+		p.handler().ServeHTTP(rw, req)
+		return rw.Result()
+	}
+
+	for range 3 {
+		if res := do("alice", "bad"); res.StatusCode != http.StatusProxyAuthRequired {
+			t.Fatalf("expected status %d, got %d", http.StatusProxyAuthRequired, res.StatusCode)
+		}
+	}
+
+	res := do("alice", "pass")
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, res.StatusCode)
+	}
+	if ra := res.Header.Get("Retry-After"); ra != "60" {
+		t.Fatalf("expected Retry-After 60, got %q", ra)
+	}
+
+	l := p.AuthLockouts()
+	if len(l) != 2 || !l[0].Locked || !l[1].Locked {
+		t.Fatalf("expected client IP and user to be locked, got %+v", l)
+	}
+
+	if !p.ClearAuthLockout(AuthLockoutIP, "192.0.2.1") {
+		t.Fatal("expected client IP lockout to be cleared")
+	}
+	if res := do("alice", "pass"); res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected user to stay locked, got status %d", res.StatusCode)
+	}
+	if !p.ClearAuthLockout(AuthLockoutUser, "alice") {
+		t.Fatal("expected user lockout to be cleared")
+	}
+	if res := do("alice", "pass"); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	if l := p.AuthLockouts(); len(l) != 0 {
+		t.Fatalf("expected no lockouts, got %+v", l)
+	}
+}
+
+func TestAuthLockoutInterleavedSuccess(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	cfg := DefaultHTTPProxyConfig()
+	cfg.ProxyLocalhost = AllowProxyLocalhost
+	cfg.BasicAuth = url.UserPassword("alice", "pass")
+	cfg.AuthLockout.MaxFailures = 3
+
+	p, err := newHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(user, pass string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, target.URL, http.NoBody)
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+		rw := httptest.NewRecorder()
+		p.handler().ServeHTTP(rw, req)
+		return rw.Result()
+	}
+
+	// Logging in with a valid account between guesses does not reset the client IP failures.
+	for range 3 {
+		if res := do("alice", "pass"); res.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+		}
+		if res := do("bob", "guess"); res.StatusCode != http.StatusProxyAuthRequired {
+			t.Fatalf("expected status %d, got %d", http.StatusProxyAuthRequired, res.StatusCode)
+		}
+	}
+
+	if res := do("alice", "pass"); res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected client IP to be locked, got status %d", res.StatusCode)
+	}
+	l := p.AuthLockouts()
+	if len(l) != 1 || l[0].Kind != AuthLockoutIP || !l[0].Locked || l[0].Lockouts != 1 {
+		t.Fatalf("expected client IP to be locked, got %+v", l)
+	}
+}
@@ -13,12 +13,14 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/mmatczuk/anyflag"
 	"github.com/saucelabs/forwarder"
 	"github.com/saucelabs/forwarder/fileurl"
 	"github.com/saucelabs/forwarder/header"
 	"github.com/saucelabs/forwarder/httplog"
+	"github.com/saucelabs/forwarder/jwtauth"
 	"github.com/saucelabs/forwarder/log"
 	"github.com/saucelabs/forwarder/ruleset"
 	"github.com/spf13/cobra"
@@ -151,6 +153,45 @@ func HTTPProxyConfig(fs *pflag.FlagSet, cfg *forwarder.HTTPProxyConfig, lcfg *lo
 			"Setting this to direct sends requests to localhost directly without using the upstream proxy. "+
 			"By default, requests to localhost are denied. ")
 
+	clientCertIdentityValues := []forwarder.ClientCertIdentity{
+		forwarder.ClientCertIdentityCN,
+		forwarder.ClientCertIdentityDNS,
+		forwarder.ClientCertIdentityEmail,
+		forwarder.ClientCertIdentityURI,
+	}
+	fs.Var(anyflag.NewValue[forwarder.ClientCertIdentity](cfg.ClientCertIdentity, &cfg.ClientCertIdentity, anyflag.EnumParser[forwarder.ClientCertIdentity](clientCertIdentityValues...)),
+		"tls-client-identity", "<cn|dns|email|uri>"+
+			"Client certificate field used as the user identity if client certificates are verified. "+
+			"The identity is the subject common name or the first subject alternative name of the given type. "+
+			"It can be used in ACL rules, and is reported in logs and metrics. "+
+			"Requests with a verified client certificate do not require basic authentication. ")
+
+	fs.Var(anyflag.NewSliceValue[forwarder.PortRange](cfg.ConnectPorts, &cfg.ConnectPorts, forwarder.ParsePortRange),
+		"connect-ports", "<port|start-end>,..."+
+			"Allow CONNECT requests only to the specified destination ports or port ranges (e.g. 443,8443,9000-9100). "+
+			"Set it to 1-65535 to allow CONNECT requests to all ports. ")
+
+	fs.Var(anyflag.NewSliceValue[forwarder.PortRule](cfg.ConnectPortRules, &cfg.ConnectPortRules, forwarder.ParsePortRule),
+		"connect-ports-domain", "<regexp>=<port|start-end>[;...],..."+
+			"Allow CONNECT requests to domains matching the regexp only to the specified ports, "+
+			"overriding the --connect-ports flag for those domains (e.g. '^ssh\\.example\\.com$=22;2222'). "+
+			"The first matching rule applies. ")
+
+	fs.Var(anyflag.NewSliceValue[forwarder.RequestRateLimitRule](cfg.RequestRateLimits, &cfg.RequestRateLimits, forwarder.ParseRequestRateLimitRule),
+		"request-rate-limit", "[<regexp>=]<host|ip|user>:<rate>[/s|/m|/h][:<burst>],..."+
+			"Limit the rate of requests with a token bucket per destination host, client IP or authenticated user. "+
+			"The rate is in requests per second unless a unit is given, the burst defaults to the rate per second rounded up. "+
+			"If the regexp is given, the limit only applies to matching domains (e.g. '^api\\.example\\.com$=host:10', 'ip:600/m:50'). "+
+			"All matching limits apply, requests exceeding any of them receive 429 status code with the Retry-After header. "+
+			"The limits are checked after authentication and access rules, including forward auth, requests denied by them are not counted. "+
+			"Requests in MITM tunnels are counted. ")
+
+	fs.Var(anyflag.NewSliceValue[forwarder.PortRange](cfg.HTTPPorts, &cfg.HTTPPorts, forwarder.ParsePortRange),
+		"http-ports", "<port|start-end>,..."+
+			"Allow plain HTTP requests only to the specified destination ports or port ranges (e.g. 80,8080). "+
+			"Requests in MITM tunnels are not affected. "+
+			"By default, plain HTTP requests to all ports are allowed. ")
+
 	fs.StringVar(&cfg.Name, "name", cfg.Name, "<string>"+
 		"Name of this proxy instance. This value is used in the Via header in requests. "+
 		"The name value in Via header is extended with a random string to avoid collisions when several proxies are chained. ")
@@ -159,6 +200,48 @@ func HTTPProxyConfig(fs *pflag.FlagSet, cfg *forwarder.HTTPProxyConfig, lcfg *lo
 		"<name>"+
 			"If the header is present in the request, "+
 			"the proxy will associate the value with the request in the logs. ")
+
+	fs.Var(&cfg.UserReadLimit, "read-limit-per-user", "<bandwidth>"+
+		"Read rate limit in bytes per second shared by connections of the same authenticated user. "+
+		"The limit applies to a connection, including CONNECT tunnels, after the user is authenticated. "+
+		"Accepts binary format (e.g. 1.5Ki, 1Mi, 3.6Gi). ")
+
+	fs.Var(&cfg.UserWriteLimit, "write-limit-per-user", "<bandwidth>"+
+		"Write rate limit in bytes per second shared by connections of the same authenticated user. "+
+		"The limit applies to a connection, including CONNECT tunnels, after the user is authenticated. "+
+		"Accepts binary format (e.g. 1.5Ki, 1Mi, 3.6Gi). ")
+
+	fs.BoolVar(&cfg.TrackTraffic, "track-traffic", cfg.TrackTraffic, ""+
+		"Count bytes received and sent by each client connection, and list them in the /admin/connz API endpoint. ")
+
+	fs.BoolVar(&cfg.DynamicRateLimit, "dynamic-rate-limit", cfg.DynamicRateLimit, ""+
+		"Allow changing the listener and connection bandwidth limits at runtime with the admin API, "+
+		"even if no limit is set at startup. "+
+		"Rate limited connections do not use zero-copy forwarding of tunneled traffic. ")
+
+	fs.Var(anyflag.NewSliceValue[forwarder.NetworkProfile](cfg.NetworkProfiles, &cfg.NetworkProfiles, forwarder.ParseNetworkProfile),
+		"network-profile", "<name>:<key>=<value>[;...],..."+
+			"Define a network profile emulating network conditions on client connections, "+
+			"it applies to plain HTTP requests and CONNECT tunnels alike. "+
+			"The keys are read-limit and write-limit in bytes per second, latency and jitter added to each read and write, "+
+			"reset and stall probabilities of resetting the connection or stalling it for stall-duration (default 5s) on a read or write "+
+			"(e.g. '3g:read-limit=96Ki;write-limit=32Ki;latency=100ms;jitter=30ms', 'flaky-wifi:latency=20ms;reset=0.001;stall=0.01;stall-duration=2s'). "+
+			"The profile is selected with the network-profile-listener, network-profile-rule and network-profile-header flags or the admin API. "+
+			"Defining a profile enables dynamic rate limiting on all listeners, see dynamic-rate-limit, "+
+			"so connections do not use zero-copy forwarding of tunneled traffic. ")
+
+	fs.StringVar(&cfg.NetworkProfile, "network-profile-listener", cfg.NetworkProfile, "<name>"+
+		"Network profile emulated on connections to the proxy listener, unless another profile is selected. ")
+
+	fs.Var(anyflag.NewSliceValue[forwarder.NetworkProfileRule](cfg.NetworkProfileRules, &cfg.NetworkProfileRules, forwarder.ParseNetworkProfileRule),
+		"network-profile-rule", "<client:<cidr>|domain:<regexp>>=<profile>,..."+
+			"Select the network profile for requests from clients in the network or to matching domains "+
+			"(e.g. 'client:10.0.0.0/8=3g', 'domain:\\.example\\.com$=flaky-wifi'). "+
+			"The first matching rule applies, the profile applies to the client connection until another request selects a different one. ")
+
+	fs.StringVar(&cfg.NetworkProfileHeader, "network-profile-header", cfg.NetworkProfileHeader, "<name>"+
+		"Request header selecting the network profile by name, it takes precedence over the rules. "+
+		"The header is removed from the request, requests selecting an unknown profile receive 400 status code. ")
 }
 
 func DenyDomains(fs *pflag.FlagSet, cfg *[]ruleset.RegexpListItem) {
@@ -176,10 +259,100 @@ func DirectDomains(fs *pflag.FlagSet, cfg *[]ruleset.RegexpListItem) {
 			"This flag takes precedence over the PAC script.")
 }
 
+const domainListSyntax = "<p/>" +
+	"The file contains one rule per line in one of the following formats:" +
+	"<ul>" +
+	"<li>Domain: <code>example.com</code> matches the domain, <code>.example.com</code> also matches subdomains, <code>*.example.com</code> matches only subdomains" +
+	"<li>Regexp: <code>/^ads[0-9]+\\./</code>" +
+	"<li>Hosts file: <code>0.0.0.0 example.com</code>" +
+	"<li>Adblock: <code>||example.com^</code> matches the domain and subdomains, <code>@@||example.com^</code> excludes them" +
+	"</ul>" +
+	"Prefix rules with '-' to exclude domains. " +
+	"Lines starting with #, ! or [ are ignored. " +
+	"The file is matched efficiently and may contain hundreds of thousands of rules. "
+
+func DenyDomainsFile(fs *pflag.FlagSet, path *string) {
+	fs.StringVar(path, "deny-domains-file", *path, "<path>"+
+		"Deny requests to domains listed in the file, in addition to the --deny-domains flag. "+
+		domainListSyntax)
+}
+
+func DirectDomainsFile(fs *pflag.FlagSet, path *string) {
+	fs.StringVar(path, "direct-domains-file", *path, "<path>"+
+		"Connect directly to domains listed in the file without using the upstream proxy, in addition to the --direct-domains flag. "+
+		"See the --deny-domains-file flag for the file format. ")
+}
+
+func DomainListURLs(fs *pflag.FlagSet, deny, direct **url.URL, cfg *forwarder.DomainListConfig) {
+	fs.Var(anyflag.NewValueWithRedact[*url.URL](*deny, deny, fileurl.ParseFilePathOrURL, RedactURL),
+		"deny-domains-url", "<path or URL>"+
+			"Deny requests to domains listed in the file fetched from the URL, in addition to the --deny-domains flag. "+
+			"The list is refreshed periodically, if fetching the list fails the current rules are kept. "+
+			"See the --deny-domains-file flag for the file format. ")
+
+	fs.Var(anyflag.NewValueWithRedact[*url.URL](*direct, direct, fileurl.ParseFilePathOrURL, RedactURL),
+		"direct-domains-url", "<path or URL>"+
+			"Connect directly to domains listed in the file fetched from the URL without using the upstream proxy, "+
+			"in addition to the --direct-domains flag. "+
+			"The list is refreshed periodically, if fetching the list fails the current rules are kept. "+
+			"See the --deny-domains-file flag for the file format. ")
+
+	fs.DurationVar(&cfg.RefreshInterval, "domains-url-refresh-interval", cfg.RefreshInterval, "<duration>"+
+		"Interval between fetches of the --deny-domains-url and --direct-domains-url lists. "+
+		"HTTP URLs are fetched with conditional requests using the ETag and Last-Modified headers. "+
+		"The lists are fetched directly, the upstream proxy and PAC are not used. ")
+
+	fs.StringVar(&cfg.CacheDir, "domains-url-cache-dir", cfg.CacheDir, "<path>"+
+		"Directory where the last good copies of the --deny-domains-url and --direct-domains-url lists are kept. "+
+		"If a list cannot be fetched at startup, the copy is used instead. ")
+
+	fs.Var(&cfg.MaxSize, "domains-url-max-size", "<size>"+
+		"Maximum size of the --deny-domains-url and --direct-domains-url lists fetched over HTTP, larger lists are rejected. "+
+		"Accepts binary format (e.g. 1.5Ki, 1Mi, 3.6Gi). ")
+}
+
 func AllowTimeFrame(fs *pflag.FlagSet, cfg *[]ruleset.TimeFrameEntry) {
 	fs.Var(anyflag.NewSliceValue[ruleset.TimeFrameEntry](*cfg, cfg, ruleset.ParseTimeFrameEntry),
 		"allow-time-frame", "<timeframe-spec>,..."+
-			"Allow tunnel traffic only within particular time frames.")
+			"Allow tunnel traffic only within particular time frames. "+
+			timeFrameSyntax)
+}
+
+const timeFrameSyntax = "<p/>" +
+	"The time frame format is:" +
+	"<ul>" +
+	"<li>Weekday and time range: <code>mon/9-17</code>, <code>tue/08:30-17:45</code>" +
+	"<li>Time range crossing midnight, it ends on the next day: <code>fri/22:00-02:00</code>" +
+	"<li>Date and time range: <code>2025-12-24/10:00-12:00</code>" +
+	"<li>Whole date: <code>2025-12-25</code>" +
+	"</ul>" +
+	"Prefix time frames with '-' to exclude them e.g. holidays or maintenance windows. " +
+	"If there are only excluded time frames, any other time matches. " +
+	"Time frames are evaluated in the time zone set with the --time-frame-zone flag. "
+
+func DomainTimeFrames(fs *pflag.FlagSet, deny, allow *[]forwarder.DomainTimeFrameRule) {
+	fs.Var(anyflag.NewSliceValue[forwarder.DomainTimeFrameRule](*deny, deny, forwarder.ParseDomainTimeFrameRule),
+		"deny-domains-time-frame", "<regexp>=[<zone>|]<timeframe-spec>[;...],..."+
+			"Deny requests to domains matching the regexp within the time frames (e.g. '\\.example\\.com$=mon/12:00-13:00;-2025-12-25'). "+
+			"The time frames are evaluated in the optional IANA time zone of the rule (e.g. '\\.example\\.com$=Asia/Tokyo|mon/12:00-13:00'), "+
+			"or in the time zone set with the --time-frame-zone flag. "+
+			"See the --allow-time-frame flag for the time frame format. ")
+
+	fs.Var(anyflag.NewSliceValue[forwarder.DomainTimeFrameRule](*allow, allow, forwarder.ParseDomainTimeFrameRule),
+		"allow-domains-time-frame", "<regexp>=[<zone>|]<timeframe-spec>[;...],..."+
+			"Allow requests to domains matching the regexp only within the time frames, "+
+			"requests outside of them are denied with 451 status code. "+
+			"If more than one rule matches the domain, the request is allowed within any of their time frames. "+
+			"The time zone of a rule is set as in the --deny-domains-time-frame flag. "+
+			"See the --allow-time-frame flag for the time frame format. ")
+}
+
+func TimeFrameZone(fs *pflag.FlagSet, loc **time.Location) {
+	fs.Var(anyflag.NewValue[*time.Location](*loc, loc, time.LoadLocation),
+		"time-frame-zone", "<IANA time zone>"+
+			"Time zone the --allow-time-frame flag, the --deny-domains-time-frame and --allow-domains-time-frame rules without their own time zone, "+
+			"and the --acl-file rules without time_zone are evaluated in (e.g. Europe/Berlin). "+
+			"By default, the local time zone is used. ")
 }
 
 const pathOrBase64Syntax = "<p/>" +
@@ -248,6 +421,128 @@ func Credentials(fs *pflag.FlagSet, credentials *[]*forwarder.HostPortUser) {
 			"The flag can be specified multiple times to add multiple credentials. ")
 }
 
+func BasicAuthFile(fs *pflag.FlagSet, path *string) {
+	fs.StringVar(path, "basic-auth-file", *path, "<path>"+
+		"Path to an htpasswd file with users allowed to use the proxy. "+
+		"The supported password hashes are bcrypt (htpasswd -B), SHA-1 (htpasswd -s) and plain text, other hashes including crypt are rejected. "+
+		"The file is reloaded when it changes. "+
+		"This flag cannot be used with the --basic-auth flag. ")
+}
+
+func ACLFile(fs *pflag.FlagSet, path *string) {
+	fs.StringVar(path, "acl-file", *path, "<path>"+
+		"Path to a YAML file with per-user access control rules. "+
+		"A rule applies to users and groups, and may restrict destination domains, CONNECT ports and time frames, "+
+		"and force the upstream proxy. "+
+		"The first rule matching the authenticated user applies, requests of users without a matching rule are denied. "+
+		"It requires the --basic-auth, --basic-auth-file or --jwt-jwks flag, or verified client certificates. ")
+}
+
+func URLRulesFile(fs *pflag.FlagSet, path *string) {
+	fs.StringVar(path, "url-rules-file", *path, "<path>"+
+		"Path to a YAML file with rules that allow or deny requests by method, scheme, host, path and query. "+
+		"The rules are evaluated in order, the first matching rule applies, requests not matching any rule are allowed. "+
+		"A deny rule may set the response status code. "+
+		"Paths are matched after removing . and .. elements and duplicate slashes, "+
+		"a path glob must match the whole path, a path regexp matches any part of the path unless anchored with ^ and $. "+
+		"The rules only apply to plain HTTP requests and requests in MITM tunnels, "+
+		"CONNECT requests and tunnels that are not MITMed are not affected. ")
+}
+
+func ErrorPagesDir(fs *pflag.FlagSet, path *string) {
+	fs.StringVar(path, "error-pages-dir", *path, "<path>"+
+		"Directory with Go html/template files used to render error responses. "+
+		"If set, clients that accept text/html get HTML pages and clients that accept application/json get JSON, "+
+		"other clients get plain text. "+
+		"Templates are named after the error label reported in the forwarder_proxy_errors_total metric e.g. net_dial.html, "+
+		"or the error class: auth_required.html, denied.html, outside_time_frame.html, upstream_unreachable.html, tls_failure.html. "+
+		"The default.html template is used for other errors, if it does not exist a built-in page is used. "+
+		"Templates get the .Name, .Status, .StatusText, .Class, .Label, .Message, .Error, .RequestID, .Host and .ClientIP fields. ")
+}
+
+func JWTAuth(fs *pflag.FlagSet, jwks **url.URL, cfg *jwtauth.Config) {
+	fs.VarP(anyflag.NewValue[*url.URL](*jwks, jwks, fileurl.ParseFilePathOrURL),
+		"jwt-jwks", "", "<path or URL>"+
+			"JSON Web Key Set used to verify bearer tokens in the Proxy-Authorization header. "+
+			"If set, the proxy accepts Proxy-Authorization: Bearer <jwt>, in addition to basic authentication if enabled. "+
+			"The supported algorithms are RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384, ES512 and EdDSA. "+
+			"Tokens must not be expired, the key set is reloaded every 5 minutes and when a token is signed with an unknown key. ")
+
+	fs.StringVar(&cfg.Issuer, "jwt-issuer", cfg.Issuer, "<string>"+
+		"If set, the iss claim of bearer tokens must be equal to it. ")
+
+	fs.StringVar(&cfg.Audience, "jwt-audience", cfg.Audience, "<string>"+
+		"If set, the aud claim of bearer tokens must contain it. ")
+
+	fs.StringVar(&cfg.IdentityClaim, "jwt-identity-claim", cfg.IdentityClaim, "<name>"+
+		"Claim used as the user identity, it is reported in logs and matched against ACL users. ")
+
+	fs.StringVar(&cfg.GroupsClaim, "jwt-groups-claim", cfg.GroupsClaim, "<name>"+
+		"Claim with the user groups matched against ACL groups. "+
+		"The claim value can be an array of strings or a space separated string. ")
+
+	fs.DurationVar(&cfg.Leeway, "jwt-leeway", cfg.Leeway,
+		"The allowed clock skew when checking the exp and nbf claims of bearer tokens. ")
+}
+
+func AuthLockoutConfig(fs *pflag.FlagSet, cfg *forwarder.AuthLockoutConfig) {
+	fs.IntVar(&cfg.MaxFailures, "auth-lockout-max-failures", cfg.MaxFailures, "<int>"+
+		"Number of failed proxy authentications after which the client IP, and the user if it exists, are locked out. "+
+		"Locked out clients receive 429 status code with the Retry-After header. "+
+		"A successful authentication resets the failures of the user but not of the client IP. "+
+		"If proxy protocol is enabled, the client IP is the source address from the proxy protocol header. "+
+		"Zero disables lockout. ")
+
+	fs.DurationVar(&cfg.Window, "auth-lockout-window", cfg.Window,
+		"The amount of time after the last failed authentication after which failures are forgotten. ")
+
+	fs.DurationVar(&cfg.Duration, "auth-lockout-duration", cfg.Duration,
+		"Duration of the first lockout, every subsequent lockout is twice as long as the previous one. ")
+
+	fs.DurationVar(&cfg.MaxDuration, "auth-lockout-max-duration", cfg.MaxDuration,
+		"The maximum lockout duration. ")
+}
+
+func LoadSheddingConfig(fs *pflag.FlagSet, cfg *forwarder.LoadSheddingConfig) {
+	fs.IntVar(&cfg.MaxRequests, "max-requests", cfg.MaxRequests, "<int>"+
+		"Maximum number of requests in flight, excluding CONNECT tunnels. "+
+		"Requests over the limit receive 503 status code with the Retry-After header. "+
+		"Zero means no limit. ")
+
+	fs.IntVar(&cfg.MaxTunnels, "max-tunnels", cfg.MaxTunnels, "<int>"+
+		"Maximum number of open CONNECT tunnels, MITM tunnels are not counted. "+
+		"CONNECT requests over the limit receive 503 status code with the Retry-After header. "+
+		"Zero means no limit. ")
+
+	fs.Float64Var(&cfg.MemoryLimitRatio, "memory-limit-ratio", cfg.MemoryLimitRatio, "<float>"+
+		"Refuse requests with 503 status code when the live heap exceeds this fraction of the Go memory limit, "+
+		"set with the GOMEMLIMIT environment variable (e.g. 0.8). "+
+		"It prevents long garbage collection pauses under memory pressure. "+
+		"Zero disables it, it has no effect if the memory limit is not set. ")
+}
+
+func ForwardAuthConfig(fs *pflag.FlagSet, cfg *forwarder.ForwardAuthConfig) {
+	fs.VarP(anyflag.NewValueWithRedact[*url.URL](cfg.URL, &cfg.URL, url.ParseRequestURI, RedactURL),
+		"forward-auth-url", "", "<URL>"+
+			"URL of an HTTP service that allows or denies proxy requests. "+
+			"For every request, including CONNECT, the service receives a GET request with the X-Forwarded-Method, X-Forwarded-Host, X-Forwarded-Port, "+
+			"X-Forwarded-Uri, X-Forwarded-For and X-Forwarded-User headers, and the client Proxy-Authorization header. "+
+			"The request is allowed on 2xx status code, denied on 403, and proxy authentication is required on 401 and 407. "+
+			"On allow, the X-Forward-Auth-Header response header adds or removes request headers using the --header flag syntax, "+
+			"X-Forward-Auth-Upstream sets the upstream proxy URL or \"direct\", and X-Forward-Auth-User sets the user reported in logs. ")
+
+	fs.DurationVar(&cfg.Timeout, "forward-auth-timeout", cfg.Timeout,
+		"The maximum amount of time to wait for the authorization service response. ")
+
+	fs.DurationVar(&cfg.CacheTTL, "forward-auth-cache-ttl", cfg.CacheTTL,
+		"The amount of time allow and deny decisions are cached for. "+
+			"Zero disables caching. ")
+
+	fs.BoolVar(&cfg.FailOpen, "forward-auth-fail-open", cfg.FailOpen,
+		"Allow requests if the authorization service fails or returns an unexpected status code. "+
+			"By default, such requests are rejected with 503 status code. ")
+}
+
 func HTTPTransportConfig(fs *pflag.FlagSet, cfg *forwarder.HTTPTransportConfig) {
 	DialConfig(fs, &cfg.DialConfig, "http")
 
@@ -283,6 +578,28 @@ func DialConfig(fs *pflag.FlagSet, cfg *forwarder.DialConfig, prefix string) {
 		"The amount of time to wait between dial attempts. ")
 }
 
+// DialNetworks binds the dial deny and allow networks flags, they are only used by the proxy.
+func DialNetworks(fs *pflag.FlagSet, cfg *forwarder.DialConfig, prefix string) {
+	namePrefix := prefix
+	if namePrefix != "" {
+		namePrefix += "-"
+	}
+
+	fs.Var(anyflag.NewSliceValue[forwarder.IPNetwork](cfg.DenyNetworks, &cfg.DenyNetworks, forwarder.ParseIPNetwork),
+		namePrefix+"dial-deny-networks", "<cidr or preset>,..."+
+			"Do not connect to IP addresses in these networks, requests to them are denied with 403 status code. "+
+			"The check is done on resolved IP addresses right before connecting, so host names resolving to denied addresses, "+
+			"including DNS rebinding, are denied as well. "+
+			"The presets are: loopback, link-local, private (RFC 1918, RFC 6598 and RFC 4193) and metadata (cloud instance metadata services). "+
+			"When using an upstream proxy, the check applies to the upstream proxy address. "+
+			"It does not apply to the services the proxy calls on its own: PAC, JWKS, forward auth and domain list URLs. "+
+			"Example: loopback,link-local,private. ")
+
+	fs.Var(anyflag.NewSliceValue[forwarder.IPNetwork](cfg.AllowNetworks, &cfg.AllowNetworks, forwarder.ParseIPNetwork),
+		namePrefix+"dial-allow-networks", "<cidr or preset>,..."+
+			"Exceptions to --"+namePrefix+"dial-deny-networks, e.g. the address of an upstream proxy in a private network. ")
+}
+
 func ConnectTo(fs *pflag.FlagSet, cfg *[]forwarder.HostPortPair) {
 	fs.Var(anyflag.NewSliceValue[forwarder.HostPortPair](*cfg, cfg, forwarder.ParseHostPortPair),
 		"connect-to", "<HOST1:PORT1:HOST2:PORT2>,..."+
@@ -389,6 +706,69 @@ func ListenerConfig(fs *pflag.FlagSet, cfg *forwarder.ListenerConfig, prefix str
 	fs.Var(&cfg.WriteLimit, namePrefix+"write-limit", "<bandwidth>"+
 		"Global write rate limit in bytes per second i.e. how many bytes per second you can send to proxy. "+
 		"Accepts binary format (e.g. 1.5Ki, 1Mi, 3.6Gi). ")
+
+	fs.Var(&cfg.ConnReadLimit, namePrefix+"read-limit-per-connection", "<bandwidth>"+
+		"Read rate limit in bytes per second of each connection. "+
+		"Accepts binary format (e.g. 1.5Ki, 1Mi, 3.6Gi). ")
+
+	fs.Var(&cfg.ConnWriteLimit, namePrefix+"write-limit-per-connection", "<bandwidth>"+
+		"Write rate limit in bytes per second of each connection. "+
+		"Accepts binary format (e.g. 1.5Ki, 1Mi, 3.6Gi). ")
+
+	fs.Var(&cfg.ClientReadLimit, namePrefix+"read-limit-per-client", "<bandwidth>"+
+		"Read rate limit in bytes per second shared by connections from the same client IP. "+
+		"Accepts binary format (e.g. 1.5Ki, 1Mi, 3.6Gi). ")
+
+	fs.Var(&cfg.ClientWriteLimit, namePrefix+"write-limit-per-client", "<bandwidth>"+
+		"Write rate limit in bytes per second shared by connections from the same client IP. "+
+		"Accepts binary format (e.g. 1.5Ki, 1Mi, 3.6Gi). ")
+
+	fs.DurationVar(&cfg.RateLimitIdleTimeout, namePrefix+"rate-limit-idle-timeout", cfg.RateLimitIdleTimeout, "<duration>"+
+		"Time after which the per-client and per-user rate limiters of clients and users without connections are removed. ")
+
+	fs.IntVar(&cfg.MaxConns, namePrefix+"max-conns", cfg.MaxConns, "<int>"+
+		"Maximum number of open connections. "+
+		"New connections over the limit are rejected right away, see the overload-response flag. "+
+		"Zero means no limit. ")
+
+	fs.IntVar(&cfg.MaxConnsPerClient, namePrefix+"max-conns-per-client", cfg.MaxConnsPerClient, "<int>"+
+		"Maximum number of open connections from a client IP. "+
+		"If proxy protocol is enabled, the client IP is the source address from the proxy protocol header. "+
+		"Zero means no limit. ")
+
+	overloadResponseValues := []forwarder.OverloadResponse{
+		forwarder.OverloadClose,
+		forwarder.OverloadServiceUnavailable,
+	}
+	fs.Var(anyflag.NewValue[forwarder.OverloadResponse](cfg.OverloadResponse, &cfg.OverloadResponse, anyflag.EnumParser[forwarder.OverloadResponse](overloadResponseValues...)),
+		namePrefix+"overload-response", "<close|503>"+
+			"How connections over the connection limits are rejected. "+
+			"Setting this to close closes the TCP connection right away. "+
+			"Setting this to 503 responds with 503 status code and the Retry-After header before closing, it does not apply to TLS connections. ")
+
+	fs.Var(anyflag.NewSliceValue[netip.Prefix](cfg.ClientAllowCIDRs, &cfg.ClientAllowCIDRs, forwarder.ParseCIDR),
+		namePrefix+"client-allow-cidrs", "<cidr>"+
+			"Only accept connections from client IPs in these networks (e.g. 10.0.0.0/8, 192.168.1.1). "+
+			"If proxy protocol is enabled, the client IP is the source address from the proxy protocol header. "+
+			"By default, connections from all client IPs are accepted. ")
+
+	fs.Var(anyflag.NewSliceValue[netip.Prefix](cfg.ClientDenyCIDRs, &cfg.ClientDenyCIDRs, forwarder.ParseCIDR),
+		namePrefix+"client-deny-cidrs", "<cidr>"+
+			"Reject connections from client IPs in these networks. "+
+			"This takes precedence over the allow list. ")
+}
+
+func AdminAPI(fs *pflag.FlagSet, basicAuth **url.Userinfo, rulesFile *string) {
+	fs.VarP(anyflag.NewValueWithRedact[*url.Userinfo](*basicAuth, basicAuth, forwarder.ParseUserinfo, RedactUserinfo),
+		"api-admin-basic-auth", "", "<username[:password]>"+
+			"Basic authentication credentials to protect the admin endpoints of the API server. "+
+			"The admin endpoints allow to reload the configuration, to drain the proxy, to manage deny, direct and MITM domain rules and header rules, to list and close client connections, to list and clear auth lockouts, and to list and change bandwidth limits and network profiles at runtime. "+
+			"If not set, the admin endpoints are disabled. ")
+
+	fs.StringVar(rulesFile, "api-admin-rules-file", *rulesFile, "<path>"+
+		"Path to a JSON file with rules managed by the admin endpoints. "+
+		"The rules are loaded on startup and the file is updated on every change. "+
+		"The rules are applied in addition to the rules from the configuration. ")
 }
 
 func HTTPLogConfig(fs *pflag.FlagSet, cfg []NamedParam[httplog.Mode]) {
@@ -456,6 +836,31 @@ func TLSServerConfig(fs *pflag.FlagSet, cfg *forwarder.TLSServerConfig, namePref
 		namePrefix+"tls-key-file", "<path or base64>"+
 			"TLS private key to use if the server protocol is https or h2. "+
 			pathOrBase64Syntax)
+
+	fs.Var(anyflag.NewSliceValueWithRedact[string](cfg.ClientCAFiles, &cfg.ClientCAFiles, func(val string) (string, error) { return val, nil }, RedactBase64),
+		namePrefix+"tls-client-ca-file", "<path or base64>"+
+			"CA certificates to verify client certificates against if the server protocol is https or h2. "+
+			"Use this flag multiple times to specify multiple CA certificate files. "+
+			"If set, client certificates are required and verified by default, see --"+namePrefix+"tls-client-auth."+
+			pathOrBase64Syntax)
+
+	clientAuthValues := []forwarder.ClientAuthMode{
+		forwarder.NoClientCert,
+		forwarder.RequestClientCert,
+		forwarder.RequireAnyClientCert,
+		forwarder.VerifyClientCertIfGiven,
+		forwarder.RequireAndVerifyClientCert,
+	}
+	fs.Var(anyflag.NewValue[forwarder.ClientAuthMode](cfg.ClientAuth, &cfg.ClientAuth, anyflag.EnumParser[forwarder.ClientAuthMode](clientAuthValues...)),
+		namePrefix+"tls-client-auth", "<none|request|require|verify-if-given|require-and-verify>"+
+			"TLS client authentication policy. "+
+			"The verify modes require --"+namePrefix+"tls-client-ca-file. "+
+			"By default, it is require-and-verify if client CA is set, and none otherwise. ")
+
+	fs.StringVar(&cfg.ClientCRLFile, namePrefix+"tls-client-crl-file", cfg.ClientCRLFile, "<path>"+
+		"Certificate revocation list in PEM or DER format issued by one of the client CAs. "+
+		"Client certificates listed in it are rejected. "+
+		"The file is reloaded when it changes, if it cannot be reloaded or its next update time has passed all client certificates are rejected. ")
 }
 
 func LogConfig(fs *pflag.FlagSet, cfg *log.Config) {
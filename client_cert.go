@@ -0,0 +1,90 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+)
+
+// ClientCertIdentity selects the client certificate field used as the user identity.
+//
+//nolint:recvcheck // That is by design.
+type ClientCertIdentity string
+
+const (
+	ClientCertIdentityCN    ClientCertIdentity = "cn"
+	ClientCertIdentityDNS   ClientCertIdentity = "dns"
+	ClientCertIdentityEmail ClientCertIdentity = "email"
+	ClientCertIdentityURI   ClientCertIdentity = "uri"
+)
+
+func (i *ClientCertIdentity) UnmarshalText(text []byte) error {
+	switch ClientCertIdentity(text) {
+	case ClientCertIdentityCN, ClientCertIdentityDNS, ClientCertIdentityEmail, ClientCertIdentityURI:
+		*i = ClientCertIdentity(text)
+		return nil
+	default:
+		return fmt.Errorf("invalid identity: %s", text)
+	}
+}
+
+func (i ClientCertIdentity) String() string {
+	return string(i)
+}
+
+func (i ClientCertIdentity) isValid() bool {
+	switch i {
+	case ClientCertIdentityCN, ClientCertIdentityDNS, ClientCertIdentityEmail, ClientCertIdentityURI:
+		return true
+	default:
+		return false
+	}
+}
+
+// Identity returns the identity of the certificate, it is the subject common name
+// or the first subject alternative name of the selected type.
+func (i ClientCertIdentity) Identity(cert *x509.Certificate) string {
+	switch i {
+	case ClientCertIdentityCN:
+		return cert.Subject.CommonName
+	case ClientCertIdentityDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case ClientCertIdentityEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case ClientCertIdentityURI:
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	}
+	return ""
+}
+
+// clientCertAuth sets the request user to the identity of the verified client certificate.
+// Requests without a verified certificate are passed on to the next authentication method if any.
+func (hp *HTTPProxy) clientCertAuth(id ClientCertIdentity) martian.RequestModifier {
+	return martian.RequestModifierFunc(func(req *http.Request) error {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+			return nil
+		}
+		user := id.Identity(req.TLS.VerifiedChains[0][0])
+		if user == "" {
+			hp.metrics.clientCertAuth("failed")
+			return nil
+		}
+		hp.metrics.clientCertAuth("ok")
+		martian.SetContextUser(req.Context(), user)
+		return nil
+	})
+}
@@ -8,7 +8,9 @@ package ready
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -80,6 +82,13 @@ func (c *command) runE(cmd *cobra.Command, _ []string) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		if _, err := io.Copy(cmd.ErrOrStderr(), resp.Body); err != nil {
+			return err
+		}
+		return errors.New("not ready")
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		b, err := httputil.DumpResponse(resp, true)
 		if err != nil {
@@ -122,4 +131,5 @@ func CommandWithConfig(cfg Config) *cobra.Command {
 }
 
 const long = `Readiness probe for the Forwarder.
-This is equivalent to calling /readyz endpoint on the Forwarder API server.`
+This is equivalent to calling /readyz endpoint on the Forwarder API server.
+If the Forwarder is not ready, the failed checks are printed.`
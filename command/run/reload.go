@@ -0,0 +1,157 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package run
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/saucelabs/forwarder/log"
+)
+
+type reloadMetrics struct {
+	reloads         *prometheus.CounterVec
+	lastSuccessful  prometheus.Gauge
+	lastSuccessTime prometheus.Gauge
+}
+
+func newReloadMetrics(r prometheus.Registerer, namespace string) *reloadMetrics {
+	if r == nil {
+		r = prometheus.NewRegistry() // This registry will be discarded.
+	}
+	f := promauto.With(r)
+
+	m := &reloadMetrics{
+		reloads: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "config_reloads_total",
+			Help:      "Number of configuration reloads by result",
+		}, []string{"result"}),
+		lastSuccessful: f.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "config_last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful",
+		}),
+		lastSuccessTime: f.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "config_last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload",
+		}),
+	}
+	m.lastSuccessful.Set(1)
+	m.lastSuccessTime.SetToCurrentTime()
+
+	return m
+}
+
+func (m *reloadMetrics) success() {
+	m.reloads.WithLabelValues("success").Inc()
+	m.lastSuccessful.Set(1)
+	m.lastSuccessTime.SetToCurrentTime()
+}
+
+func (m *reloadMetrics) failure() {
+	m.reloads.WithLabelValues("failure").Inc()
+	m.lastSuccessful.Set(0)
+}
+
+// reloadResult is the result of a configuration reload attempt.
+type reloadResult struct {
+	time time.Time
+	err  error
+}
+
+// reloader reloads the configuration on SIGHUP and on POST requests to the API endpoint.
+// Reloads are serialized, if reload fails the current configuration is kept.
+type reloader struct {
+	reload  func() error
+	metrics *reloadMetrics
+	log     log.StructuredLogger
+	mu      sync.Mutex
+	last    atomic.Pointer[reloadResult]
+}
+
+func newReloader(reload func() error, r prometheus.Registerer, namespace string, log log.StructuredLogger) *reloader {
+	return &reloader{
+		reload:  reload,
+		metrics: newReloadMetrics(r, namespace),
+		log:     log,
+	}
+}
+
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.log.Info("reloading configuration")
+	start := time.Now()
+	if err := r.reload(); err != nil {
+		r.last.Store(&reloadResult{time: start, err: err})
+		r.metrics.failure()
+		r.log.Error("failed to reload configuration, keeping current configuration", "error", err)
+		return err
+	}
+	r.last.Store(&reloadResult{time: start})
+	r.metrics.success()
+	r.log.Info("configuration reloaded", "duration", time.Since(start))
+
+	return nil
+}
+
+// describeLast returns the time and the result of the last reload attempt as a comment line,
+// or nil if there was no reload.
+func (r *reloader) describeLast() []byte {
+	l := r.last.Load()
+	if l == nil {
+		return nil
+	}
+	if l.err != nil {
+		return fmt.Appendf(nil, "# last reload: %s failed: %s\n", l.time.Format(time.RFC3339), strings.ReplaceAll(l.err.Error(), "\n", " "))
+	}
+	return fmt.Appendf(nil, "# last reload: %s succeeded\n", l.time.Format(time.RFC3339))
+}
+
+func (r *reloader) Run(ctx context.Context) error {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ch:
+			r.Reload() //nolint:errcheck // error is logged
+		}
+	}
+}
+
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("OK"))
+}
@@ -0,0 +1,372 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/saucelabs/forwarder"
+	"github.com/saucelabs/forwarder/header"
+	"github.com/saucelabs/forwarder/ruleset"
+)
+
+// rules are proxy rules managed at runtime with the admin API.
+// They use the same syntax as the corresponding flags and are applied in addition to the configured rules.
+type rules struct {
+	DenyDomains     []string `json:"deny_domains"`
+	DirectDomains   []string `json:"direct_domains"`
+	MITMDomains     []string `json:"mitm_domains"`
+	RequestHeaders  []string `json:"request_headers"`
+	ResponseHeaders []string `json:"response_headers"`
+}
+
+func (r *rules) lists() []*[]string {
+	return []*[]string{
+		&r.DenyDomains,
+		&r.DirectDomains,
+		&r.MITMDomains,
+		&r.RequestHeaders,
+		&r.ResponseHeaders,
+	}
+}
+
+// normalize validates the rules and rewrites them in canonical form.
+func (r *rules) normalize() error {
+	for i, v := range r.DenyDomains {
+		d, err := ruleset.ParseRegexpListItem(v)
+		if err != nil {
+			return fmt.Errorf("deny domains: %w", err)
+		}
+		r.DenyDomains[i] = d.String()
+	}
+	for i, v := range r.DirectDomains {
+		d, err := ruleset.ParseRegexpListItem(v)
+		if err != nil {
+			return fmt.Errorf("direct domains: %w", err)
+		}
+		r.DirectDomains[i] = d.String()
+	}
+	for i, v := range r.MITMDomains {
+		d, err := ruleset.ParseRegexpListItem(v)
+		if err != nil {
+			return fmt.Errorf("mitm domains: %w", err)
+		}
+		r.MITMDomains[i] = d.String()
+	}
+	for i, v := range r.RequestHeaders {
+		h, err := header.ParseHeader(v)
+		if err != nil {
+			return fmt.Errorf("request headers: %w", err)
+		}
+		r.RequestHeaders[i] = h.String()
+	}
+	for i, v := range r.ResponseHeaders {
+		h, err := header.ParseHeader(v)
+		if err != nil {
+			return fmt.Errorf("response headers: %w", err)
+		}
+		r.ResponseHeaders[i] = h.String()
+	}
+	return nil
+}
+
+func (r *rules) clone() *rules {
+	c := new(rules)
+	for i, l := range c.lists() {
+		*l = append([]string{}, *r.lists()[i]...)
+	}
+	return c
+}
+
+func (r *rules) add(o *rules) {
+	for i, l := range r.lists() {
+		for _, v := range *o.lists()[i] {
+			if !slices.Contains(*l, v) {
+				*l = append(*l, v)
+			}
+		}
+	}
+}
+
+func (r *rules) remove(o *rules) {
+	for i, l := range r.lists() {
+		*l = slices.DeleteFunc(*l, func(v string) bool {
+			return slices.Contains(*o.lists()[i], v)
+		})
+	}
+}
+
+// applyRules sets the domain and header rules of the proxy config from the configured rules and the runtime rules r,
+// the runtime rules must be normalized. MITM domain rules are only added if MITM is enabled.
+// It does not read any files, the domain list files must be loaded by proxyPolicy.
+func (c *command) applyRules(r *rules) error {
+	var (
+		denyDomains     = slices.Clone(c.denyDomains)
+		directDomains   = slices.Clone(c.directDomains)
+		mitmDomains     = slices.Clone(c.mitmDomains)
+		requestHeaders  = slices.Clone(c.requestHeaders)
+		responseHeaders = slices.Clone(c.responseHeaders)
+	)
+	for _, v := range r.DenyDomains {
+		d, _ := ruleset.ParseRegexpListItem(v) //nolint:errcheck // rules are normalized
+		denyDomains = append(denyDomains, d)
+	}
+	for _, v := range r.DirectDomains {
+		d, _ := ruleset.ParseRegexpListItem(v) //nolint:errcheck // rules are normalized
+		directDomains = append(directDomains, d)
+	}
+	if c.mitmEnabled() {
+		for _, v := range r.MITMDomains {
+			d, _ := ruleset.ParseRegexpListItem(v) //nolint:errcheck // rules are normalized
+			mitmDomains = append(mitmDomains, d)
+		}
+	}
+	for _, v := range r.RequestHeaders {
+		h, _ := header.ParseHeader(v) //nolint:errcheck // rules are normalized
+		requestHeaders = append(requestHeaders, h)
+	}
+	for _, v := range r.ResponseHeaders {
+		h, _ := header.ParseHeader(v) //nolint:errcheck // rules are normalized
+		responseHeaders = append(responseHeaders, h)
+	}
+
+	cfg := c.httpProxyConfig
+	cfg.DenyDomains = nil
+	cfg.DirectDomains = nil
+	cfg.MITMDomains = nil
+	cfg.RequestModifiers = nil
+	cfg.ResponseModifiers = nil
+
+	if len(denyDomains) > 0 {
+		dd, err := ruleset.NewRegexpMatcherFromList(denyDomains)
+		if err != nil {
+			return fmt.Errorf("deny domains: %w", err)
+		}
+		cfg.DenyDomains = dd
+	}
+	if len(directDomains) > 0 {
+		dd, err := ruleset.NewRegexpMatcherFromList(directDomains)
+		if err != nil {
+			return fmt.Errorf("direct domains: %w", err)
+		}
+		cfg.DirectDomains = dd
+	}
+	if c.denyDomainsFileRules != nil {
+		cfg.DenyDomains = forwarder.AnyMatcher(cfg.DenyDomains, c.denyDomainsFileRules)
+	}
+	if c.directDomainsFileRules != nil {
+		cfg.DirectDomains = forwarder.AnyMatcher(cfg.DirectDomains, c.directDomainsFileRules)
+	}
+	if c.denyDomainsList != nil {
+		cfg.DenyDomains = forwarder.AnyMatcher(cfg.DenyDomains, c.denyDomainsList)
+	}
+	if c.directDomainsList != nil {
+		cfg.DirectDomains = forwarder.AnyMatcher(cfg.DirectDomains, c.directDomainsList)
+	}
+	if c.mitmEnabled() && len(mitmDomains) > 0 {
+		dd, err := ruleset.NewRegexpMatcherFromList(mitmDomains)
+		if err != nil {
+			return fmt.Errorf("mitm domains: %w", err)
+		}
+		cfg.MITMDomains = dd
+	}
+
+	c.configureHeadersModifiers(requestHeaders, responseHeaders)
+
+	return nil
+}
+
+// appliedPolicy is the proxy policy applied to the running proxy.
+// It is kept so that runtime rule changes are applied to the current configuration without reading it again.
+type appliedPolicy struct {
+	mu sync.Mutex
+	c  *command
+	pr forwarder.PACResolver
+	cm *forwarder.CredentialsMatcher
+}
+
+// applyRules applies the current policy with the runtime rules r to p.
+func (ap *appliedPolicy) applyRules(p *forwarder.HTTPProxy, r *rules) error {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	if err := ap.c.applyRules(r); err != nil {
+		return err
+	}
+	return p.Reload(ap.c.httpProxyConfig, ap.pr, ap.cm)
+}
+
+// reload applies the policy np with the runtime rules r to p, and makes it the current policy.
+// The PAC resolver of the replaced policy is closed, if applying fails the PAC resolver of np is closed instead.
+func (ap *appliedPolicy) reload(p *forwarder.HTTPProxy, np *appliedPolicy, r *rules) error {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	if err := np.c.applyRules(r); err != nil {
+		closePACResolver(np.pr)
+		return err
+	}
+	if err := p.Reload(np.c.httpProxyConfig, np.pr, np.cm); err != nil {
+		closePACResolver(np.pr)
+		return err
+	}
+	closePACResolver(ap.pr)
+	ap.c, ap.pr, ap.cm = np.c, np.pr, np.cm
+
+	return nil
+}
+
+// rulesStore holds the runtime rules and serves the admin rules endpoint.
+// Changes are applied with the apply function and saved to the file,
+// if applying or saving fails, the change is rolled back.
+type rulesStore struct {
+	rules atomic.Pointer[rules]
+	file  string
+	mitm  bool
+	apply func() error
+	mu    sync.Mutex
+}
+
+// newRulesStore creates a new rules store, if file is set and exists, the rules are loaded from it.
+func newRulesStore(file string, mitm bool) (*rulesStore, error) {
+	s := &rulesStore{
+		file: file,
+		mitm: mitm,
+	}
+
+	r := new(rules)
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, r); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		if err := r.normalize(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	s.rules.Store(r.clone())
+
+	return s, nil
+}
+
+func (s *rulesStore) get() *rules {
+	return s.rules.Load()
+}
+
+func (s *rulesStore) update(fn func(r *rules)) (*rules, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.rules.Load()
+	r := old.clone()
+	fn(r)
+	s.rules.Store(r)
+
+	if s.apply != nil {
+		if err := s.apply(); err != nil {
+			s.rules.Store(old)
+			return nil, err
+		}
+	}
+
+	if err := s.save(r); err != nil {
+		err = fmt.Errorf("save rules: %w", err)
+
+		// Roll back the applied rules, so that the running proxy matches the rules file.
+		s.rules.Store(old)
+		if s.apply != nil {
+			if aerr := s.apply(); aerr != nil {
+				err = errors.Join(err, fmt.Errorf("roll back rules: %w", aerr))
+			}
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (s *rulesStore) save(r *rules) error {
+	if s.file == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.file), filepath.Base(s.file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.file)
+}
+
+func (s *rulesStore) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		r   *rules
+		err error
+	)
+	switch req.Method {
+	case http.MethodGet:
+		r = s.get()
+	case http.MethodPost, http.MethodDelete:
+		var o rules
+		if err := json.NewDecoder(req.Body).Decode(&o); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := o.normalize(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(o.MITMDomains) > 0 && !s.mitm {
+			http.Error(w, "mitm domains: MITM is not enabled", http.StatusBadRequest)
+			return
+		}
+
+		if req.Method == http.MethodPost {
+			r, err = s.update(func(r *rules) { r.add(&o) })
+		} else {
+			r, err = s.update(func(r *rules) { r.remove(&o) })
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r) //nolint:errcheck // ignore error
+}
@@ -0,0 +1,136 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package run
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/saucelabs/forwarder/ruleset"
+)
+
+func TestRulesStoreUpdate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.json")
+
+	s, err := newRulesStore(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := &rules{
+		DenyDomains:    []string{"foo", "-bar"},
+		RequestHeaders: []string{"X-Foo: bar"},
+	}
+	if err := add.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.update(func(r *rules) { r.add(add) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.update(func(r *rules) { r.add(add) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.update(func(r *rules) { r.remove(&rules{DenyDomains: []string{"foo"}}) }); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &rules{
+		DenyDomains:     []string{"-bar"},
+		DirectDomains:   []string{},
+		MITMDomains:     []string{},
+		RequestHeaders:  []string{"X-Foo:bar"},
+		ResponseHeaders: []string{},
+	}
+	if diff := cmp.Diff(want, s.get()); diff != "" {
+		t.Fatalf("unexpected rules (-want +got):\n%s", diff)
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		s.apply = func() error { return errors.New("apply failed") }
+		defer func() { s.apply = nil }()
+
+		if _, err := s.update(func(r *rules) { r.add(&rules{DirectDomains: []string{"baz"}}) }); err == nil {
+			t.Fatal("expected error")
+		}
+		if diff := cmp.Diff(want, s.get()); diff != "" {
+			t.Fatalf("unexpected rules (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("save rollback", func(t *testing.T) {
+		s, err := newRulesStore(filepath.Join(t.TempDir(), "missing", "rules.json"), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		applied := 0
+		s.apply = func() error { applied++; return nil }
+
+		if _, err := s.update(func(r *rules) { r.add(&rules{DirectDomains: []string{"baz"}}) }); err == nil {
+			t.Fatal("expected error")
+		}
+		if len(s.get().DirectDomains) != 0 {
+			t.Fatalf("expected rules to be rolled back, got %v", s.get().DirectDomains)
+		}
+		if applied != 2 {
+			t.Fatalf("expected rules to be applied and rolled back, got %d applies", applied)
+		}
+	})
+
+	t.Run("load", func(t *testing.T) {
+		l, err := newRulesStore(file, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, l.get()); diff != "" {
+			t.Fatalf("unexpected rules (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestCommandApplyRules(t *testing.T) {
+	c := makeCommand()
+	d, err := ruleset.ParseRegexpListItem("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.denyDomains = []ruleset.RegexpListItem{d}
+
+	r := &rules{
+		DenyDomains:    []string{"bar"},
+		RequestHeaders: []string{"X-Foo: bar"},
+	}
+	if err := r.normalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.applyRules(r); err != nil {
+		t.Fatal(err)
+	}
+	cfg := c.httpProxyConfig
+	if !cfg.DenyDomains.Match("foo") || !cfg.DenyDomains.Match("bar") {
+		t.Fatal("expected configured and runtime deny domains to match")
+	}
+	if len(cfg.RequestModifiers) != 1 {
+		t.Fatalf("expected request headers modifier, got %d modifiers", len(cfg.RequestModifiers))
+	}
+
+	// Applying rules again replaces the runtime rules.
+	if err := c.applyRules(new(rules)); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.DenyDomains.Match("foo") || cfg.DenyDomains.Match("bar") {
+		t.Fatal("expected only configured deny domains to match")
+	}
+	if len(cfg.RequestModifiers) != 0 {
+		t.Fatalf("expected no request modifiers, got %d", len(cfg.RequestModifiers))
+	}
+	if len(c.denyDomains) != 1 {
+		t.Fatalf("expected configured deny domains not to change, got %v", c.denyDomains)
+	}
+}
@@ -8,28 +8,37 @@ package run
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"maps"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/saucelabs/forwarder"
+	"github.com/saucelabs/forwarder/activation"
 	"github.com/saucelabs/forwarder/bind"
 	"github.com/saucelabs/forwarder/header"
+	"github.com/saucelabs/forwarder/htpasswd"
 	"github.com/saucelabs/forwarder/httplog"
 	"github.com/saucelabs/forwarder/internal/version"
+	"github.com/saucelabs/forwarder/jwtauth"
 	"github.com/saucelabs/forwarder/log"
 	"github.com/saucelabs/forwarder/log/martianlog"
 	"github.com/saucelabs/forwarder/log/slog"
+	"github.com/saucelabs/forwarder/middleware"
 	"github.com/saucelabs/forwarder/pac"
 	"github.com/saucelabs/forwarder/ruleset"
 	"github.com/saucelabs/forwarder/runctx"
+	"github.com/saucelabs/forwarder/upgrade"
 	"github.com/saucelabs/forwarder/utils/cobrautil"
 	"github.com/saucelabs/forwarder/utils/httphandler"
 	"github.com/saucelabs/forwarder/utils/httpx"
@@ -39,27 +48,50 @@ import (
 )
 
 type command struct {
-	promReg             *prometheus.Registry
-	dnsConfig           *forwarder.DNSConfig
-	httpTransportConfig *forwarder.HTTPTransportConfig
-	kerberosConfig      *forwarder.KerberosConfig
-	connectTo           []forwarder.HostPortPair
-	pac                 *url.URL
-	credentials         []*forwarder.HostPortUser
-	denyDomains         []ruleset.RegexpListItem
-	directDomains       []ruleset.RegexpListItem
-	allowTimeFrame      []ruleset.TimeFrameEntry
-	connectHeaders      []header.Header
-	requestHeaders      []header.Header
-	responseHeaders     []header.Header
-	httpProxyConfig     *forwarder.HTTPProxyConfig
-	mitm                bool
-	mitmConfig          *forwarder.MITMConfig
-	mitmDomains         []ruleset.RegexpListItem
-	proxyProtocol       bool
-	proxyProtocolConfig *forwarder.ProxyProtocolConfig
-	apiServerConfig     *forwarder.HTTPServerConfig
-	logConfig           *log.Config
+	promReg                *prometheus.Registry
+	dnsConfig              *forwarder.DNSConfig
+	httpTransportConfig    *forwarder.HTTPTransportConfig
+	kerberosConfig         *forwarder.KerberosConfig
+	connectTo              []forwarder.HostPortPair
+	pac                    *url.URL
+	credentials            []*forwarder.HostPortUser
+	basicAuthFile          string
+	aclFile                string
+	urlRulesFile           string
+	errorPagesDir          string
+	forwardAuthConfig      *forwarder.ForwardAuthConfig
+	jwtJWKS                *url.URL
+	jwtConfig              *jwtauth.Config
+	denyDomains            []ruleset.RegexpListItem
+	directDomains          []ruleset.RegexpListItem
+	denyDomainsFile        string
+	directDomainsFile      string
+	denyDomainsURL         *url.URL
+	directDomainsURL       *url.URL
+	domainListConfig       *forwarder.DomainListConfig
+	denyDomainsList        *forwarder.DomainList
+	directDomainsList      *forwarder.DomainList
+	denyDomainsFileRules   *ruleset.DomainMatcher
+	directDomainsFileRules *ruleset.DomainMatcher
+	allowTimeFrame         []ruleset.TimeFrameEntry
+	denyDomainsTimeFrame   []forwarder.DomainTimeFrameRule
+	allowDomainsTimeFrame  []forwarder.DomainTimeFrameRule
+	timeFrameZone          *time.Location
+	connectHeaders         []header.Header
+	requestHeaders         []header.Header
+	responseHeaders        []header.Header
+	httpProxyConfig        *forwarder.HTTPProxyConfig
+	mitm                   bool
+	mitmConfig             *forwarder.MITMConfig
+	mitmDomains            []ruleset.RegexpListItem
+	proxyProtocol          bool
+	proxyProtocolConfig    *forwarder.ProxyProtocolConfig
+	apiServerConfig        *forwarder.HTTPServerConfig
+	adminBasicAuth         *url.Userinfo
+	adminRulesFile         string
+	rules                  *rulesStore
+	upgradeConfig          *upgrade.Config
+	logConfig              *log.Config
 
 	dryRun bool
 	goleak bool
@@ -92,6 +124,10 @@ func (c *command) runE(cmd *cobra.Command, _ []string) (cmdErr error) {
 
 	var ep []forwarder.APIEndpoint
 
+	var (
+		cfgz atomic.Pointer[[]byte]
+		rl   *reloader
+	)
 	{
 		var cfg []byte
 
@@ -115,15 +151,13 @@ func (c *command) runE(cmd *cobra.Command, _ []string) (cmdErr error) {
 		}.DescribeFlags(cmd.Flags())
 		logger.Debug("all configuration: " + string(cfg))
 
-		//nolint:errcheck // Plain never fails.
-		cfg, _ = cobrautil.FlagsDescriber{
-			Format:          cobrautil.Plain,
-			ShowChangedOnly: false,
-			ShowHidden:      true,
-		}.DescribeFlags(cmd.Flags())
+		cfg = describeConfig(cmd)
+		cfgz.Store(&cfg)
 		ep = append(ep, forwarder.APIEndpoint{
-			Path:    "/configz",
-			Handler: httphandler.SendFile("text/plain", cfg),
+			Path: "/configz",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				httphandler.SendFile("text/plain", append(rl.describeLast(), *cfgz.Load()...)).ServeHTTP(w, r)
+			}),
 		})
 	}
 
@@ -165,79 +199,50 @@ func (c *command) runE(cmd *cobra.Command, _ []string) (cmdErr error) {
 		c.httpTransportConfig.RedirectFunc = forwarder.DialRedirectFromHostPortPairs(c.connectTo)
 	}
 
-	var pr forwarder.PACResolver
-	if c.pac != nil {
-		// Disable metrics for receiving PAC file.
-		cfg := *c.httpTransportConfig
-		cfg.PromRegistry = nil
-		rt, err := forwarder.NewHTTPTransport(&cfg)
-		if err != nil {
-			return err
-		}
-
-		script, err := forwarder.ReadURLString(c.pac, rt)
-		if err != nil {
-			return fmt.Errorf("read PAC file: %w", err)
-		}
-		pr, err = pac.NewProxyResolverPool(&pac.ProxyResolverConfig{Script: script}, nil)
-		if err != nil {
-			return err
-		}
-		if _, err := pr.FindProxyForURL(&url.URL{Scheme: "https", Host: "saucelabs.com"}, ""); err != nil {
-			return err
-		}
-		pr = &forwarder.LoggingPACResolver{
-			Resolver: pr,
-			Logger:   logger.Named("pac"),
-		}
-
-		ep = append(ep, forwarder.APIEndpoint{
-			Path:    "/pac",
-			Handler: httphandler.SendFileString("application/x-ns-proxy-autoconfig", script),
-		})
-	}
-
-	cm, err := forwarder.NewCredentialsMatcher(c.credentials, logger.Named("credentials"))
+	c.rules, err = newRulesStore(c.adminRulesFile, c.mitmEnabled())
 	if err != nil {
-		return fmt.Errorf("credentials: %w", err)
+		return fmt.Errorf("admin rules: %w", err)
 	}
 
-	if len(c.denyDomains) > 0 {
-		dd, err := ruleset.NewRegexpMatcherFromList(c.denyDomains)
-		if err != nil {
-			return fmt.Errorf("deny domains: %w", err)
-		}
-		c.httpProxyConfig.DenyDomains = dd
+	if err := c.loadDomainLists(logger); err != nil {
+		return err
 	}
-
-	if len(c.directDomains) > 0 {
-		dd, err := ruleset.NewRegexpMatcherFromList(c.directDomains)
-		if err != nil {
-			return fmt.Errorf("direct domains: %w", err)
-		}
-		c.httpProxyConfig.DirectDomains = dd
+	if err := c.loadForwardAuthTransport(); err != nil {
+		return err
 	}
 
-	c.configureHeadersModifiers()
-
-	if c.mitm || c.mitmConfig.CACertFile != "" || len(c.mitmDomains) > 0 {
-		c.httpProxyConfig.MITM = c.mitmConfig
-
-		if len(c.mitmDomains) > 0 {
-			dd, err := ruleset.NewRegexpMatcherFromList(c.mitmDomains)
-			if err != nil {
-				return fmt.Errorf("mitm domains: %w", err)
-			}
-			c.httpProxyConfig.MITMDomains = dd
-		}
+	var pacz atomic.Pointer[string]
+	pr, script, cm, err := c.proxyPolicy(logger)
+	if err != nil {
+		return err
+	}
+	if err := c.applyRules(c.rules.get()); err != nil {
+		return err
+	}
+	policy := &appliedPolicy{c: c, pr: pr, cm: cm}
+	if pr != nil {
+		pacz.Store(&script)
+		ep = append(ep, forwarder.APIEndpoint{
+			Path: "/pac",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				httphandler.SendFileString("application/x-ns-proxy-autoconfig", *pacz.Load()).ServeHTTP(w, r)
+			}),
+		})
 	}
-
-	c.httpProxyConfig.AllowTimeFrame = c.allowTimeFrame
 
 	if c.proxyProtocol {
 		c.httpProxyConfig.ProxyProtocolConfig = c.proxyProtocolConfig
 	}
 
+	if err := c.inheritListeners(logger); err != nil {
+		return fmt.Errorf("socket activation: %w", err)
+	}
+
+	var (
+		sockets []upgrade.Socket
+		checks  forwarder.ReadinessChecks
+	)
+
 	g := runctx.NewGroup()
 	{
 		rt, err := forwarder.NewHTTPTransport(c.httpTransportConfig)
@@ -254,6 +259,81 @@ func (c *command) runE(cmd *cobra.Command, _ []string) (cmdErr error) {
 		defer p.Close()
 		g.Add(p.Run)
 
+		rl = newReloader(func() error {
+			return c.reloadProxy(cmd, p, policy, logger, &cfgz, &pacz)
+		}, c.promReg, c.httpProxyConfig.PromNamespace, logger.Named("reload"))
+		g.Add(rl.Run)
+		for _, l := range []*forwarder.DomainList{c.denyDomainsList, c.directDomainsList} {
+			if l != nil {
+				g.Add(l.Run)
+			}
+		}
+		checks = append(checks, p.ReadinessChecks()...)
+
+		c.rules.apply = func() error {
+			return policy.applyRules(p, c.rules.get())
+		}
+		if u := c.adminBasicAuth; u != nil {
+			pass, _ := u.Password()
+			ba := middleware.NewBasicAuth()
+			ep = append(ep,
+				forwarder.APIEndpoint{
+					Path:    "/admin/reload",
+					Handler: ba.Wrap(rl, u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/drain",
+					Handler: ba.Wrap(p.DrainHandler(), u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/rules",
+					Handler: ba.Wrap(c.rules, u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/connz",
+					Handler: ba.Wrap(p.ConnzHandler(), u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/connz/close",
+					Handler: ba.Wrap(p.CloseConnHandler(), u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/lockoutz",
+					Handler: ba.Wrap(p.LockoutzHandler(), u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/lockoutz/clear",
+					Handler: ba.Wrap(p.ClearLockoutHandler(), u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/bandwidthz",
+					Handler: ba.Wrap(p.BandwidthzHandler(), u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/bandwidth",
+					Handler: ba.Wrap(p.SetBandwidthHandler(), u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/netemz",
+					Handler: ba.Wrap(p.NetemzHandler(), u.Username(), pass),
+				},
+				forwarder.APIEndpoint{
+					Path:    "/admin/netem",
+					Handler: ba.Wrap(p.SetNetworkProfileHandler(), u.Username(), pass),
+				},
+			)
+		}
+
+		for i, l := range p.Listeners() {
+			name := proxySocketName
+			if i > 0 {
+				name = c.httpProxyConfig.ExtraListeners[i-1].Name
+			}
+			if fl, ok := l.(upgrade.FileListener); ok {
+				sockets = append(sockets, upgrade.Socket{Name: name, Listener: fl})
+			}
+		}
+
 		if ca := p.MITMCACert(); ca != nil {
 			ep = append(ep, forwarder.APIEndpoint{
 				Path:    "/cacert",
@@ -282,7 +362,7 @@ func (c *command) runE(cmd *cobra.Command, _ []string) (cmdErr error) {
 				Handler: httphandler.Version(version.Version, version.Time, version.Commit),
 			},
 		}, ep...)
-		h := forwarder.NewAPIHandler("Forwarder "+version.Version, c.promReg, nil, ep...)
+		h := forwarder.NewAPIHandlerWithReadiness("Forwarder "+version.Version, c.promReg, checks.Ready, ep...)
 
 		if os.Getenv("PLATFORM") == "container" {
 			g.Add(func(ctx context.Context) error {
@@ -291,16 +371,30 @@ func (c *command) runE(cmd *cobra.Command, _ []string) (cmdErr error) {
 			})
 		}
 
-		if c.apiServerConfig.Address != "" {
+		if c.apiServerConfig.Address != "" || c.apiServerConfig.Inherited != nil {
 			a, err := forwarder.NewHTTPServer(c.apiServerConfig, h, logger.Named("api"))
 			if err != nil {
 				return err
 			}
 			defer a.Close()
 			g.Add(a.Run)
+
+			if fl, ok := a.Listener().(upgrade.FileListener); ok {
+				sockets = append(sockets, upgrade.Socket{Name: apiSocketName, Listener: fl})
+			}
 		}
 	}
 
+	{
+		u := upgrade.New(c.upgradeConfig, sockets, logger.Named("upgrade"))
+		g.Add(u.Run)
+		// Report readiness to the parent process if started by an upgrade,
+		// once the listeners are serving and the readiness checks pass.
+		g.Add(func(ctx context.Context) error {
+			return u.ReportReady(ctx, checks.Ready)
+		})
+	}
+
 	if c.goleak {
 		defer func() {
 			if err := goleak.Find(); err != nil {
@@ -314,13 +408,350 @@ func (c *command) runE(cmd *cobra.Command, _ []string) (cmdErr error) {
 		return nil
 	}
 
-	return g.Run()
+	if err := g.Run(); !errors.Is(err, upgrade.ErrUpgraded) {
+		return err
+	}
+	return nil
+}
+
+// Names of the sockets passed by the service manager, see FileDescriptorName= in systemd.socket(5).
+// Extra proxy listeners are matched by the listener name.
+const (
+	proxySocketName = "proxy"
+	apiSocketName   = "api"
+)
+
+// inheritListeners assigns sockets passed by the service manager to the proxy and API server listeners.
+// A single unnamed socket is used as the proxy listener.
+func (c *command) inheritListeners(logger log.StructuredLogger) error {
+	ll, err := activation.ListenersWithNames()
+	if err != nil {
+		return err
+	}
+	if len(ll) == 0 {
+		return nil
+	}
+
+	if l := ll[activation.UnnamedSocket]; len(l) == 1 && len(ll) == 1 {
+		ll = map[string][]net.Listener{proxySocketName: l}
+	}
+
+	take := func(name string) net.Listener {
+		l := ll[name]
+		if len(l) == 0 {
+			return nil
+		}
+		ll[name] = l[1:]
+
+		logger.Info("using inherited socket", "name", name, "address", l[0].Addr().String())
+		return l[0]
+	}
+
+	c.httpProxyConfig.Inherited = take(proxySocketName)
+	for i := range c.httpProxyConfig.ExtraListeners {
+		lc := &c.httpProxyConfig.ExtraListeners[i]
+		lc.Inherited = take(lc.Name)
+	}
+	c.apiServerConfig.Inherited = take(apiSocketName)
+
+	for name, l := range ll {
+		for _, l := range l {
+			logger.Info("closing unused inherited socket", "name", name, "address", l.Addr().String())
+			l.Close()
+		}
+	}
+
+	return nil
+}
+
+// proxyPolicy builds the parts of the proxy configuration that can be changed at runtime.
+// It returns the PAC resolver and script if PAC is configured.
+func (c *command) proxyPolicy(logger *slog.Logger) (pr forwarder.PACResolver, script string, cm *forwarder.CredentialsMatcher, err error) {
+	cm, err = forwarder.NewCredentialsMatcher(c.credentials, logger.Named("credentials"))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("credentials: %w", err)
+	}
+
+	if c.denyDomainsFile != "" {
+		dd, err := ruleset.ReadDomainListFile(c.denyDomainsFile)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("deny domains file: %w", err)
+		}
+		logger.Info("loaded deny domains file", "file", c.denyDomainsFile, "rules", dd.Len())
+		c.denyDomainsFileRules = dd
+	}
+
+	if c.directDomainsFile != "" {
+		dd, err := ruleset.ReadDomainListFile(c.directDomainsFile)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("direct domains file: %w", err)
+		}
+		logger.Info("loaded direct domains file", "file", c.directDomainsFile, "rules", dd.Len())
+		c.directDomainsFileRules = dd
+	}
+
+	if c.mitmEnabled() {
+		c.httpProxyConfig.MITM = c.mitmConfig
+	}
+
+	c.httpProxyConfig.AllowTimeFrame = ruleset.InLocation(c.allowTimeFrame, c.timeFrameZone)
+	c.httpProxyConfig.DenyDomainsTimeFrame = forwarder.DomainTimeFrameRulesInLocation(c.denyDomainsTimeFrame, c.timeFrameZone)
+	c.httpProxyConfig.AllowDomainsTimeFrame = forwarder.DomainTimeFrameRulesInLocation(c.allowDomainsTimeFrame, c.timeFrameZone)
+
+	if c.basicAuthFile != "" {
+		users, err := htpasswd.Open(c.basicAuthFile)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("basic auth file: %w", err)
+		}
+		hlog := logger.Named("htpasswd")
+		users.OnReload = func(f *htpasswd.File, err error) {
+			if err != nil {
+				hlog.Error("failed to reload basic auth file, keeping current users", "file", c.basicAuthFile, "error", err)
+				return
+			}
+			hlog.Info("reloaded basic auth file", "file", c.basicAuthFile, "users", f.Len())
+		}
+		c.httpProxyConfig.BasicAuthUsers = users
+	}
+
+	if c.jwtJWKS != nil {
+		rt, err := c.serviceTransport()
+		if err != nil {
+			return nil, "", nil, err
+		}
+		keys, err := jwtauth.NewKeys(func() ([]byte, error) {
+			return forwarder.ReadURL(c.jwtJWKS, rt)
+		})
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("read JWKS: %w", err)
+		}
+		jlog := logger.Named("jwt")
+		keys.OnReload = func(ks *jwtauth.KeySet, err error) {
+			if err != nil {
+				jlog.Error("failed to reload JWKS, keeping current keys", "jwks", c.jwtJWKS.Redacted(), "error", err)
+				return
+			}
+			jlog.Info("reloaded JWKS", "jwks", c.jwtJWKS.Redacted(), "keys", ks.Len())
+		}
+		v, err := jwtauth.NewValidator(c.jwtConfig, keys)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("jwt: %w", err)
+		}
+		c.httpProxyConfig.BearerAuth = v
+	}
+
+	if c.aclFile != "" {
+		acl, err := forwarder.ReadACLFile(c.aclFile)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("acl file: %w", err)
+		}
+		acl.SetDefaultLocation(c.timeFrameZone)
+		c.httpProxyConfig.ACL = acl
+	}
+
+	if c.urlRulesFile != "" {
+		ur, err := forwarder.ReadURLRulesFile(c.urlRulesFile)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("url rules file: %w", err)
+		}
+		c.httpProxyConfig.URLRules = ur
+	}
+
+	if c.errorPagesDir != "" {
+		ep, err := forwarder.ReadErrorPagesDir(c.errorPagesDir)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error pages dir: %w", err)
+		}
+		logger.Info("loaded error pages", "dir", c.errorPagesDir, "templates", ep.Len())
+		c.httpProxyConfig.ErrorPages = ep
+	}
+
+	if c.forwardAuthConfig.URL != nil {
+		c.httpProxyConfig.ForwardAuth = c.forwardAuthConfig
+	}
+
+	// The PAC resolver is created last, so that it does not need to be closed on errors above.
+	if c.pac != nil {
+		rt, err := c.serviceTransport()
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		script, err = forwarder.ReadURLString(c.pac, rt)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("read PAC file: %w", err)
+		}
+		pr, err = pac.NewProxyResolverPool(&pac.ProxyResolverConfig{Script: script}, nil)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if _, err := pr.FindProxyForURL(&url.URL{Scheme: "https", Host: "saucelabs.com"}, ""); err != nil {
+			closePACResolver(pr)
+			return nil, "", nil, err
+		}
+		pr = &forwarder.LoggingPACResolver{
+			Resolver: pr,
+			Logger:   logger.Named("pac"),
+		}
+	}
+
+	return pr, script, cm, nil
+}
+
+// closePACResolver releases the resources held by pr if it has any.
+func closePACResolver(pr forwarder.PACResolver) {
+	if c, ok := pr.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+func (c *command) mitmEnabled() bool {
+	return c.mitm || c.mitmConfig.CACertFile != "" || len(c.mitmDomains) > 0
+}
+
+// serviceTransport returns a transport for the services the proxy calls on its own, i.e. PAC, JWKS, forward auth and domain lists.
+// It uses the transport configuration with metrics and the dial deny and allow networks disabled,
+// as those services usually run on localhost or in a private network.
+func (c *command) serviceTransport() (*http.Transport, error) {
+	cfg := *c.httpTransportConfig
+	cfg.PromRegistry = nil
+	cfg.DenyNetworks = nil
+	cfg.AllowNetworks = nil
+	return forwarder.NewHTTPTransport(&cfg)
+}
+
+// loadForwardAuthTransport creates the transport for calling the forward auth service,
+// it is kept across configuration reloads.
+func (c *command) loadForwardAuthTransport() error {
+	if c.forwardAuthConfig.URL == nil {
+		return nil
+	}
+	rt, err := c.serviceTransport()
+	if err != nil {
+		return err
+	}
+	c.forwardAuthConfig.Transport = rt
+	return nil
+}
+
+// loadDomainLists fetches the domain lists configured with URLs.
+// The lists are refreshed in the background, they are kept across configuration reloads.
+// The lists are fetched directly, the upstream proxy and PAC are not used.
+func (c *command) loadDomainLists(logger *slog.Logger) error {
+	if c.denyDomainsURL == nil && c.directDomainsURL == nil {
+		return nil
+	}
+
+	rt, err := c.serviceTransport()
+	if err != nil {
+		return err
+	}
+
+	if c.denyDomainsURL != nil {
+		c.denyDomainsList, err = forwarder.NewDomainList("deny", c.denyDomainsURL, c.domainListConfig, rt, logger.Named("domains"))
+		if err != nil {
+			return err
+		}
+	}
+	if c.directDomainsURL != nil {
+		c.directDomainsList, err = forwarder.NewDomainList("direct", c.directDomainsURL, c.domainListConfig, rt, logger.Named("domains"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (c *command) configureHeadersModifiers() {
-	if len(c.connectHeaders) > 0 || len(c.requestHeaders) > 0 {
+// reloadProxy reads the configuration again and applies the proxy policy to p.
+// The listeners, TLS, MITM CA, transport, API server and domain list URL settings are not changed.
+func (c *command) reloadProxy(cmd *cobra.Command, p *forwarder.HTTPProxy, policy *appliedPolicy, logger *slog.Logger,
+	cfgz *atomic.Pointer[[]byte], pacz *atomic.Pointer[string],
+) error {
+	nc, ncmd, err := parseConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	nc.denyDomainsList = c.denyDomainsList
+	nc.directDomainsList = c.directDomainsList
+	nc.forwardAuthConfig.Transport = c.forwardAuthConfig.Transport
+	pr, script, cm, err := nc.proxyPolicy(logger)
+	if err != nil {
+		return err
+	}
+	if err := policy.reload(p, &appliedPolicy{c: nc, pr: pr, cm: cm}, c.rules.get()); err != nil {
+		return err
+	}
+
+	cfg := describeConfig(ncmd)
+	cfgz.Store(&cfg)
+	pacz.Store(&script)
+
+	return nil
+}
+
+// parseConfig parses the command line arguments, environment variables and config file into a new command.
+// It only parses the configuration, the command is not set up, in particular the log file is not opened,
+// the logger is not reloaded.
+func parseConfig(cmd *cobra.Command) (*command, *cobra.Command, error) {
+	_, args, err := cmd.Root().Find(os.Args[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := makeCommand()
+	ncmd := newCommand(&c)
+	ncmd.Flags().Lookup("log-file").Value = new(pathValue)
+	ncmd.Flags().AddFlagSet(cmd.InheritedFlags())
+	ncmd.SetOut(cmd.OutOrStdout())
+	ncmd.SetErr(cmd.ErrOrStderr())
+
+	if err := ncmd.ParseFlags(args); err != nil {
+		return nil, nil, err
+	}
+	if r := cmd.Root(); r.PersistentPreRunE != nil {
+		if err := r.PersistentPreRunE(ncmd, ncmd.Flags().Args()); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := ncmd.ValidateFlagGroups(); err != nil {
+		return nil, nil, err
+	}
+
+	return &c, ncmd, nil
+}
+
+// pathValue is a flag value that keeps a file path without opening the file.
+type pathValue string
+
+func (v *pathValue) String() string {
+	return string(*v)
+}
+
+func (v *pathValue) Set(s string) error {
+	*v = pathValue(s)
+	return nil
+}
+
+func (v *pathValue) Type() string {
+	return "string"
+}
+
+func describeConfig(cmd *cobra.Command) []byte {
+	//nolint:errcheck // Plain never fails.
+	cfg, _ := cobrautil.FlagsDescriber{
+		Format:          cobrautil.Plain,
+		ShowChangedOnly: false,
+		ShowHidden:      true,
+	}.DescribeFlags(cmd.Flags())
+	return cfg
+}
+
+func (c *command) configureHeadersModifiers(requestHeaders, responseHeaders []header.Header) {
+	if len(c.connectHeaders) > 0 || len(requestHeaders) > 0 {
 		connectHeaders := header.Headers(c.connectHeaders)
-		requestHeaders := header.Headers(c.requestHeaders)
+		requestHeaders := header.Headers(requestHeaders)
 		m := forwarder.RequestModifierFunc(func(req *http.Request) error {
 			if req.Method == http.MethodConnect {
 				return connectHeaders.ModifyRequest(req)
@@ -329,8 +760,8 @@ func (c *command) configureHeadersModifiers() {
 		})
 		c.httpProxyConfig.RequestModifiers = append(c.httpProxyConfig.RequestModifiers, m)
 	}
-	if len(c.responseHeaders) > 0 {
-		headers := header.Headers(c.responseHeaders)
+	if len(responseHeaders) > 0 {
+		headers := header.Headers(responseHeaders)
 		m := forwarder.ResponseModifierFunc(func(resp *http.Response) error {
 			if req := resp.Request; req != nil && req.Method == http.MethodConnect {
 				return nil
@@ -449,7 +880,10 @@ const promNs = "forwarder"
 
 func Command() *cobra.Command {
 	c := makeCommand()
+	return newCommand(&c)
+}
 
+func newCommand(c *command) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "run [--address <host:port>] [--pac <path or url>] [--credentials <username:password@host:port>]...",
 		Short:   "Start HTTP (forward) proxy server",
@@ -462,12 +896,26 @@ func Command() *cobra.Command {
 	bind.DNSConfig(fs, c.dnsConfig)
 	bind.KerberosConfig(fs, c.kerberosConfig)
 	bind.HTTPTransportConfig(fs, c.httpTransportConfig)
+	bind.DialNetworks(fs, &c.httpTransportConfig.DialConfig, "http")
 	bind.ConnectTo(fs, &c.connectTo)
 	bind.PAC(fs, &c.pac)
 	bind.Credentials(fs, &c.credentials)
+	bind.BasicAuthFile(fs, &c.basicAuthFile)
+	bind.ACLFile(fs, &c.aclFile)
+	bind.URLRulesFile(fs, &c.urlRulesFile)
+	bind.ErrorPagesDir(fs, &c.errorPagesDir)
+	bind.ForwardAuthConfig(fs, c.forwardAuthConfig)
+	bind.JWTAuth(fs, &c.jwtJWKS, c.jwtConfig)
+	bind.AuthLockoutConfig(fs, &c.httpProxyConfig.AuthLockout)
+	bind.LoadSheddingConfig(fs, &c.httpProxyConfig.LoadShedding)
 	bind.DenyDomains(fs, &c.denyDomains)
 	bind.DirectDomains(fs, &c.directDomains)
+	bind.DenyDomainsFile(fs, &c.denyDomainsFile)
+	bind.DirectDomainsFile(fs, &c.directDomainsFile)
+	bind.DomainListURLs(fs, &c.denyDomainsURL, &c.directDomainsURL, c.domainListConfig)
 	bind.AllowTimeFrame(fs, &c.allowTimeFrame)
+	bind.DomainTimeFrames(fs, &c.denyDomainsTimeFrame, &c.allowDomainsTimeFrame)
+	bind.TimeFrameZone(fs, &c.timeFrameZone)
 	bind.ConnectHeaders(fs, &c.connectHeaders)
 	bind.RequestHeaders(fs, &c.requestHeaders)
 	bind.ResponseHeaders(fs, &c.responseHeaders)
@@ -476,6 +924,7 @@ func Command() *cobra.Command {
 	bind.MITMDomains(fs, &c.mitmDomains)
 	bind.ProxyProtocol(fs, &c.proxyProtocol, c.proxyProtocolConfig)
 	bind.HTTPServerConfig(fs, c.apiServerConfig, "api", forwarder.HTTPScheme)
+	bind.AdminAPI(fs, &c.adminBasicAuth, &c.adminRulesFile)
 	bind.HTTPLogConfig(fs, []bind.NamedParam[httplog.Mode]{
 		{Name: "api", Param: &c.apiServerConfig.LogHTTPMode},
 		{Name: "proxy", Param: &c.httpProxyConfig.LogHTTPMode},
@@ -487,6 +936,7 @@ func Command() *cobra.Command {
 
 	bind.AutoMarkFlagFilename(cmd)
 	cmd.MarkFlagsMutuallyExclusive("proxy", "pac")
+	cmd.MarkFlagsMutuallyExclusive("basic-auth", "basic-auth-file")
 
 	cmd.MarkFlagsRequiredTogether("kerberos-cfg-file", "kerberos-keytab-file", "kerberos-user-name", "kerberos-user-realm")
 
@@ -531,13 +981,19 @@ func makeCommand() command {
 		httpProxyConfig:     forwarder.DefaultHTTPProxyConfig(),
 		mitmConfig:          forwarder.DefaultMITMConfig(),
 		proxyProtocolConfig: forwarder.DefaultProxyProtocolConfig(),
+		forwardAuthConfig:   forwarder.DefaultForwardAuthConfig(),
+		jwtConfig:           jwtauth.DefaultConfig(),
+		domainListConfig:    forwarder.DefaultDomainListConfig(),
 		apiServerConfig:     forwarder.DefaultHTTPServerConfig(),
+		upgradeConfig:       upgrade.DefaultConfig(),
 		logConfig:           log.DefaultConfig(),
 	}
 	c.httpTransportConfig.PromRegistry = c.promReg
 	c.httpTransportConfig.PromNamespace = promNs
 	c.httpProxyConfig.PromRegistry = c.promReg
 	c.httpProxyConfig.PromNamespace = promNs
+	c.domainListConfig.PromRegistry = c.promReg
+	c.domainListConfig.PromNamespace = promNs
 	c.apiServerConfig.Address = "localhost:10000"
 
 	return c
@@ -547,6 +1003,20 @@ const long = `Start HTTP (forward) proxy server.
 You can start HTTP or HTTPS server.
 If you start an HTTPS server and you don't provide a certificate, the server will generate a self-signed certificate on startup.
 The server may be protected by basic authentication.
+The server supports systemd socket activation, sockets named "proxy" and "api" are used for the proxy and API server respectively.
+On SIGHUP, or POST request to the /admin/reload API endpoint if --api-admin-basic-auth is set, the server reloads the configuration from the command line, environment variables and config file.
+Only the proxy policy is reloaded: upstream proxy, PAC, credentials, basic auth, user ACL, forward auth, domain and URL rules, headers, time frames and HTTP logging, other settings require a restart.
+If the new configuration is invalid, the server continues with the current configuration, the time and the result of the last reload are shown in the /configz API endpoint.
+If --api-admin-basic-auth is set, the /admin/connz API endpoint lists client connections and tunnels, bytes received and sent are listed if --track-traffic is set,
+the /admin/bandwidthz and /admin/netemz API endpoints list bandwidth limits and network profiles,
+domain and header rules can be listed, added and removed at runtime with GET, POST and DELETE requests to the /admin/rules API endpoint,
+a client connection can be closed with a POST request to the /admin/connz/close?id=<id> API endpoint,
+the /admin/lockoutz API endpoint lists client IPs and users with failed proxy authentications, see --auth-lockout-max-failures,
+and an auth lockout can be cleared with a POST request to the /admin/lockoutz/clear?ip=<ip> or ?user=<user> API endpoint.
+The /readyz API endpoint reports ready once the proxy accepts connections and the upstream proxy, if set, is reachable, the result of the upstream check is cached for 5 seconds. The PAC is loaded before the proxy starts.
+If --api-admin-basic-auth is set, a POST request to the /admin/drain API endpoint makes the server not ready and stops accepting new connections, existing connections are served until they are closed.
+On SIGUSR2 the server starts a new process of the same executable, hands over the listening sockets, waits until the new process accepts connections and its readiness checks pass, and then drains existing connections before exiting.
+If the new process is not ready within a minute, it exits and the server continues to serve.
 `
 
 const example = `  # HTTP proxy with upstream proxy
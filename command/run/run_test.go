@@ -0,0 +1,116 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package run
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/forwarder"
+	"github.com/saucelabs/forwarder/log"
+	"github.com/spf13/cobra"
+)
+
+func TestServiceTransportIgnoresDenyNetworks(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	c := makeCommand()
+	loopback, err := forwarder.ParseIPNetwork("loopback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.httpTransportConfig.DenyNetworks = []forwarder.IPNetwork{loopback}
+
+	rt, err := c.serviceTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, s.URL, http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("expected service transport to connect to loopback, got %v", err)
+	}
+	res.Body.Close()
+
+	if len(c.httpTransportConfig.DenyNetworks) != 1 {
+		t.Fatal("expected proxy transport config not to change")
+	}
+}
+
+func TestParseConfigDoesNotOpenLogFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "log")
+	logFile := filepath.Join(dir, "forwarder.log")
+
+	args := os.Args
+	os.Args = []string{"forwarder", "run", "--log-file", logFile, "--proxy-localhost", "allow"}
+	defer func() { os.Args = args }()
+
+	root := &cobra.Command{Use: "forwarder"}
+	cmd := Command()
+	root.AddCommand(cmd)
+
+	c, ncmd, err := parseConfig(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.httpProxyConfig.ProxyLocalhost != forwarder.AllowProxyLocalhost {
+		t.Fatalf("expected proxy localhost to be parsed, got %s", c.httpProxyConfig.ProxyLocalhost)
+	}
+	if c.logConfig.File != nil {
+		t.Fatal("expected log file not to be opened")
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected log dir not to be created, got %v", err)
+	}
+	if !strings.Contains(string(describeConfig(ncmd)), "log-file="+logFile) {
+		t.Fatal("expected log file path in config")
+	}
+}
+
+func TestReloaderDescribeLast(t *testing.T) {
+	fail := true
+	rl := newReloader(func() error {
+		if fail {
+			return errors.New("invalid\nconfig")
+		}
+		return nil
+	}, nil, "", log.NopLogger)
+
+	if b := rl.describeLast(); b != nil {
+		t.Fatalf("expected no reload, got %q", b)
+	}
+
+	rl.Reload() //nolint:errcheck // error is checked in describeLast
+	b := string(rl.describeLast())
+	if !strings.HasPrefix(b, "# last reload: ") || !strings.HasSuffix(b, " failed: invalid config\n") {
+		t.Fatalf("unexpected result: %q", b)
+	}
+	ts := strings.Fields(b)[3]
+	if _, err := time.Parse(time.RFC3339, ts); err != nil {
+		t.Fatal(err)
+	}
+
+	fail = false
+	if err := rl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if b := string(rl.describeLast()); !strings.HasSuffix(b, " succeeded\n") {
+		t.Fatalf("unexpected result: %q", b)
+	}
+}
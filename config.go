@@ -192,6 +192,27 @@ func ParseDNSAddress(val string) (netip.AddrPort, error) {
 	return ap, nil
 }
 
+// ParseCIDR parses a network in CIDR notation, a single IP address is treated as a /32 or /128 network.
+func ParseCIDR(val string) (netip.Prefix, error) {
+	if !strings.Contains(val, "/") {
+		a, err := netip.ParseAddr(val)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		a = a.Unmap()
+		return netip.PrefixFrom(a, a.BitLen()), nil
+	}
+
+	p, err := netip.ParsePrefix(val)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked(), nil
+}
+
 func validateDNSAddress(p netip.AddrPort) error {
 	if !p.IsValid() {
 		return fmt.Errorf("IP: %s", p.Addr())
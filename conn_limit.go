@@ -0,0 +1,189 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// OverloadResponse specifies how connections over the listener limits are rejected.
+type OverloadResponse string
+
+const (
+	// OverloadClose closes the connection right away.
+	OverloadClose OverloadResponse = "close"
+	// OverloadServiceUnavailable writes 503 Service Unavailable response before closing the connection.
+	// TLS connections are closed right away.
+	OverloadServiceUnavailable OverloadResponse = "503"
+)
+
+func (r *OverloadResponse) UnmarshalText(text []byte) error {
+	switch OverloadResponse(text) {
+	case OverloadClose, OverloadServiceUnavailable:
+		*r = OverloadResponse(text)
+		return nil
+	default:
+		return fmt.Errorf("invalid overload response: %s", text)
+	}
+}
+
+func (r OverloadResponse) String() string {
+	return string(r)
+}
+
+// Connection shedding reasons.
+const (
+	shedMaxConns          = "max_conns"
+	shedMaxConnsPerClient = "max_conns_per_client"
+)
+
+var errClientConnLimit = errors.New("too many connections from client IP")
+
+const (
+	overloadedResponse = "HTTP/1.1 503 Service Unavailable\r\n" +
+		"Connection: close\r\n" +
+		"Content-Length: 0\r\n" +
+		"Retry-After: 1\r\n" +
+		"\r\n"
+
+	// shedTimeout is the maximum time spent on writing the 503 response and waiting for the client to close the connection.
+	shedTimeout = time.Second
+
+	// maxShedWriters is the maximum number of connections per listener rejected with 503 response at the same time,
+	// connections over the limit are closed right away, so that a connection flood does not pile up goroutines and file descriptors.
+	maxShedWriters = 128
+)
+
+// shed rejects the connection according to OverloadResponse.
+// If async is true, the 503 response is written in a new goroutine.
+func (l *Listener) shed(conn net.Conn, reason string, async bool) {
+	l.metrics.shed(reason)
+
+	if l.OverloadResponse != OverloadServiceUnavailable || l.TLSConfig != nil {
+		conn.Close()
+		return
+	}
+	if l.shedWriters.Add(1) > maxShedWriters {
+		l.shedWriters.Add(-1)
+		conn.Close()
+		return
+	}
+
+	if async {
+		go l.writeOverloaded(conn)
+	} else {
+		l.writeOverloaded(conn)
+	}
+}
+
+// writeOverloaded writes the 503 response and closes the connection.
+// The response is written before the request is read, the client request is drained after that,
+// so that closing the connection does not reset it before the client reads the response.
+func (l *Listener) writeOverloaded(conn net.Conn) {
+	defer l.shedWriters.Add(-1)
+
+	conn.SetDeadline(time.Now().Add(shedTimeout))
+	if _, err := io.WriteString(conn, overloadedResponse); err == nil {
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+		io.Copy(io.Discard, conn) //nolint:errcheck // best effort
+	}
+	conn.Close()
+}
+
+// clientConns counts open connections per client IP.
+type clientConns struct {
+	max int
+
+	mu sync.Mutex
+	m  map[netip.Addr]int
+}
+
+func newClientConns(maxConns int) *clientConns {
+	return &clientConns{
+		max: maxConns,
+		m:   make(map[netip.Addr]int),
+	}
+}
+
+func (c *clientConns) acquire(ip netip.Addr) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.m[ip] >= c.max {
+		return false
+	}
+	c.m[ip]++
+	return true
+}
+
+func (c *clientConns) release(ip netip.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.m[ip] <= 1 {
+		delete(c.m, ip)
+	} else {
+		c.m[ip]--
+	}
+}
+
+// clientLimitConn counts the connection against the per-client limit on first read,
+// so that Accept does not block on reading the proxy protocol header.
+type clientLimitConn struct {
+	net.Conn
+
+	l         *Listener
+	checkOnce sync.Once
+	ip        netip.Addr
+	acquired  bool
+	err       error
+	closeOnce sync.Once
+}
+
+func (c *clientLimitConn) Read(b []byte) (int, error) {
+	if err := c.check(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *clientLimitConn) check() error {
+	c.checkOnce.Do(func() {
+		ip, ok := addrIP(c.Conn.RemoteAddr())
+		if !ok {
+			return
+		}
+		if !c.l.clients.acquire(ip) {
+			c.err = fmt.Errorf("%w: %s", errClientConnLimit, ip)
+			c.l.shed(c.Conn, shedMaxConnsPerClient, false)
+			return
+		}
+		c.ip = ip
+		c.acquired = true
+	})
+	return c.err
+}
+
+func (c *clientLimitConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		// Make sure the connection is not counted after close.
+		c.checkOnce.Do(func() {})
+		if c.acquired {
+			c.l.clients.release(c.ip)
+		}
+	})
+	return err
+}
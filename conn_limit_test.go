@@ -0,0 +1,163 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestListenerConnLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ListenerConfig
+	}{
+		{
+			name:   "max conns",
+			config: ListenerConfig{MaxConns: 1},
+		},
+		{
+			name:   "max conns per client",
+			config: ListenerConfig{MaxConnsPerClient: 1},
+		},
+	}
+
+	dial := func(t *testing.T, l *Listener) net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("net.Dial(): got %v, want no error", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+
+	echo := func(t *testing.T, conn net.Conn) {
+		t.Helper()
+		if _, err := io.WriteString(conn, "x"); err != nil {
+			t.Fatalf("conn.Write(): got %v, want no error", err)
+		}
+		if _, err := conn.Read(make([]byte, 1)); err != nil {
+			t.Fatalf("conn.Read(): got %v, want no error", err)
+		}
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := Listener{
+				ListenerConfig: tc.config,
+			}
+			l.Address = testListenerConfig.Address
+			l.OverloadResponse = OverloadServiceUnavailable
+			defer l.Close()
+
+			l.listenAndWait(t)
+			go l.acceptAndCopy()
+
+			c1 := dial(t, &l)
+			defer c1.Close()
+			echo(t, c1)
+
+			c2 := dial(t, &l)
+			defer c2.Close()
+			res, err := http.ReadResponse(bufio.NewReader(c2), nil)
+			if err != nil {
+				t.Fatalf("http.ReadResponse(): got %v, want no error", err)
+			}
+			if res.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusServiceUnavailable)
+			}
+			if ra := res.Header.Get("Retry-After"); ra != "1" {
+				t.Fatalf("got Retry-After %q, want 1", ra)
+			}
+
+			c2.Close()
+			c1.Close()
+			deadline := time.Now().Add(5 * time.Second)
+			released := func() bool {
+				if l.conns.Load() > 0 {
+					return false
+				}
+				if l.clients == nil {
+					return true
+				}
+				l.clients.mu.Lock()
+				defer l.clients.mu.Unlock()
+				return len(l.clients.m) == 0
+			}
+			for !released() {
+				if time.Now().After(deadline) {
+					t.Fatal("connection not released")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c3 := dial(t, &l)
+			defer c3.Close()
+			echo(t, c3)
+		})
+	}
+}
+
+func TestListenerMaxConnsClose(t *testing.T) {
+	l := Listener{
+		ListenerConfig: testListenerConfig,
+	}
+	l.MaxConns = 1
+	defer l.Close()
+
+	l.listenAndWait(t)
+	go l.acceptAndCopy()
+
+	c1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	io.WriteString(c1, "x")
+	c1.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c1.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("conn.Read(): got %v, want no error", err)
+	}
+
+	c2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := c2.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("conn.Read(): got %d bytes, want connection closed", n)
+	}
+}
+
+func TestListenerShedWritersLimit(t *testing.T) {
+	l := Listener{
+		ListenerConfig: testListenerConfig,
+		metrics:        newListenerMetrics(nil, ""),
+	}
+	l.OverloadResponse = OverloadServiceUnavailable
+	l.shedWriters.Store(maxShedWriters)
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	// Over the limit the connection is closed right away, without writing the response.
+	l.shed(c1, shedMaxConns, true)
+	c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := c2.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("conn.Read(): got %d bytes and %v, want EOF", n, err)
+	}
+	if n := l.shedWriters.Load(); n != maxShedWriters {
+		t.Fatalf("expected %d shed writers, got %d", maxShedWriters, n)
+	}
+}
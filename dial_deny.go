@@ -0,0 +1,127 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// ErrDestinationDenied is returned when the dialer connects to an IP address in a denied network.
+var ErrDestinationDenied = errors.New("destination IP address is denied")
+
+type destinationDeniedError struct {
+	addr netip.Addr
+}
+
+func (e destinationDeniedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrDestinationDenied, e.addr)
+}
+
+func (e destinationDeniedError) Is(target error) bool {
+	return target == ErrDestinationDenied
+}
+
+// IPNetwork is a set of IP networks given as a CIDR, an IP address or a preset name.
+type IPNetwork struct {
+	Name     string
+	Prefixes []netip.Prefix
+}
+
+// IPNetworkPresets are the named sets of networks accepted by ParseIPNetwork.
+var IPNetworkPresets = map[string][]netip.Prefix{
+	// Loopback includes the unspecified addresses, on most systems connecting to them reaches the local host.
+	"loopback": {
+		netip.MustParsePrefix("127.0.0.0/8"),
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+		netip.MustParsePrefix("::/128"),
+	},
+	"link-local": {
+		netip.MustParsePrefix("169.254.0.0/16"),
+		netip.MustParsePrefix("fe80::/10"),
+	},
+	// Private includes RFC 1918, shared address space (RFC 6598) and unique local (RFC 4193) addresses.
+	"private": {
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+		netip.MustParsePrefix("192.168.0.0/16"),
+		netip.MustParsePrefix("100.64.0.0/10"),
+		netip.MustParsePrefix("fc00::/7"),
+	},
+	// Metadata are the instance metadata services of the major cloud providers.
+	"metadata": {
+		netip.MustParsePrefix("169.254.169.254/32"),
+		netip.MustParsePrefix("169.254.170.2/32"),
+		netip.MustParsePrefix("100.100.100.200/32"),
+		netip.MustParsePrefix("fd00:ec2::254/128"),
+	},
+}
+
+// ParseIPNetwork parses a CIDR, an IP address or a preset name, see IPNetworkPresets.
+func ParseIPNetwork(val string) (IPNetwork, error) {
+	if p, ok := IPNetworkPresets[strings.ToLower(val)]; ok {
+		return IPNetwork{Name: strings.ToLower(val), Prefixes: p}, nil
+	}
+
+	p, err := ParseCIDR(val)
+	if err != nil {
+		return IPNetwork{}, fmt.Errorf("invalid network %q, must be a CIDR, an IP address or one of the presets: %s",
+			val, strings.Join(slices.Sorted(maps.Keys(IPNetworkPresets)), ", "))
+	}
+	return IPNetwork{Name: p.String(), Prefixes: []netip.Prefix{p}}, nil
+}
+
+func (n IPNetwork) String() string {
+	return n.Name
+}
+
+// Contains returns true if the IP address is in one of the networks.
+func (n IPNetwork) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range n.Prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func ipNetworksContain(networks []IPNetwork, ip netip.Addr) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// destinationAllowed returns true if ip is not in deny networks or is in allow networks.
+func destinationAllowed(deny, allow []IPNetwork, ip netip.Addr) bool {
+	return !ipNetworksContain(deny, ip) || ipNetworksContain(allow, ip)
+}
+
+// denyDestinationControl returns a net.Dialer control function that rejects connections to denied IP addresses.
+// It is called after the host name is resolved, right before connecting, so DNS rebinding cannot bypass it.
+func denyDestinationControl(deny, allow []IPNetwork) func(ctx context.Context, network, address string, c syscall.RawConn) error {
+	return func(_ context.Context, _, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := ap.Addr().Unmap(); !destinationAllowed(deny, allow, ip) {
+			return destinationDeniedError{addr: ip}
+		}
+		return nil
+	}
+}
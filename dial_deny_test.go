@@ -0,0 +1,105 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/saucelabs/forwarder/log/slog"
+)
+
+func TestDestinationAllowed(t *testing.T) {
+	parse := func(vals ...string) []IPNetwork {
+		var res []IPNetwork
+		for _, v := range vals {
+			n, err := ParseIPNetwork(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, n)
+		}
+		return res
+	}
+	deny := parse("loopback", "link-local", "private", "metadata", "203.0.113.0/24")
+	allow := parse("10.1.2.3")
+
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"100.100.100.200", false},
+		{"203.0.113.7", false},
+		{"10.1.2.3", true},
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+	}
+	for _, tc := range tests {
+		if got := destinationAllowed(deny, allow, netip.MustParseAddr(tc.ip)); got != tc.allowed {
+			t.Errorf("%s: expected allowed=%v", tc.ip, tc.allowed)
+		}
+	}
+
+	if _, err := ParseIPNetwork("intranet"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestDialerDenyNetworks(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	defer s.Close()
+
+	cfg := DefaultDialConfig()
+	cfg.Retry.Attempts = 3
+	n, err := ParseIPNetwork("loopback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DenyNetworks = []IPNetwork{n}
+
+	_, port, err := net.SplitHostPort(s.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDialer(cfg)
+	_, dialErr := d.DialContext(context.Background(), "tcp", net.JoinHostPort("localhost", port))
+	if !errors.Is(dialErr, ErrDestinationDenied) {
+		t.Fatalf("expected %v, got %v", ErrDestinationDenied, dialErr)
+	}
+
+	hp, err := newHTTPProxy(DefaultHTTPProxyConfig(), nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", http.NoBody)
+	if res := hp.errorResponse(req, dialErr); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d", http.StatusForbidden, res.StatusCode)
+	}
+
+	cfg.AllowNetworks = []IPNetwork{{Name: "localhost", Prefixes: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("::1/128")}}}
+	conn, err := NewDialer(cfg).DialContext(context.Background(), "tcp", s.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,361 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/saucelabs/forwarder/log"
+	"github.com/saucelabs/forwarder/ruleset"
+)
+
+type DomainListConfig struct {
+	// RefreshInterval is the interval between fetches of the list.
+	RefreshInterval time.Duration
+	// CacheDir is the directory where the last good copy of the list is kept.
+	// It is used if the list cannot be fetched at startup.
+	// If empty, the list is not stored on disk.
+	CacheDir string
+	// MaxSize is the maximum size of the list fetched over HTTP, larger lists are rejected.
+	MaxSize SizeSuffix
+
+	PromConfig
+}
+
+func DefaultDomainListConfig() *DomainListConfig {
+	return &DomainListConfig{
+		RefreshInterval: time.Hour,
+		MaxSize:         64 * Mebi,
+	}
+}
+
+func (c *DomainListConfig) Validate() error {
+	if c.RefreshInterval <= 0 {
+		return errors.New("refresh interval must be positive")
+	}
+	if c.MaxSize <= 0 {
+		return errors.New("max size must be positive")
+	}
+	return nil
+}
+
+type domainListMetrics struct {
+	rules     prometheus.Gauge
+	updated   prometheus.Gauge
+	errors    prometheus.Counter
+	lastFetch atomic.Int64
+}
+
+func newDomainListMetrics(r prometheus.Registerer, namespace, name string) *domainListMetrics {
+	if r == nil {
+		r = prometheus.NewRegistry() // This registry will be discarded.
+	}
+	f := promauto.With(r)
+	l := prometheus.Labels{"list": name}
+
+	m := &domainListMetrics{
+		rules: f.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "domain_list_rules",
+			Help:        "Number of rules in the domain list",
+			ConstLabels: l,
+		}),
+		updated: f.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "domain_list_last_update_timestamp_seconds",
+			Help:        "Timestamp of the last change of the domain list",
+			ConstLabels: l,
+		}),
+		errors: f.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "domain_list_fetch_errors_total",
+			Help:        "Number of failed fetches of the domain list",
+			ConstLabels: l,
+		}),
+	}
+	f.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "domain_list_age_seconds",
+		Help:        "Time since the domain list was last successfully fetched",
+		ConstLabels: l,
+	}, func() float64 {
+		t := m.lastFetch.Load()
+		if t == 0 {
+			return 0
+		}
+		return time.Since(time.Unix(0, t)).Seconds()
+	})
+
+	return m
+}
+
+func (m *domainListMetrics) fetched() {
+	m.lastFetch.Store(time.Now().UnixNano())
+}
+
+func (m *domainListMetrics) update(dm *ruleset.DomainMatcher) {
+	m.rules.Set(float64(dm.Len()))
+	m.updated.SetToCurrentTime()
+}
+
+// domainListFetchTimeout is the maximum time to fetch the list, so that a hanging server does not block refreshes.
+const domainListFetchTimeout = time.Minute
+
+// DomainList is a Matcher backed by a domain list fetched from a URL, see ruleset.ParseDomainList for the format.
+// The list is refreshed periodically, HTTP URLs are fetched with conditional requests using ETag and Last-Modified.
+// If fetching or parsing the list fails, the previously loaded list is kept.
+type DomainList struct {
+	name    string
+	url     *url.URL
+	config  DomainListConfig
+	rt      http.RoundTripper
+	log     log.StructuredLogger
+	metrics *domainListMetrics
+
+	m atomic.Pointer[ruleset.DomainMatcher]
+
+	mu           sync.Mutex
+	raw          []byte
+	etag         string
+	lastModified string
+}
+
+// NewDomainList fetches the list from u and returns a DomainList.
+// The name identifies the list in metrics and logs, and is used as the name of the cache file.
+// If the list cannot be fetched and there is a cached copy, the cached copy is used.
+func NewDomainList(name string, u *url.URL, cfg *DomainListConfig, rt http.RoundTripper, log log.StructuredLogger) (*DomainList, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	l := &DomainList{
+		name:    name,
+		url:     u,
+		config:  *cfg,
+		rt:      rt,
+		log:     log,
+		metrics: newDomainListMetrics(cfg.PromRegistry, cfg.PromNamespace, name),
+	}
+
+	err := l.refresh(context.Background())
+	if err == nil {
+		return l, nil
+	}
+	if cerr := l.loadCache(); cerr != nil {
+		if !errors.Is(cerr, os.ErrNotExist) {
+			err = errors.Join(err, cerr)
+		}
+		return nil, fmt.Errorf("%s domain list %s: %w", name, u.Redacted(), err)
+	}
+	l.log.Warn("failed to fetch domain list, using cached copy", "list", name, "url", u.Redacted(), "error", err)
+
+	return l, nil
+}
+
+// Match returns true if the host name matches the list.
+func (l *DomainList) Match(host string) bool {
+	m := l.m.Load()
+	return m != nil && m.Match(host)
+}
+
+// Len returns the number of rules in the list.
+func (l *DomainList) Len() int {
+	m := l.m.Load()
+	if m == nil {
+		return 0
+	}
+	return m.Len()
+}
+
+// Run refreshes the list periodically until the context is canceled.
+func (l *DomainList) Run(ctx context.Context) error {
+	t := time.NewTicker(l.config.RefreshInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if err := l.refresh(ctx); err != nil && ctx.Err() == nil {
+				l.log.Error("failed to refresh domain list, keeping current rules", "list", l.name, "url", l.url.Redacted(), "error", err)
+			}
+		}
+	}
+}
+
+// refresh fetches and parses the list, the fetch time is recorded only if the list is up to date afterwards.
+func (l *DomainList) refresh(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, domainListFetchTimeout)
+	defer cancel()
+
+	b, v, err := l.fetch(ctx)
+	if err != nil {
+		l.metrics.errors.Inc()
+		return err
+	}
+
+	if b == nil || (l.m.Load() != nil && bytes.Equal(b, l.raw)) {
+		l.etag, l.lastModified = v.etag, v.lastModified
+		l.metrics.fetched()
+		return nil
+	}
+	dm, err := ruleset.ParseDomainList(bytes.NewReader(b))
+	if err != nil {
+		l.metrics.errors.Inc()
+		return err
+	}
+	l.swap(dm, b)
+	l.etag, l.lastModified = v.etag, v.lastModified
+	l.metrics.fetched()
+	l.log.Info("loaded domain list", "list", l.name, "url", l.url.Redacted(), "rules", dm.Len())
+
+	if err := l.saveCache(b); err != nil {
+		l.log.Error("failed to save domain list cache", "list", l.name, "error", err)
+	}
+
+	return nil
+}
+
+func (l *DomainList) swap(dm *ruleset.DomainMatcher, b []byte) {
+	l.raw = b
+	l.m.Store(dm)
+	l.metrics.update(dm)
+}
+
+// domainListVersion holds the validators of a fetched list used in conditional requests.
+type domainListVersion struct {
+	etag         string
+	lastModified string
+}
+
+// fetch returns the list and its validators, or nil if the list was not modified since the last fetch.
+// The validators are stored by the caller once the list is loaded, so that a list that fails to parse is fetched again.
+func (l *DomainList) fetch(ctx context.Context) ([]byte, domainListVersion, error) {
+	v := domainListVersion{etag: l.etag, lastModified: l.lastModified}
+
+	if l.url.Scheme != "http" && l.url.Scheme != "https" {
+		b, err := ReadURL(l.url, l.rt)
+		return b, v, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url.String(), http.NoBody)
+	if err != nil {
+		return nil, v, err
+	}
+	if l.m.Load() != nil {
+		if l.etag != "" {
+			req.Header.Set("If-None-Match", l.etag)
+		}
+		if l.lastModified != "" {
+			req.Header.Set("If-Modified-Since", l.lastModified)
+		}
+	}
+
+	c := http.Client{
+		Transport: l.rt,
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, v, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, v, nil
+	default:
+		return nil, v, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, int64(l.config.MaxSize)+1))
+	if err != nil {
+		return nil, v, err
+	}
+	if int64(len(b)) > int64(l.config.MaxSize) {
+		return nil, v, fmt.Errorf("list exceeds max size %s", l.config.MaxSize)
+	}
+	v = domainListVersion{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	return b, v, nil
+}
+
+func (l *DomainList) cacheFile() string {
+	if l.config.CacheDir == "" {
+		return ""
+	}
+	return filepath.Join(l.config.CacheDir, l.name+"-domains.txt")
+}
+
+func (l *DomainList) loadCache() error {
+	name := l.cacheFile()
+	if name == "" {
+		return os.ErrNotExist
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	dm, err := ruleset.ParseDomainList(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	l.mu.Lock()
+	l.swap(dm, b)
+	l.mu.Unlock()
+
+	return nil
+}
+
+// saveCache atomically replaces the cache file with b.
+func (l *DomainList) saveCache(b []byte) error {
+	name := l.cacheFile()
+	if name == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(l.config.CacheDir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(l.config.CacheDir, filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
@@ -0,0 +1,137 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/saucelabs/forwarder/log/slog"
+)
+
+func TestDomainList(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		list        = "example.com\n"
+		etag        = `"1"`
+		fail        bool
+		notModified int
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(list)) //nolint:errcheck // test server
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultDomainListConfig()
+	cfg.CacheDir = t.TempDir()
+
+	l, err := NewDomainList("deny", u, cfg, http.DefaultTransport, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Match("example.com") || l.Match("example.org") {
+		t.Fatal("unexpected match")
+	}
+
+	ctx := context.Background()
+	if err := l.refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if notModified != 1 {
+		t.Fatalf("expected conditional request, got %d not modified responses", notModified)
+	}
+
+	mu.Lock()
+	list, etag = "example.org\n", `"2"`
+	mu.Unlock()
+	if err := l.refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if l.Match("example.com") || !l.Match("example.org") {
+		t.Fatal("expected the list to be swapped")
+	}
+
+	mu.Lock()
+	list, etag = "example.com\nexample.net\n", `"3"`
+	mu.Unlock()
+	l.config.MaxSize = 16
+	if err := l.refresh(ctx); err == nil {
+		t.Fatal("expected error for list exceeding max size")
+	}
+	if !l.Match("example.org") {
+		t.Fatal("expected the current list to be kept")
+	}
+	l.config.MaxSize = DefaultDomainListConfig().MaxSize
+
+	// A list that fails to parse does not count as fetched and is downloaded again.
+	mu.Lock()
+	list, etag = "/[/\n", `"4"`
+	mu.Unlock()
+	lastFetch := l.metrics.lastFetch.Load()
+	if err := l.refresh(ctx); err == nil {
+		t.Fatal("expected error for invalid list")
+	}
+	if !l.Match("example.org") {
+		t.Fatal("expected the current list to be kept")
+	}
+	if l.metrics.lastFetch.Load() != lastFetch {
+		t.Fatal("expected the fetch time not to be recorded")
+	}
+	mu.Lock()
+	list = "example.net\n"
+	mu.Unlock()
+	if err := l.refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !l.Match("example.net") {
+		t.Fatal("expected the fixed list to be swapped")
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	if err := l.refresh(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+	if !l.Match("example.net") {
+		t.Fatal("expected the current list to be kept")
+	}
+
+	// The last good copy is used when the list cannot be fetched at startup.
+	l, err = NewDomainList("deny", u, cfg, http.DefaultTransport, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Match("example.net") {
+		t.Fatal("expected the cached list to be used")
+	}
+
+	cfg.CacheDir = t.TempDir()
+	if _, err := NewDomainList("deny", u, cfg, http.DefaultTransport, slog.Default()); err == nil {
+		t.Fatal("expected error without cached copy")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+	"github.com/saucelabs/forwarder/ruleset"
+)
+
+// DomainTimeFrameRule applies a time frame to requests to matching domains.
+type DomainTimeFrameRule struct {
+	Domains   Matcher
+	TimeFrame []ruleset.TimeFrameEntry
+	// Location is the time zone set in the rule, if set DomainTimeFrameRulesInLocation does not change the rule.
+	Location *time.Location
+
+	spec string
+}
+
+// ParseDomainTimeFrameRule parses a rule in the format <regexp>=[<zone>|]<time frame>[;<time frame>...],
+// where zone is an optional IANA time zone name the time frames are evaluated in,
+// see ruleset.ParseTimeFrameEntry for the time frame format.
+func ParseDomainTimeFrameRule(val string) (DomainTimeFrameRule, error) {
+	i := strings.LastIndex(val, "=")
+	if i <= 0 {
+		return DomainTimeFrameRule{}, fmt.Errorf("invalid time frame rule %q, expected <regexp>=[<zone>|]<time frames>", val)
+	}
+
+	item, err := ruleset.ParseRegexpListItem(val[:i])
+	if err != nil {
+		return DomainTimeFrameRule{}, err
+	}
+	if item.Exclude {
+		return DomainTimeFrameRule{}, errors.New("exclude rules are not supported")
+	}
+	m, err := ruleset.NewRegexpMatcherFromList([]ruleset.RegexpListItem{item})
+	if err != nil {
+		return DomainTimeFrameRule{}, err
+	}
+
+	var loc *time.Location
+	frames := val[i+1:]
+	if zone, rest, ok := strings.Cut(frames, "|"); ok {
+		if zone == "" {
+			return DomainTimeFrameRule{}, errors.New("time zone is empty")
+		}
+		loc, err = time.LoadLocation(zone)
+		if err != nil {
+			return DomainTimeFrameRule{}, fmt.Errorf("time zone: %w", err)
+		}
+		frames = rest
+	}
+
+	var tf []ruleset.TimeFrameEntry
+	for _, s := range strings.Split(frames, ";") {
+		e, err := ruleset.ParseTimeFrameEntry(s)
+		if err != nil {
+			return DomainTimeFrameRule{}, fmt.Errorf("time frame %q: %w", s, err)
+		}
+		tf = append(tf, e)
+	}
+	if loc != nil {
+		tf = ruleset.InLocation(tf, loc)
+	}
+
+	return DomainTimeFrameRule{Domains: m, TimeFrame: tf, Location: loc, spec: val}, nil
+}
+
+func (r DomainTimeFrameRule) String() string {
+	return r.spec
+}
+
+// DomainTimeFrameRulesInLocation returns a copy of the rules with time frames evaluated in the location,
+// rules with their own time zone are not changed.
+func DomainTimeFrameRulesInLocation(rules []DomainTimeFrameRule, loc *time.Location) []DomainTimeFrameRule {
+	if loc == nil {
+		return rules
+	}
+	res := make([]DomainTimeFrameRule, len(rules))
+	for i, r := range rules {
+		if r.Location == nil {
+			r.TimeFrame = ruleset.InLocation(r.TimeFrame, loc)
+		}
+		res[i] = r
+	}
+	return res
+}
+
+// checkDomainTimeFrames denies requests to domains matching a deny rule within its time frame,
+// and requests to domains matching allow rules outside of their time frames.
+func checkDomainTimeFrames(deny, allow []DomainTimeFrameRule, host string, t time.Time) error {
+	for _, r := range deny {
+		if r.Domains.Match(host) && ruleset.MatchTimeFrame(r.TimeFrame, t) {
+			return ErrProxyDenied
+		}
+	}
+
+	matched := false
+	for _, r := range allow {
+		if !r.Domains.Match(host) {
+			continue
+		}
+		if ruleset.MatchTimeFrame(r.TimeFrame, t) {
+			return nil
+		}
+		matched = true
+	}
+	if matched {
+		return ErrProxyOutsideAllowedTimeframe
+	}
+
+	return nil
+}
+
+func (hp *HTTPProxy) domainTimeFrames(deny, allow []DomainTimeFrameRule) martian.RequestModifier {
+	return martian.RequestModifierFunc(func(req *http.Request) error {
+		return checkDomainTimeFrames(deny, allow, req.URL.Hostname(), time.Now())
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDomainTimeFrames(t *testing.T) {
+	parse := func(vals ...string) []DomainTimeFrameRule {
+		var res []DomainTimeFrameRule
+		for _, v := range vals {
+			r, err := ParseDomainTimeFrameRule(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, r)
+		}
+		return res
+	}
+
+	deny := parse(`^games\.example\.com$=wed/09:00-17:00;-2025-01-01`)
+	allow := parse(`^social\.example\.com$=wed/12:00-13:00`, `^social\.example\.com$=wed/22:00-02:00`)
+
+	// January 1st 2025 was Wednesday.
+	wed := func(hour, minute int) time.Time {
+		return time.Date(2025, time.January, 8, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		host string
+		t    time.Time
+		err  error
+	}{
+		{"games.example.com", wed(10, 0), ErrProxyDenied},
+		{"games.example.com", wed(17, 0), nil},
+		{"games.example.com", time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC), nil},
+		{"social.example.com", wed(12, 30), nil},
+		{"social.example.com", wed(23, 0), nil},
+		{"social.example.com", wed(13, 0), ErrProxyOutsideAllowedTimeframe},
+		{"social.example.com", wed(10, 0).AddDate(0, 0, 1), ErrProxyOutsideAllowedTimeframe},
+		{"www.example.com", wed(10, 0), nil},
+	}
+	for _, tc := range tests {
+		if err := checkDomainTimeFrames(deny, allow, tc.host, tc.t); !errors.Is(err, tc.err) {
+			t.Errorf("%s at %s: expected %v, got %v", tc.host, tc.t, tc.err, err)
+		}
+	}
+
+	for _, val := range []string{
+		"example.com", "=wed/9-17", "example.com=", "-example.com=wed/9-17", "example.com=wed/9",
+		"example.com=|wed/9-17", "example.com=Mars/Olympus|wed/9-17", "example.com=UTC|",
+	} {
+		if _, err := ParseDomainTimeFrameRule(val); err == nil {
+			t.Errorf("%q: expected error", val)
+		}
+	}
+}
+
+func TestDomainTimeFrameRuleZone(t *testing.T) {
+	deny, err := ParseDomainTimeFrameRule(`^games\.example\.com$=Asia/Tokyo|wed/09:00-17:00`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deny.Location == nil || deny.Location.String() != "Asia/Tokyo" {
+		t.Fatalf("expected rule location Asia/Tokyo, got %v", deny.Location)
+	}
+	other, err := ParseDomainTimeFrameRule(`^social\.example\.com$=wed/09:00-17:00`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rule zone takes precedence over the default zone.
+	rules := DomainTimeFrameRulesInLocation([]DomainTimeFrameRule{deny, other}, time.UTC)
+
+	// 2025-01-08 was Wednesday, 01:00 UTC is 10:00 in Tokyo.
+	ts := time.Date(2025, time.January, 8, 1, 0, 0, 0, time.UTC)
+	if err := checkDomainTimeFrames(rules, nil, "games.example.com", ts); !errors.Is(err, ErrProxyDenied) {
+		t.Fatalf("expected %v, got %v", ErrProxyDenied, err)
+	}
+	if err := checkDomainTimeFrames(rules, nil, "social.example.com", ts); err != nil {
+		t.Fatalf("expected rule without zone to use the default zone, got %v", err)
+	}
+	if err := checkDomainTimeFrames(rules, nil, "games.example.com", ts.Add(9*time.Hour)); err != nil {
+		t.Fatalf("expected 19:00 in Tokyo to be outside of the time frame, got %v", err)
+	}
+}
@@ -28,13 +28,17 @@ const (
 
 const enabled = "true"
 
+// testConnectPorts allows CONNECT to the test services ports.
+const testConnectPorts = "443,1443,8080"
+
 func ProxyService() *Service {
 	return &Service{
 		Name:  ProxyServiceName,
 		Image: Image,
 		Environment: map[string]string{
-			"FORWARDER_API_ADDRESS": ":10000",
-			"FORWARDER_GOLEAK":      enabled,
+			"FORWARDER_API_ADDRESS":   ":10000",
+			"FORWARDER_GOLEAK":        enabled,
+			"FORWARDER_CONNECT_PORTS": testConnectPorts,
 		},
 	}
 }
@@ -44,7 +48,8 @@ func UpstreamProxyService() *Service {
 		Name:  UpstreamProxyServiceName,
 		Image: Image,
 		Environment: map[string]string{
-			"FORWARDER_NAME": UpstreamProxyServiceName,
+			"FORWARDER_NAME":          UpstreamProxyServiceName,
+			"FORWARDER_CONNECT_PORTS": testConnectPorts,
 		},
 	}
 }
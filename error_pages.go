@@ -0,0 +1,224 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+)
+
+// Error classes group error labels, they are used as error page template names.
+const (
+	ErrorClassAuthRequired        = "auth_required"
+	ErrorClassDenied              = "denied"
+	ErrorClassOutsideTimeFrame    = "outside_time_frame"
+	ErrorClassUpstreamUnreachable = "upstream_unreachable"
+	ErrorClassTLSFailure          = "tls_failure"
+)
+
+// errorClass returns the class of an error label, or empty string if the label does not belong to a class.
+func errorClass(label string) string {
+	switch {
+	case strings.HasPrefix(label, "net_"):
+		return ErrorClassUpstreamUnreachable
+	case strings.HasPrefix(label, "tls_"):
+		return ErrorClassTLSFailure
+	}
+
+	switch label {
+	case "proxy_authentication", "auth_lockout":
+		return ErrorClassAuthRequired
+	case deniedLabel, "port_denied", "url_rule", "destination_denied":
+		return ErrorClassDenied
+	case prohibitedLabel:
+		return ErrorClassOutsideTimeFrame
+	default:
+		return ""
+	}
+}
+
+// ErrorPageData is passed to error page templates, it is also the JSON error response body.
+type ErrorPageData struct {
+	Name       string `json:"name"`
+	Status     int    `json:"status"`
+	StatusText string `json:"status_text"`
+	Class      string `json:"class,omitempty"`
+	Label      string `json:"label"`
+	Message    string `json:"message"`
+	Error      string `json:"error"`
+	RequestID  string `json:"request_id,omitempty"`
+	Host       string `json:"host"`
+	ClientIP   string `json:"client_ip"`
+}
+
+const defaultErrorPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.StatusText}}</title>
+<style>
+body { font-family: sans-serif; margin: 3em auto; max-width: 40em; color: #333; }
+h1 { font-size: 1.5em; }
+dl { font-size: 0.9em; color: #666; }
+dt { float: left; clear: left; width: 8em; }
+</style>
+</head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>{{.Message}}</p>
+<dl>
+<dt>Host</dt><dd>{{.Host}}</dd>
+<dt>Client IP</dt><dd>{{.ClientIP}}</dd>
+{{if .RequestID}}<dt>Request ID</dt><dd>{{.RequestID}}</dd>{{end}}
+<dt>Error</dt><dd>{{.Error}}</dd>
+</dl>
+<p><small>{{.Name}}</small></p>
+</body>
+</html>
+`
+
+// ErrorPages renders error responses as HTML pages or JSON depending on the Accept header.
+// Templates are html/template files named after the error label e.g. net_dial.html,
+// or the error class e.g. denied.html, see the ErrorClass constants.
+// The default.html template is used for errors without a matching template,
+// if it does not exist a built-in page is used.
+type ErrorPages struct {
+	templates map[string]*template.Template
+}
+
+// ReadErrorPagesDir reads *.html templates from dir.
+func ReadErrorPagesDir(dir string) (*ErrorPages, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	ep := &ErrorPages{
+		templates: make(map[string]*template.Template, len(files)),
+	}
+	for _, f := range files {
+		t, err := template.ParseFiles(f)
+		if err != nil {
+			return nil, err
+		}
+		ep.templates[strings.TrimSuffix(filepath.Base(f), ".html")] = t
+	}
+	if _, ok := ep.templates["default"]; !ok {
+		ep.templates["default"] = template.Must(template.New("default").Parse(defaultErrorPage))
+	}
+
+	return ep, nil
+}
+
+// Len returns the number of templates.
+func (ep *ErrorPages) Len() int {
+	return len(ep.templates)
+}
+
+func (ep *ErrorPages) template(d *ErrorPageData) *template.Template {
+	for _, name := range []string{d.Label, d.Class, "default"} {
+		if t, ok := ep.templates[name]; ok && name != "" {
+			return t
+		}
+	}
+	return nil
+}
+
+// render returns the response body and content type,
+// it returns nil if the client does not accept HTML or JSON.
+func (ep *ErrorPages) render(d *ErrorPageData, accept string) ([]byte, string, error) {
+	switch negotiateErrorFormat(accept) {
+	case "text/html":
+		var b bytes.Buffer
+		if err := ep.template(d).Execute(&b, d); err != nil {
+			return nil, "", err
+		}
+		return b.Bytes(), "text/html; charset=utf-8", nil
+	case "application/json":
+		b, err := json.Marshal(d)
+		if err != nil {
+			return nil, "", err
+		}
+		return append(b, '\n'), "application/json", nil
+	default:
+		return nil, "", nil
+	}
+}
+
+// negotiateErrorFormat returns text/html or application/json if the client explicitly accepts it,
+// the one with higher quality is preferred, wildcards are ignored.
+func negotiateErrorFormat(accept string) string {
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, v := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		if mt != "text/html" && mt != "application/json" {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = mt, q
+		}
+	}
+	return best
+}
+
+func errorPageData(name string, req *http.Request, err error, code int, msg, label string) *ErrorPageData {
+	clientIP, _, serr := net.SplitHostPort(req.RemoteAddr)
+	if serr != nil {
+		clientIP = req.RemoteAddr
+	}
+	return &ErrorPageData{
+		Name:       name,
+		Status:     code,
+		StatusText: http.StatusText(code),
+		Class:      errorClass(label),
+		Label:      label,
+		Message:    msg,
+		Error:      err.Error(),
+		RequestID:  martian.ContextTraceID(req.Context()),
+		Host:       req.Host,
+		ClientIP:   clientIP,
+	}
+}
+
+// renderErrorPage renders the error page from cfg.ErrorPages, cfg is the current config, see Reload.
+func (hp *HTTPProxy) renderErrorPage(cfg *HTTPProxyConfig, req *http.Request, err error, code int, msg, label string) (body []byte, contentType string) {
+	ep := cfg.ErrorPages
+	if ep == nil {
+		return nil, ""
+	}
+	body, contentType, rerr := ep.render(errorPageData(cfg.Name, req, err, code, msg, label), req.Header.Get("Accept"))
+	if rerr != nil {
+		hp.log.Error("failed to render error page", "label", label, "error", rerr)
+		return nil, ""
+	}
+	return body, contentType
+}
@@ -0,0 +1,141 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/saucelabs/forwarder/log/slog"
+)
+
+func TestErrorPages(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "denied.html"), []byte(`<p>{{.Host}} denied for {{.ClientIP}}: {{.Error}}</p>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ep, err := ReadErrorPagesDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultHTTPProxyConfig()
+	cfg.ErrorPages = ep
+	hp, err := newHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := func(accept string, err error) (*http.Response, string) {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res := hp.errorResponse(req, err)
+		b, rerr := io.ReadAll(res.Body)
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		return res, string(b)
+	}
+
+	t.Run("class template", func(t *testing.T) {
+		res, body := response("text/html,application/xhtml+xml,*/*;q=0.8", ErrProxyDenied)
+		if ct := res.Header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Fatalf("unexpected content type %q", ct)
+		}
+		if body != "<p>example.com denied for 192.0.2.1: proxying denied</p>" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("default template", func(t *testing.T) {
+		_, body := response("text/html", fmt.Errorf("<script>: %w", ErrProxyOutsideAllowedTimeframe))
+		if !strings.Contains(body, "451 Unavailable For Legal Reasons") || strings.Contains(body, "<script>") {
+			t.Fatalf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		res, body := response("text/html;q=0.5, application/json", ErrProxyDenied)
+		if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("unexpected content type %q", ct)
+		}
+		var d ErrorPageData
+		if err := json.Unmarshal([]byte(body), &d); err != nil {
+			t.Fatal(err)
+		}
+		if d.Status != http.StatusForbidden || d.Class != ErrorClassDenied || d.Host != "example.com" || d.ClientIP != "192.0.2.1" {
+			t.Fatalf("unexpected data %+v", d)
+		}
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		for _, accept := range []string{"", "*/*", "text/html;q=0"} {
+			res, _ := response(accept, ErrProxyDenied)
+			if ct := res.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+				t.Fatalf("%q: unexpected content type %q", accept, ct)
+			}
+		}
+	})
+}
+
+func TestErrorPagesReload(t *testing.T) {
+	readPages := func(tmpl string) *ErrorPages {
+		t.Helper()
+
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "denied.html"), []byte(tmpl), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		ep, err := ReadErrorPagesDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ep
+	}
+
+	cfg := DefaultHTTPProxyConfig()
+	cfg.ErrorPages = readPages("old")
+	hp, err := newHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := func() string {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+		req.Header.Set("Accept", "text/html")
+		b, err := io.ReadAll(hp.errorResponse(req, ErrProxyDenied).Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if got := body(); got != "old" {
+		t.Fatalf("unexpected body %q", got)
+	}
+
+	ncfg := DefaultHTTPProxyConfig()
+	ncfg.ErrorPages = readPages("new")
+	if err := hp.Reload(ncfg, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := body(); got != "new" {
+		t.Fatalf("expected reloaded error page, got %q", got)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/saucelabs/forwarder/header"
+	"github.com/saucelabs/forwarder/internal/martian"
+	"github.com/saucelabs/forwarder/log"
+)
+
+// Headers sent to the forward auth service.
+const (
+	ForwardAuthMethodHeader = "X-Forwarded-Method"
+	ForwardAuthHostHeader   = "X-Forwarded-Host"
+	ForwardAuthPortHeader   = "X-Forwarded-Port"
+	ForwardAuthURIHeader    = "X-Forwarded-Uri"
+	ForwardAuthForHeader    = "X-Forwarded-For"
+	ForwardAuthUserHeader   = "X-Forwarded-User"
+)
+
+// Headers read from the forward auth service response.
+const (
+	// ForwardAuthResponseHeader adds or removes a header on the proxied request, it can be repeated.
+	// The value uses the same syntax as the --header flag.
+	ForwardAuthResponseHeader = "X-Forward-Auth-Header"
+	// ForwardAuthResponseUpstream sets the upstream proxy URL for the request, or "direct" to connect directly.
+	ForwardAuthResponseUpstream = "X-Forward-Auth-Upstream"
+	// ForwardAuthResponseUser sets the user of the request, it is reported in logs.
+	ForwardAuthResponseUser = "X-Forward-Auth-User"
+)
+
+// ErrProxyForwardAuthDenied is returned when the forward auth service denies the request.
+var ErrProxyForwardAuthDenied = denyError{errors.New("proxying denied by authorization service")}
+
+type forwardAuthError struct {
+	error
+}
+
+type ForwardAuthConfig struct {
+	// URL of the authorization service.
+	URL *url.URL
+	// Timeout is the maximum time to wait for the authorization service response.
+	Timeout time.Duration
+	// CacheTTL is the time decisions are cached for, zero disables caching.
+	// Only allow and deny decisions are cached.
+	CacheTTL time.Duration
+	// FailOpen allows requests if the authorization service fails, otherwise they are rejected.
+	FailOpen bool
+	// Transport is used to call the authorization service, if nil a clone of http.DefaultTransport is used.
+	// It should not use a proxy.
+	Transport http.RoundTripper
+}
+
+func DefaultForwardAuthConfig() *ForwardAuthConfig {
+	return &ForwardAuthConfig{
+		Timeout:  5 * time.Second,
+		CacheTTL: 30 * time.Second,
+	}
+}
+
+func (c *ForwardAuthConfig) Validate() error {
+	if c.URL == nil {
+		return errors.New("URL is required")
+	}
+	if c.URL.Scheme != "http" && c.URL.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", c.URL.Scheme)
+	}
+	if c.Timeout <= 0 {
+		return errors.New("timeout must be positive")
+	}
+	if c.CacheTTL < 0 {
+		return errors.New("cache TTL must not be negative")
+	}
+	return nil
+}
+
+type forwardAuthDecision struct {
+	allow        bool
+	authRequired bool
+	headers      []header.Header
+	upstream     *url.URL
+	direct       bool
+	user         string
+	expires      time.Time
+}
+
+// maxForwardAuthCacheSize is the number of cached decisions after which the cache is cleared.
+const maxForwardAuthCacheSize = 10000
+
+type forwardAuth struct {
+	config  ForwardAuthConfig
+	client  *http.Client
+	metrics *httpProxyMetrics
+	log     log.StructuredLogger
+
+	mu    sync.Mutex
+	cache map[string]*forwardAuthDecision
+}
+
+type forwardAuthContextKey struct{}
+
+// forwardAuth delegates allow/deny decisions to an HTTP service.
+// The service is called with GET request with headers describing the proxied request,
+// and the Proxy-Authorization header of the client, if any.
+// The request is allowed on 2xx status, denied on 403, and requires proxy authentication on 401 and 407.
+// Other status codes and errors are handled according to the fail-open policy.
+func (hp *HTTPProxy) forwardAuth(cfg *ForwardAuthConfig) martian.RequestModifier {
+	tr := cfg.Transport
+	if tr == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Proxy = nil
+		tr = t
+	}
+
+	fa := &forwardAuth{
+		config: *cfg,
+		client: &http.Client{
+			Transport: tr,
+			Timeout:   cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		metrics: hp.metrics,
+		log:     hp.log,
+		cache:   make(map[string]*forwardAuthDecision),
+	}
+
+	return martian.RequestModifierFunc(fa.modifyRequest)
+}
+
+func (fa *forwardAuth) modifyRequest(req *http.Request) error {
+	d, err := fa.decide(req)
+	if err != nil {
+		fa.metrics.forwardAuth("error")
+		if fa.config.FailOpen {
+			fa.log.Debug("authorization service failed, allowing request", "error", err)
+			return nil
+		}
+		return forwardAuthError{err}
+	}
+	if d.authRequired {
+		return ErrProxyAuthentication
+	}
+	if !d.allow {
+		return ErrProxyForwardAuthDenied
+	}
+
+	for i := range d.headers {
+		d.headers[i].Apply(req.Header)
+	}
+	if d.user != "" {
+		martian.SetContextUser(req.Context(), d.user)
+	}
+	if d.upstream != nil || d.direct {
+		martian.SetContextValue(req.Context(), forwardAuthContextKey{}, d)
+	}
+
+	return nil
+}
+
+func (fa *forwardAuth) decide(req *http.Request) (*forwardAuthDecision, error) {
+	creq, key, err := fa.request(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if fa.config.CacheTTL > 0 {
+		fa.mu.Lock()
+		d, ok := fa.cache[key]
+		fa.mu.Unlock()
+		if ok && time.Now().Before(d.expires) {
+			fa.metrics.forwardAuth("cached")
+			return d, nil
+		}
+	}
+
+	res, err := fa.client.Do(creq)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096)) //nolint:errcheck // best effort to reuse connection
+	res.Body.Close()
+
+	d := new(forwardAuthDecision)
+	switch {
+	case res.StatusCode/100 == 2:
+		d.allow = true
+		if err := d.parse(res.Header); err != nil {
+			return nil, err
+		}
+		fa.metrics.forwardAuth("allow")
+	case res.StatusCode == http.StatusForbidden:
+		fa.metrics.forwardAuth("deny")
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusProxyAuthRequired:
+		d.authRequired = true
+		fa.metrics.forwardAuth("auth_required")
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	if fa.config.CacheTTL > 0 {
+		d.expires = time.Now().Add(fa.config.CacheTTL)
+		fa.mu.Lock()
+		if len(fa.cache) >= maxForwardAuthCacheSize {
+			clear(fa.cache)
+		}
+		fa.cache[key] = d
+		fa.mu.Unlock()
+	}
+
+	return d, nil
+}
+
+// request builds the authorization request and the cache key for the proxied request.
+func (fa *forwardAuth) request(req *http.Request) (*http.Request, string, error) {
+	creq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, fa.config.URL.String(), http.NoBody)
+	if err != nil {
+		return nil, "", err
+	}
+
+	host, port := req.URL.Hostname(), req.URL.Port()
+	if port == "" {
+		switch req.URL.Scheme {
+		case "https":
+			port = "443"
+		default:
+			port = "80"
+		}
+	}
+	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		clientIP = req.RemoteAddr
+	}
+
+	uri := ""
+	if req.Method != http.MethodConnect {
+		uri = req.URL.RequestURI()
+	}
+
+	h := creq.Header
+	h.Set(ForwardAuthMethodHeader, req.Method)
+	h.Set(ForwardAuthHostHeader, host)
+	h.Set(ForwardAuthPortHeader, port)
+	if uri != "" {
+		h.Set(ForwardAuthURIHeader, uri)
+	}
+	h.Set(ForwardAuthForHeader, clientIP)
+	if user := martian.ContextUser(req.Context()); user != "" {
+		h.Set(ForwardAuthUserHeader, user)
+	}
+	auth := req.Header.Get("Proxy-Authorization")
+	if auth != "" {
+		h.Set("Proxy-Authorization", auth)
+	}
+
+	sum := sha256.Sum256([]byte(auth))
+	key := req.Method + " " + host + ":" + port + uri + " " + clientIP + " " + hex.EncodeToString(sum[:])
+
+	return creq, key, nil
+}
+
+func (d *forwardAuthDecision) parse(h http.Header) error {
+	for _, v := range h.Values(ForwardAuthResponseHeader) {
+		hh, err := header.ParseHeader(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ForwardAuthResponseHeader, err)
+		}
+		d.headers = append(d.headers, hh)
+	}
+
+	switch v := h.Get(ForwardAuthResponseUpstream); v {
+	case "":
+	case "direct":
+		d.direct = true
+	default:
+		u, err := ParseProxyURL(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ForwardAuthResponseUpstream, err)
+		}
+		if err := validateProxyURL(u); err != nil {
+			return fmt.Errorf("%s: %w", ForwardAuthResponseUpstream, err)
+		}
+		d.upstream = u
+	}
+
+	d.user = h.Get(ForwardAuthResponseUser)
+
+	return nil
+}
+
+// forwardAuthUpstreamProxy returns a proxy function that uses the upstream proxy selected by the forward auth service,
+// and falls back to fn if the service did not select it.
+func (hp *HTTPProxy) forwardAuthUpstreamProxy(fn ProxyFunc) ProxyFunc {
+	return func(req *http.Request) (*url.URL, error) {
+		if d, ok := martian.ContextValue(req.Context(), forwardAuthContextKey{}).(*forwardAuthDecision); ok {
+			if d.direct {
+				return nil, nil
+			}
+			return d.upstream, nil
+		}
+		if fn != nil {
+			return fn(req)
+		}
+		if hp.transportProxy != nil {
+			return hp.transportProxy(req)
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/saucelabs/forwarder/log/slog"
+)
+
+func TestForwardAuth(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Team", r.Header.Get("X-Team"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	var (
+		status atomic.Int32
+		calls  atomic.Int32
+	)
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if got := r.Header.Get(ForwardAuthMethodHeader); got != http.MethodGet {
+			t.Errorf("unexpected method header %q", got)
+		}
+		if got := r.Header.Get(ForwardAuthHostHeader); got != "127.0.0.1" {
+			t.Errorf("unexpected host header %q", got)
+		}
+		if got := r.Header.Get(ForwardAuthForHeader); got != "192.0.2.1" {
+			t.Errorf("unexpected client IP header %q", got)
+		}
+		w.Header().Set(ForwardAuthResponseHeader, "X-Team: qa")
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer auth.Close()
+
+	authURL, err := url.Parse(auth.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newProxy := func(t *testing.T, failOpen bool, cacheTTL bool) *HTTPProxy {
+		t.Helper()
+
+		cfg := DefaultHTTPProxyConfig()
+		cfg.ProxyLocalhost = AllowProxyLocalhost
+		cfg.ForwardAuth = DefaultForwardAuthConfig()
+		cfg.ForwardAuth.URL = authURL
+		cfg.ForwardAuth.FailOpen = failOpen
+		if !cacheTTL {
+			cfg.ForwardAuth.CacheTTL = 0
+		}
+
+		p, err := newHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	do := func(t *testing.T, p *HTTPProxy) *http.Response {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, target.URL, http.NoBody)
+		rw := httptest.NewRecorder()
+		p.handler().ServeHTTP(rw, req)
+		return rw.Result()
+	}
+
+	tests := []struct {
+		name     string
+		status   int
+		failOpen bool
+		want     int
+	}{
+		{"allow", http.StatusOK, false, http.StatusOK},
+		{"deny", http.StatusForbidden, false, http.StatusForbidden},
+		{"auth required", http.StatusUnauthorized, false, http.StatusProxyAuthRequired},
+		{"fail closed", http.StatusInternalServerError, false, http.StatusServiceUnavailable},
+		{"fail open", http.StatusInternalServerError, true, http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status.Store(int32(tc.status))
+			res := do(t, newProxy(t, tc.failOpen, false))
+			if res.StatusCode != tc.want {
+				t.Fatalf("expected status %d, got %d", tc.want, res.StatusCode)
+			}
+			if tc.name == "allow" && res.Header.Get("X-Team") != "qa" {
+				t.Fatalf("expected X-Team header to be injected, got %q", res.Header.Get("X-Team"))
+			}
+		})
+	}
+
+	t.Run("cache", func(t *testing.T) {
+		status.Store(http.StatusOK)
+		calls.Store(0)
+
+		p := newProxy(t, false, true)
+		for range 3 {
+			if res := do(t, p); res.StatusCode != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+			}
+		}
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("expected 1 call to authorization service, got %d", n)
+		}
+	})
+}
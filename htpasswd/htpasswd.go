@@ -0,0 +1,186 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package htpasswd implements user authentication with htpasswd files.
+//
+// Each line of the file has the form <username>:<hash>, empty lines and lines starting with # are ignored.
+// The supported hashes are:
+//   - bcrypt ($2y$, $2a$ and $2b$ prefixes), as generated by htpasswd -B,
+//   - SHA-1 ({SHA} prefix), as generated by htpasswd -s,
+//   - plain text, as generated by htpasswd -p.
+//
+// Other hashes, including crypt, are rejected. Plain text passwords that look like a crypt hash are rejected as well,
+// that is 13 characters from the [./0-9A-Za-z] set or 20 characters starting with _.
+package htpasswd
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // required by the {SHA} hash format
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type hashFunc func(hash, pass string) bool
+
+// File holds users and password hashes read from an htpasswd file.
+type File struct {
+	users map[string]entry
+
+	// bcryptCache holds SHA-256 sums of passwords successfully verified with bcrypt,
+	// so that bcrypt is not computed for every proxy request.
+	bcryptCache sync.Map
+}
+
+type entry struct {
+	hash   string
+	check  hashFunc
+	bcrypt bool
+}
+
+// Parse reads an htpasswd file from r.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{
+		users: make(map[string]entry),
+	}
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("line %d: invalid format, expected <username>:<hash>", n)
+		}
+		if _, ok := f.users[user]; ok {
+			return nil, fmt.Errorf("line %d: duplicate user %q", n, user)
+		}
+		check, err := hashCheck(hash)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: user %q: %w", n, user, err)
+		}
+		f.users[user] = entry{hash: hash, check: check, bcrypt: isBcrypt(hash)}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ReadFile reads an htpasswd file from path.
+func ReadFile(path string) (*File, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2y$") || strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$")
+}
+
+func hashCheck(hash string) (hashFunc, error) {
+	switch {
+	case isBcrypt(hash):
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("bcrypt: %w", err)
+		}
+		return checkBcrypt, nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		if _, err := base64.StdEncoding.DecodeString(hash[len("{SHA}"):]); err != nil {
+			return nil, fmt.Errorf("sha: %w", err)
+		}
+		return checkSHA, nil
+	case strings.HasPrefix(hash, "$"), cryptRe.MatchString(hash):
+		return nil, errors.New("unsupported hash, use bcrypt (htpasswd -B)")
+	default:
+		return checkPlain, nil
+	}
+}
+
+// cryptRe matches traditional and extended DES crypt hashes, as generated by htpasswd -d.
+var cryptRe = regexp.MustCompile(`^([./0-9A-Za-z]{13}|_[./0-9A-Za-z]{19})$`)
+
+// dummyBcryptHash is compared with passwords of unknown users,
+// so that the response time does not reveal whether a user exists.
+var dummyBcryptHash = sync.OnceValue(func() []byte {
+	h, err := bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return h
+})
+
+func checkBcrypt(hash, pass string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+}
+
+func checkSHA(hash, pass string) bool {
+	sum := sha1.Sum([]byte(pass)) //nolint:gosec // required by the {SHA} hash format
+	return subtle.ConstantTimeCompare([]byte(hash[len("{SHA}"):]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+}
+
+func checkPlain(hash, pass string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(pass)) == 1
+}
+
+// Len returns the number of users.
+func (f *File) Len() int {
+	return len(f.users)
+}
+
+// HasUser returns true if the user is in the file.
+func (f *File) HasUser(user string) bool {
+	_, ok := f.users[user]
+	return ok
+}
+
+// Authenticate returns true if the password matches the user's hash.
+func (f *File) Authenticate(user, pass string) bool {
+	e, ok := f.users[user]
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyBcryptHash(), []byte(pass)) //nolint:errcheck // only for constant time
+		return false
+	}
+
+	if !e.bcrypt {
+		return e.check(e.hash, pass)
+	}
+
+	sum := sha256.Sum256([]byte(pass))
+	if v, ok := f.bcryptCache.Load(user); ok {
+		cached := v.([sha256.Size]byte)
+		if subtle.ConstantTimeCompare(cached[:], sum[:]) == 1 {
+			return true
+		}
+	}
+	if !e.check(e.hash, pass) {
+		return false
+	}
+	f.bcryptCache.Store(user, sum)
+
+	return true
+}
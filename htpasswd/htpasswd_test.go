@@ -0,0 +1,129 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package htpasswd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticate(t *testing.T) {
+	b, err := bcrypt.GenerateFromPassword([]byte("bpass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := "# comment\n" +
+		"\n" +
+		"bob:" + string(b) + "\n" +
+		"sam:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n" + // password
+		"pat:plain\n"
+
+	f, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Len() != 3 {
+		t.Fatalf("expected 3 users, got %d", f.Len())
+	}
+
+	tests := []struct {
+		user, pass string
+		ok         bool
+	}{
+		{"bob", "bpass", true},
+		{"bob", "bpass", true}, // cached
+		{"bob", "bad", false},
+		{"sam", "password", true},
+		{"sam", "bad", false},
+		{"pat", "plain", true},
+		{"pat", "bad", false},
+		{"eve", "plain", false},
+	}
+	for _, tc := range tests {
+		if got := f.Authenticate(tc.user, tc.pass); got != tc.ok {
+			t.Errorf("Authenticate(%q, %q) = %v, want %v", tc.user, tc.pass, got, tc.ok)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, data, err string
+	}{
+		{"no colon", "bob\n", "line 1: invalid format"},
+		{"empty user", ":pass\n", "line 1: invalid format"},
+		{"duplicate", "bob:a\nbob:b\n", "line 2: duplicate user"},
+		{"md5", "bob:$apr1$abc$def\n", "unsupported hash"},
+		{"md5 crypt", "bob:$1$abc$def\n", "unsupported hash"},
+		{"sha256 crypt", "bob:$5$abc$def\n", "unsupported hash"},
+		{"des crypt", "bob:rqXexS6ZhobKA\n", "unsupported hash"},
+		{"extended des crypt", "bob:_J9..rasmBYk8r9AiWNc\n", "unsupported hash"},
+		{"bad bcrypt", "bob:$2y$xx\n", "bcrypt"},
+		{"bad sha", "bob:{SHA}!!!\n", "sha"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestUsersReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	write := func(data string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	write("bob:pass\n", now.Add(-time.Hour))
+
+	u, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.CheckInterval = 0
+
+	var reloadErr error
+	u.OnReload = func(_ *File, err error) {
+		reloadErr = err
+	}
+
+	if !u.Authenticate("bob", "pass") {
+		t.Fatal("expected bob to authenticate")
+	}
+
+	write("alice:pass\n", now)
+	if u.Authenticate("bob", "pass") {
+		t.Fatal("expected bob to be removed")
+	}
+	if !u.Authenticate("alice", "pass") {
+		t.Fatal("expected alice to authenticate")
+	}
+
+	write("alice\n", now.Add(time.Hour))
+	if !u.Authenticate("alice", "pass") {
+		t.Fatal("expected users to be kept on invalid file")
+	}
+	if reloadErr == nil {
+		t.Fatal("expected reload error")
+	}
+}
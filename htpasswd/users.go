@@ -0,0 +1,111 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package htpasswd
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCheckInterval is the default interval between checks for htpasswd file changes.
+const DefaultCheckInterval = 5 * time.Second
+
+// Users authenticates users from an htpasswd file that is reloaded when it changes.
+// The file modification time and size are checked on authentication, at most once per CheckInterval.
+// If the file cannot be read, the previously loaded users are kept.
+type Users struct {
+	// CheckInterval is the minimum interval between checks for file changes.
+	CheckInterval time.Duration
+	// OnReload is called after the file is reloaded, err is nil if the reload was successful.
+	OnReload func(f *File, err error)
+
+	path string
+
+	mu        sync.Mutex
+	file      *File
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+}
+
+// Open reads the htpasswd file at path and returns Users that reload it on change.
+func Open(path string) (*Users, error) {
+	u := &Users{
+		CheckInterval: DefaultCheckInterval,
+		path:          path,
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	u.file = f
+	u.modTime = fi.ModTime()
+	u.size = fi.Size()
+	u.lastCheck = time.Now()
+
+	return u, nil
+}
+
+// Path returns the path of the htpasswd file.
+func (u *Users) Path() string {
+	return u.path
+}
+
+// File returns the currently loaded file, it reloads the file if it changed.
+func (u *Users) File() *File {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(u.lastCheck) < u.CheckInterval {
+		return u.file
+	}
+	u.lastCheck = now
+
+	fi, err := os.Stat(u.path)
+	if err != nil {
+		u.onReload(nil, err)
+		return u.file
+	}
+	if fi.ModTime().Equal(u.modTime) && fi.Size() == u.size {
+		return u.file
+	}
+
+	f, err := ReadFile(u.path)
+	if err != nil {
+		u.onReload(nil, err)
+		return u.file
+	}
+	u.file = f
+	u.modTime = fi.ModTime()
+	u.size = fi.Size()
+	u.onReload(f, nil)
+
+	return u.file
+}
+
+func (u *Users) onReload(f *File, err error) {
+	if u.OnReload != nil {
+		u.OnReload(f, err)
+	}
+}
+
+// HasUser returns true if the user is in the htpasswd file.
+func (u *Users) HasUser(user string) bool {
+	return u.File().HasUser(user)
+}
+
+// Authenticate returns true if the password matches the user's hash in the htpasswd file.
+func (u *Users) Authenticate(user, pass string) bool {
+	return u.File().Authenticate(user, pass)
+}
@@ -9,6 +9,7 @@ package forwarder
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -18,6 +19,7 @@ import (
 	"net/url"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/saucelabs/forwarder/hostsfile"
@@ -28,6 +30,7 @@ import (
 	"github.com/saucelabs/forwarder/log"
 	"github.com/saucelabs/forwarder/middleware"
 	"github.com/saucelabs/forwarder/pac"
+	"github.com/saucelabs/forwarder/ratelimit"
 	"github.com/saucelabs/forwarder/ruleset"
 	"go.uber.org/multierr"
 	"golang.org/x/sync/errgroup"
@@ -82,9 +85,60 @@ type (
 // that the CONNECT request should be handled by martian.
 var ErrConnectFallback = martian.ErrConnectFallback
 
+// UserAuthenticator authenticates proxy users with username and password, see htpasswd.Users.
+type UserAuthenticator interface {
+	Authenticate(user, pass string) bool
+	HasUser(user string) bool
+}
+
+// TokenAuthenticator authenticates proxy users with bearer tokens, see jwtauth.Validator.
+type TokenAuthenticator interface {
+	AuthenticateToken(token string) (user string, groups []string, err error)
+}
+
 type HTTPProxyConfig struct {
 	HTTPServerConfig
 
+	// BasicAuthUsers enables basic authentication with many users, it cannot be used with BasicAuth.
+	BasicAuthUsers UserAuthenticator
+	// BearerAuth enables authentication with Proxy-Authorization: Bearer tokens, it can be used with basic auth.
+	BearerAuth TokenAuthenticator
+	// AuthLockout locks out client IPs and users after too many failed proxy authentications.
+	AuthLockout AuthLockoutConfig
+	// LoadShedding refuses requests when the proxy is overloaded.
+	LoadShedding LoadSheddingConfig
+	// ACL applies per-user access control rules to authenticated requests, it requires authentication.
+	ACL *ACL
+	// ForwardAuth delegates allow/deny decisions to an external authorization service.
+	ForwardAuth *ForwardAuthConfig
+	// ClientCertIdentity selects the verified client certificate field used as the user identity,
+	// it applies when the protocol is https and client certificates are verified.
+	ClientCertIdentity ClientCertIdentity
+	// ConnectPorts restricts CONNECT requests to these destination ports, if empty all ports are allowed.
+	ConnectPorts []PortRange
+	// ConnectPortRules override ConnectPorts for matching domains, the first matching rule applies.
+	ConnectPortRules []PortRule
+	// HTTPPorts restricts plain HTTP requests to these destination ports, if empty all ports are allowed.
+	HTTPPorts []PortRange
+	// RequestRateLimits limit the rate of requests per destination host, client IP or user, all matching rules apply.
+	RequestRateLimits []RequestRateLimitRule
+	// URLRules allow or deny requests by method, scheme, host, path and query,
+	// they only apply to plain HTTP requests and requests in MITM tunnels.
+	URLRules *URLRules
+
+	// NetworkProfiles are network conditions that can be emulated on client connections,
+	// they are applied per listener, see ListenerConfig.NetworkProfile, or selected per request.
+	// If any profile is defined, dynamic rate limiting is enabled on all listeners, see ListenerConfig.DynamicRateLimit.
+	NetworkProfiles []NetworkProfile
+	// NetworkProfileRules select the network profile by client IP or destination domain, the first matching rule applies.
+	NetworkProfileRules []NetworkProfileRule
+	// NetworkProfileHeader, if set, is the request header selecting the network profile by name.
+	// It takes precedence over the rules, the header is removed from the request.
+	NetworkProfileHeader string
+
+	// ErrorPages if set, error responses are HTML pages or JSON if the client accepts them.
+	ErrorPages *ErrorPages
+
 	ExtraListeners    []NamedListenerConfig
 	Name              string
 	MITM              *MITMConfig
@@ -101,6 +155,10 @@ type HTTPProxyConfig struct {
 	ConnectTimeout    time.Duration
 	PromHTTPOpts      []middleware.PrometheusOpt
 	AllowTimeFrame    []ruleset.TimeFrameEntry
+	// DenyDomainsTimeFrame denies requests to matching domains within the time frames.
+	DenyDomainsTimeFrame []DomainTimeFrameRule
+	// AllowDomainsTimeFrame allows requests to matching domains only within the time frames.
+	AllowDomainsTimeFrame []DomainTimeFrameRule
 	// TestingHTTPHandler uses Martian's [http.Handler] implementation
 	// over [http.Server] instead of the default TCP server.
 	TestingHTTPHandler bool
@@ -118,10 +176,14 @@ func DefaultHTTPProxyConfig() *HTTPProxyConfig {
 				HandshakeTimeout: 10 * time.Second,
 			},
 		},
-		Name:            "forwarder",
-		ProxyLocalhost:  DenyProxyLocalhost,
-		RequestIDHeader: "X-Request-Id",
-		ConnectTimeout:  60 * time.Second, // http.Transport sets a constant 1m timeout for CONNECT requests.
+		AuthLockout:        *DefaultAuthLockoutConfig(),
+		LoadShedding:       *DefaultLoadSheddingConfig(),
+		ClientCertIdentity: ClientCertIdentityCN,
+		ConnectPorts:       []PortRange{{Start: 443, End: 443}},
+		Name:               "forwarder",
+		ProxyLocalhost:     DenyProxyLocalhost,
+		RequestIDHeader:    "X-Request-Id",
+		ConnectTimeout:     60 * time.Second, // http.Transport sets a constant 1m timeout for CONNECT requests.
 	}
 }
 
@@ -133,6 +195,9 @@ func (c *HTTPProxyConfig) Validate() error {
 		if lc.Name == "" {
 			return errors.New("extra listener name is required")
 		}
+		if err := lc.Validate(); err != nil {
+			return fmt.Errorf("listener %s: %w", lc.Name, err)
+		}
 	}
 	if c.Protocol != HTTPScheme && c.Protocol != HTTPSScheme {
 		return fmt.Errorf("unsupported protocol: %s", c.Protocol)
@@ -143,10 +208,78 @@ func (c *HTTPProxyConfig) Validate() error {
 	if err := validateProxyURL(c.UpstreamProxy); err != nil {
 		return fmt.Errorf("upstream_proxy_uri: %w", err)
 	}
+	if c.BasicAuth != nil && c.BasicAuthUsers != nil {
+		return errors.New("cannot use both basic auth and basic auth users")
+	}
+	if c.ClientCertIdentity != "" && !c.ClientCertIdentity.isValid() {
+		return fmt.Errorf("unsupported client_cert_identity: %s", c.ClientCertIdentity)
+	}
+	if c.ACL != nil && c.BasicAuth == nil && c.BasicAuthUsers == nil && c.BearerAuth == nil && !c.clientCertAuth() {
+		return errors.New("ACL requires authentication")
+	}
+	if err := c.LoadShedding.Validate(); err != nil {
+		return fmt.Errorf("load shedding: %w", err)
+	}
+	if err := c.AuthLockout.Validate(); err != nil {
+		return fmt.Errorf("auth lockout: %w", err)
+	}
+	if err := c.validateNetworkProfiles(); err != nil {
+		return fmt.Errorf("network profiles: %w", err)
+	}
+	if c.ForwardAuth != nil {
+		if err := c.ForwardAuth.Validate(); err != nil {
+			return fmt.Errorf("forward auth: %w", err)
+		}
+	}
 
 	return nil
 }
 
+// setReloadable copies the settings that can be changed by HTTPProxy.Reload from cfg.
+func (c *HTTPProxyConfig) setReloadable(cfg *HTTPProxyConfig) {
+	c.BasicAuth = cfg.BasicAuth
+	c.BasicAuthUsers = cfg.BasicAuthUsers
+	c.BearerAuth = cfg.BearerAuth
+	c.ACL = cfg.ACL
+	c.ForwardAuth = cfg.ForwardAuth
+	c.LogHTTPMode = cfg.LogHTTPMode
+	c.MITMDomains = cfg.MITMDomains
+	c.ProxyLocalhost = cfg.ProxyLocalhost
+	c.UpstreamProxy = cfg.UpstreamProxy
+	c.UpstreamProxyFunc = cfg.UpstreamProxyFunc
+	c.DenyDomains = cfg.DenyDomains
+	c.DirectDomains = cfg.DirectDomains
+	c.ConnectPorts = cfg.ConnectPorts
+	c.ConnectPortRules = cfg.ConnectPortRules
+	c.HTTPPorts = cfg.HTTPPorts
+	c.RequestRateLimits = cfg.RequestRateLimits
+	c.URLRules = cfg.URLRules
+	c.ErrorPages = cfg.ErrorPages
+	c.RequestModifiers = cfg.RequestModifiers
+	c.ResponseModifiers = cfg.ResponseModifiers
+	c.AllowTimeFrame = cfg.AllowTimeFrame
+	c.DenyDomainsTimeFrame = cfg.DenyDomainsTimeFrame
+	c.AllowDomainsTimeFrame = cfg.AllowDomainsTimeFrame
+}
+
+// clientCertAuth returns true if users are authenticated with verified client certificates.
+func (c *HTTPProxyConfig) clientCertAuth() bool {
+	return c.Protocol == HTTPSScheme && c.clientAuthMode().verifies()
+}
+
+// userRateLimit returns true if any of the listeners limits bandwidth per user.
+func (c *HTTPProxyConfig) userRateLimit() bool {
+	if c.UserReadLimit > 0 || c.UserWriteLimit > 0 {
+		return true
+	}
+	for _, lc := range c.ExtraListeners {
+		if lc.UserReadLimit > 0 || lc.UserWriteLimit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 type HTTPProxy struct {
 	config HTTPProxyConfig
 
@@ -160,9 +293,24 @@ type HTTPProxy struct {
 	proxyFunc       ProxyFunc
 	kerberosAdapter KerberosAdapter
 	localhost       []string
+	transportProxy  ProxyFunc
+	state           atomic.Pointer[httpProxyState]
+	authLockout     *authLockout
+	loadShedder     *loadShedder
+	netem           *networkEmulator
+	upstreamCheck   *upstreamCheck
 
 	tlsConfig *tls.Config
 	listeners []net.Listener
+	serving   atomic.Bool
+	draining  atomic.Bool
+}
+
+// httpProxyState holds the parts of the proxy that are replaced on Reload.
+type httpProxyState struct {
+	config    *HTTPProxyConfig
+	proxyFunc ProxyFunc
+	mw        martian.RequestResponseModifier
 }
 
 // NewHTTPProxy creates a new HTTP proxy.
@@ -199,6 +347,7 @@ func NewHTTPProxy(cfg *HTTPProxyConfig, pr PACResolver, cm *CredentialsMatcher,
 		return nil, err
 	}
 	hp.listeners = ll
+	hp.applyListenerNetworkProfiles()
 
 	for _, l := range hp.listeners {
 		hp.log.Info("PROXY server listen", "address", l.Addr().String(), "protocol", hp.config.Protocol)
@@ -236,6 +385,10 @@ func newHTTPProxy(cfg *HTTPProxyConfig, pr PACResolver, cm *CredentialsMatcher,
 	} else if tr.TLSClientConfig != nil && tr.TLSClientConfig.RootCAs != nil {
 		log.Info("using custom root CA certificates")
 	}
+	var transportProxy ProxyFunc
+	if tr, ok := rt.(*http.Transport); ok {
+		transportProxy = tr.Proxy
+	}
 	hp := &HTTPProxy{
 		config:          *cfg,
 		pac:             pr,
@@ -245,6 +398,17 @@ func newHTTPProxy(cfg *HTTPProxyConfig, pr PACResolver, cm *CredentialsMatcher,
 		metrics:         newHTTPProxyMetrics(cfg.PromRegistry, cfg.PromNamespace),
 		localhost:       []string{"localhost", "0.0.0.0", "::"},
 		kerberosAdapter: kerberosAdapter,
+		transportProxy:  transportProxy,
+		upstreamCheck:   new(upstreamCheck),
+	}
+	if cfg.AuthLockout.MaxFailures > 0 {
+		hp.authLockout = newAuthLockout(&cfg.AuthLockout, hp.metrics)
+	}
+	if cfg.LoadShedding.enabled() {
+		hp.loadShedder = newLoadShedder(&cfg.LoadShedding, hp.metrics, hp.shouldMITM)
+	}
+	if len(cfg.NetworkProfiles) > 0 {
+		hp.netem = newNetworkEmulator(cfg)
 	}
 
 	if err := hp.configureProxy(); err != nil {
@@ -305,15 +469,31 @@ func (hp *HTTPProxy) configureProxy() error {
 		}
 		hp.proxy.MITMConfig = mc
 
-		if hp.config.MITMDomains != nil {
-			hp.proxy.MITMFilter = func(req *http.Request) bool {
-				return hp.config.MITMDomains.Match(req.URL.Hostname())
-			}
+		hp.proxy.MITMFilter = func(req *http.Request) bool {
+			d := hp.state.Load().config.MITMDomains
+			return d == nil || d.Match(req.URL.Hostname())
 		}
 		hp.proxy.MITMTLSHandshakeTimeout = hp.config.TLSServerConfig.HandshakeTimeout
 	}
 
 	hp.proxy.RoundTripper = hp.transport
+	hp.state.Store(hp.configureState())
+	hp.proxy.ProxyURL = hp.upstreamProxy
+	hp.proxy.RequestModifier = martian.RequestModifierFunc(func(req *http.Request) error {
+		return hp.state.Load().mw.ModifyRequest(req)
+	})
+	hp.proxy.ResponseModifier = martian.ResponseModifierFunc(func(res *http.Response) error {
+		return hp.state.Load().mw.ModifyResponse(res)
+	})
+	if hp.config.PromRegistry != nil || hp.loadShedder != nil {
+		hp.proxy.Trace = hp.proxyTrace()
+	}
+
+	return nil
+}
+
+// configureState builds the proxy function and the middleware stack from the proxy config.
+func (hp *HTTPProxy) configureState() *httpProxyState {
 	switch {
 	case hp.config.UpstreamProxyFunc != nil:
 		hp.log.Info("using external proxy function")
@@ -337,16 +517,67 @@ func (hp *HTTPProxy) configureProxy() error {
 	if hp.config.ProxyLocalhost == DirectProxyLocalhost {
 		hp.proxyFunc = hp.directLocalhost(hp.proxyFunc)
 	}
-	hp.proxy.ProxyURL = hp.proxyFunc
 
-	mw, trace := hp.middlewareStack()
-	hp.proxy.RequestModifier = mw
-	hp.proxy.ResponseModifier = mw
-	hp.proxy.Trace = trace
+	if hp.config.ACL != nil {
+		hp.proxyFunc = hp.userUpstreamProxy(hp.config.ACL, hp.proxyFunc)
+	}
+	if hp.config.ForwardAuth != nil {
+		hp.proxyFunc = hp.forwardAuthUpstreamProxy(hp.proxyFunc)
+	}
+
+	return &httpProxyState{
+		config:    &hp.config,
+		proxyFunc: hp.proxyFunc,
+		mw:        hp.middlewareStack(),
+	}
+}
+
+// Reload replaces the proxy policy with the one built from cfg, pr and cm.
+// Established connections and tunnels are not affected, new requests use the new policy.
+// Only the settings that do not require restarting listeners are taken from cfg, those are:
+// basic auth and basic auth users, bearer auth, user ACL, forward auth, HTTP logging, MITM domains, proxy localhost mode, upstream proxy,
+// deny and direct domains, allowed CONNECT and HTTP ports, request rate limits, URL rules, error pages, request and response modifiers,
+// allowed time frames, and deny and allow domain time frames.
+// If the new config is invalid, an error is returned and the current policy is kept.
+func (hp *HTTPProxy) Reload(cfg *HTTPProxyConfig, pr PACResolver, cm *CredentialsMatcher) error {
+	c := hp.config
+	c.setReloadable(cfg)
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.UpstreamProxy != nil && pr != nil {
+		return errors.New("cannot use both upstream proxy and PAC")
+	}
+
+	// Build the new state on a copy of the proxy, so that the modifiers refer to the new config.
+	nhp := &HTTPProxy{
+		config:          c,
+		pac:             pr,
+		creds:           cm,
+		transport:       hp.transport,
+		log:             hp.log,
+		metrics:         hp.metrics,
+		kerberosAdapter: hp.kerberosAdapter,
+		localhost:       hp.localhost,
+		authLockout:     hp.authLockout,
+		loadShedder:     hp.loadShedder,
+		netem:           hp.netem,
+		upstreamCheck:   hp.upstreamCheck,
+	}
+	hp.state.Store(nhp.configureState())
 
 	return nil
 }
 
+// shouldMITM reports if the CONNECT request is going to be MITMed, see martian.Proxy.MITMFilter.
+func (hp *HTTPProxy) shouldMITM(req *http.Request) bool {
+	if hp.proxy == nil || hp.proxy.MITMConfig == nil {
+		return false
+	}
+	return hp.proxy.MITMFilter == nil || hp.proxy.MITMFilter(req)
+}
+
 func (hp *HTTPProxy) upstreamProxyURL() *url.URL {
 	proxyURL := new(url.URL)
 	*proxyURL = *hp.config.UpstreamProxy
@@ -401,15 +632,59 @@ func (hp *HTTPProxy) pacProxy(r *http.Request) (*url.URL, error) {
 	return proxyURL, nil
 }
 
-func (hp *HTTPProxy) middlewareStack() (martian.RequestResponseModifier, *martian.ProxyTrace) {
-	var trace *martian.ProxyTrace
+func (hp *HTTPProxy) upstreamProxy(req *http.Request) (*url.URL, error) {
+	if fn := hp.state.Load().proxyFunc; fn != nil {
+		return fn(req)
+	}
+	if hp.transportProxy != nil {
+		return hp.transportProxy(req)
+	}
+	return nil, nil
+}
+
+// proxyTrace reports requests to prometheus, and uncounts requests of the load shedder after the response is written.
+func (hp *HTTPProxy) proxyTrace() *martian.ProxyTrace {
+	var p *middleware.Prometheus
+	if hp.config.PromRegistry != nil {
+		p = middleware.NewPrometheus(hp.config.PromRegistry, hp.config.PromNamespace, hp.config.PromHTTPOpts...)
+	}
+	s := hp.loadShedder
+
+	trace := new(martian.ProxyTrace)
+	trace.ReadRequest = func(info martian.ReadRequestInfo) {
+		if info.Req != nil && p != nil {
+			p.ReadRequest(info.Req)
+		}
+	}
+	trace.WroteResponse = func(info martian.WroteResponseInfo) {
+		if info.Res == nil {
+			return
+		}
+		if p != nil {
+			p.WroteResponse(info.Res)
+		}
+		if s != nil {
+			s.done(info.Res)
+		}
+	}
+	return trace
+}
 
+func (hp *HTTPProxy) middlewareStack() martian.RequestResponseModifier {
 	// Wrap stack in a group so that we can run security checks before the httpspec modifiers.
 	topg := fifo.NewGroup()
 
+	if hp.loadShedder != nil {
+		hp.log.Info("load shedding enabled",
+			"max_requests", hp.config.LoadShedding.MaxRequests,
+			"max_tunnels", hp.config.LoadShedding.MaxTunnels,
+			"memory_limit_ratio", hp.config.LoadShedding.MemoryLimitRatio)
+		topg.AddRequestModifier(hp.loadShedding(hp.loadShedder))
+	}
+
 	if len(hp.config.AllowTimeFrame) > 0 {
 		for _, entry := range hp.config.AllowTimeFrame {
-			hp.log.Info("Adding AllowTimeFrame entry", "weekday", entry.Weekday.String(), "hourStart", entry.HourStart, "hourEnd", entry.HourEnd)
+			hp.log.Info("Adding AllowTimeFrame entry", "entry", entry.String(), "location", entry.Location)
 		}
 
 		currentTime := time.Now()
@@ -419,9 +694,32 @@ func (hp *HTTPProxy) middlewareStack() (martian.RequestResponseModifier, *martia
 		topg.AddRequestModifier(hp.allowWithinTimeFrame())
 	}
 
+	if hp.config.clientCertAuth() {
+		id := hp.config.ClientCertIdentity
+		if id == "" {
+			id = ClientCertIdentityCN
+		}
+		hp.log.Info("client certificate auth enabled", "identity", id)
+		topg.AddRequestModifier(hp.clientCertAuth(id))
+	}
+	var users UserAuthenticator
 	if hp.config.BasicAuth != nil {
 		hp.log.Info("basic auth enabled")
-		topg.AddRequestModifier(hp.basicAuth(hp.config.BasicAuth))
+		users = singleUser{hp.config.BasicAuth}
+	}
+	if hp.config.BasicAuthUsers != nil {
+		hp.log.Info("basic auth enabled with users")
+		users = hp.config.BasicAuthUsers
+	}
+	if hp.config.BearerAuth != nil {
+		hp.log.Info("bearer token auth enabled")
+	}
+	if users != nil || hp.config.BearerAuth != nil {
+		topg.AddRequestModifier(hp.proxyAuth(users, hp.config.BearerAuth))
+	}
+	if hp.config.ACL != nil {
+		hp.log.Info("user ACL enabled")
+		topg.AddRequestModifier(hp.userACL(hp.config.ACL))
 	}
 	if hp.config.ProxyLocalhost == DenyProxyLocalhost {
 		topg.AddRequestModifier(hp.denyLocalhost())
@@ -429,6 +727,32 @@ func (hp *HTTPProxy) middlewareStack() (martian.RequestResponseModifier, *martia
 	if hp.config.DenyDomains != nil {
 		topg.AddRequestModifier(hp.denyDomains(hp.config.DenyDomains))
 	}
+	if len(hp.config.DenyDomainsTimeFrame) > 0 || len(hp.config.AllowDomainsTimeFrame) > 0 {
+		topg.AddRequestModifier(hp.domainTimeFrames(hp.config.DenyDomainsTimeFrame, hp.config.AllowDomainsTimeFrame))
+	}
+	if len(hp.config.ConnectPorts) > 0 || len(hp.config.ConnectPortRules) > 0 || len(hp.config.HTTPPorts) > 0 {
+		topg.AddRequestModifier(hp.denyPorts(hp.config.ConnectPorts, hp.config.ConnectPortRules, hp.config.HTTPPorts))
+	}
+	if hp.config.URLRules != nil {
+		hp.log.Info("URL rules enabled")
+		topg.AddRequestModifier(hp.urlRules(hp.config.URLRules))
+	}
+	if hp.config.ForwardAuth != nil {
+		hp.log.Info("forward auth enabled", "url", hp.config.ForwardAuth.URL.Redacted())
+		topg.AddRequestModifier(hp.forwardAuth(hp.config.ForwardAuth))
+	}
+	if len(hp.config.RequestRateLimits) > 0 {
+		hp.log.Info("request rate limits enabled", "rules", len(hp.config.RequestRateLimits))
+		topg.AddRequestModifier(hp.requestRateLimit(hp.config.RequestRateLimits))
+	}
+	if hp.config.userRateLimit() {
+		topg.AddRequestModifier(hp.userRateLimit())
+	}
+
+	if hp.netem != nil {
+		hp.log.Info("network emulation enabled", "profiles", len(hp.config.NetworkProfiles))
+		topg.AddRequestModifier(hp.networkProfile(hp.netem))
+	}
 
 	// stack contains the request/response modifiers in the order they are applied.
 	// fg is the inner stack that is executed after the core request modifiers and before the core response modifiers.
@@ -462,37 +786,111 @@ func (hp *HTTPProxy) middlewareStack() (martian.RequestResponseModifier, *martia
 		fg.AddResponseModifier(lf)
 	}
 
-	if hp.config.PromRegistry != nil {
-		p := middleware.NewPrometheus(hp.config.PromRegistry, hp.config.PromNamespace, hp.config.PromHTTPOpts...)
-
-		trace = new(martian.ProxyTrace)
-		trace.ReadRequest = func(info martian.ReadRequestInfo) {
-			if info.Req != nil {
-				p.ReadRequest(info.Req)
-			}
-		}
-		trace.WroteResponse = func(info martian.WroteResponseInfo) {
-			if info.Res != nil {
-				p.WroteResponse(info.Res)
-			}
-		}
-	}
-
 	fg.AddRequestModifier(martian.RequestModifierFunc(hp.setBasicAuth))
 	fg.AddRequestModifier(martian.RequestModifierFunc(setEmptyUserAgent))
 
-	return topg.ToImmutable(), trace
+	return topg.ToImmutable()
+}
+
+// singleUser authenticates the user from the BasicAuth config.
+type singleUser struct {
+	u *url.Userinfo
+}
+
+func (s singleUser) Authenticate(user, pass string) bool {
+	p, _ := s.u.Password()
+	return subtle.ConstantTimeCompare([]byte(user), []byte(s.u.Username())) == 1 &&
+		subtle.ConstantTimeCompare([]byte(pass), []byte(p)) == 1
 }
 
-func (hp *HTTPProxy) basicAuth(u *url.Userinfo) martian.RequestModifier {
-	user := u.Username()
-	pass, _ := u.Password()
+func (s singleUser) HasUser(user string) bool {
+	return user == s.u.Username()
+}
+
+// proxyAuth authenticates requests with the Proxy-Authorization header.
+// Bearer tokens are checked with tokens and basic credentials with users, either of them can be nil.
+// The authenticated user is attached to the request context, failed logins are counted per user.
+// If auth lockout is enabled, client IPs and users with too many failed authentications are rejected.
+// A successful authentication only resets the failures of the user, failures of the client IP expire after the lockout window
+// so that logging in with a valid account between guesses does not prevent the client IP lockout.
+func (hp *HTTPProxy) proxyAuth(users UserAuthenticator, tokens TokenAuthenticator) martian.RequestModifier {
 	ba := middleware.NewProxyBasicAuth()
 
 	return martian.RequestModifierFunc(func(req *http.Request) error {
-		if !ba.AuthenticatedRequest(req, user, pass) {
+		// The user is already authenticated with a client certificate.
+		if martian.ContextUser(req.Context()) != "" {
+			return nil
+		}
+
+		lo := hp.authLockout
+		ipKey := clientIPKey(req)
+		if lo != nil {
+			if err := lo.check(ipKey); err != nil {
+				return err
+			}
+		}
+
+		if tokens != nil {
+			if token, ok := ba.BearerToken(req); ok {
+				user, groups, err := tokens.AuthenticateToken(token)
+				if err != nil {
+					hp.log.Debug("bearer token authentication failed", "error", err)
+					hp.metrics.authFailure("unknown")
+					if lo != nil {
+						lo.failure(ipKey)
+					}
+					return ErrProxyAuthentication
+				}
+				martian.SetContextUser(req.Context(), user)
+				setContextUserGroups(req.Context(), groups)
+				return nil
+			}
+		}
+		if users == nil {
+			return ErrProxyAuthentication
+		}
+		user, pass, ok := ba.BasicAuth(req)
+		if !ok {
 			return ErrProxyAuthentication
 		}
+		if lo != nil {
+			if err := lo.check(userKey(user)); err != nil {
+				return err
+			}
+		}
+		if !users.Authenticate(user, pass) {
+			if !users.HasUser(user) {
+				user = "unknown"
+			}
+			hp.metrics.authFailure(user)
+			if lo != nil {
+				if user != "unknown" {
+					lo.failure(ipKey, userKey(user))
+				} else {
+					lo.failure(ipKey)
+				}
+			}
+			return ErrProxyAuthentication
+		}
+		if lo != nil {
+			lo.success(userKey(user))
+		}
+		martian.SetContextUser(req.Context(), user)
+		return nil
+	})
+}
+
+// userRateLimit applies the per-user bandwidth limits to the client connection of authenticated requests,
+// including CONNECT tunnels.
+func (hp *HTTPProxy) userRateLimit() martian.RequestModifier {
+	return martian.RequestModifierFunc(func(req *http.Request) error {
+		user := martian.ContextUser(req.Context())
+		if user == "" {
+			return nil
+		}
+		if conn := martian.ContextConn(req.Context()); conn != nil {
+			ratelimit.SetConnUser(conn, user)
+		}
 		return nil
 	})
 }
@@ -651,7 +1049,7 @@ func (hp *HTTPProxy) MITMCACert() *x509.Certificate {
 }
 
 func (hp *HTTPProxy) ProxyFunc() ProxyFunc {
-	return hp.proxyFunc
+	return hp.state.Load().proxyFunc
 }
 
 func (hp *HTTPProxy) handler() http.Handler {
@@ -696,12 +1094,13 @@ func (hp *HTTPProxy) runHTTPHandler(ctx context.Context) error {
 		l := hp.listeners[i]
 		g.Go(func() error {
 			err := srv.Serve(l)
-			if errors.Is(err, http.ErrServerClosed) {
+			if errors.Is(err, http.ErrServerClosed) || errors.Is(err, net.ErrClosed) {
 				err = nil
 			}
 			return err
 		})
 	}
+	hp.serving.Store(true)
 	return g.Wait()
 }
 
@@ -742,6 +1141,7 @@ func (hp *HTTPProxy) run(ctx context.Context) error {
 			return err
 		})
 	}
+	hp.serving.Store(true)
 	return g.Wait()
 }
 
@@ -752,9 +1152,20 @@ func (hp *HTTPProxy) listen() ([]net.Listener, error) {
 		return nil, fmt.Errorf("invalid protocol %q", hp.config.Protocol)
 	}
 
-	if len(hp.config.ExtraListeners) == 0 {
+	lc := hp.config.ListenerConfig
+	extra := hp.config.ExtraListeners
+	if hp.netem != nil {
+		// Network profiles can be applied to any connection at runtime.
+		lc.DynamicRateLimit = true
+		extra = slices.Clone(extra)
+		for i := range extra {
+			extra[i].DynamicRateLimit = true
+		}
+	}
+
+	if len(extra) == 0 {
 		l := &Listener{
-			ListenerConfig: hp.config.ListenerConfig,
+			ListenerConfig: lc,
 			TLSConfig:      hp.tlsConfig,
 			PromConfig: PromConfig{
 				PromNamespace: hp.config.PromNamespace,
@@ -768,7 +1179,7 @@ func (hp *HTTPProxy) listen() ([]net.Listener, error) {
 	}
 
 	return MultiListener{
-		ListenerConfigs: append([]NamedListenerConfig{{ListenerConfig: hp.config.ListenerConfig}}, hp.config.ExtraListeners...),
+		ListenerConfigs: append([]NamedListenerConfig{{ListenerConfig: lc}}, extra...),
 		TLSConfig: func(lc NamedListenerConfig) *tls.Config {
 			return hp.tlsConfig
 		},
@@ -776,6 +1187,12 @@ func (hp *HTTPProxy) listen() ([]net.Listener, error) {
 	}.Listen()
 }
 
+// Listeners returns the proxy listeners, the first one is configured with ListenerConfig
+// and the rest with ExtraListeners in the same order.
+func (hp *HTTPProxy) Listeners() []net.Listener {
+	return hp.listeners
+}
+
 // Addr returns the address the server is listening on.
 func (hp *HTTPProxy) Addr() (addrs []string, ok bool) {
 	addrs = make([]string, len(hp.listeners))
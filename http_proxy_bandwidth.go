@@ -0,0 +1,213 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/saucelabs/forwarder/ratelimit"
+)
+
+var (
+	errConnNotFound      = fmt.Errorf("connection %w", errNotFound)
+	errNotRateLimited    = errors.New("bandwidth limits are not enabled, set a limit or enable dynamic rate limit")
+	errListenerNotFound  = fmt.Errorf("listener %w", errNotFound)
+	errConnBandwidthArgs = errors.New("only read and write limits can be set for a connection")
+)
+
+// ListenerBandwidth holds the bandwidth limits of a listener in bytes per second, zero means no limit.
+// See ListenerConfig for the meaning of the limits.
+type ListenerBandwidth struct {
+	// Name is the listener name, empty for the main listener, see HTTPProxyConfig.ExtraListeners.
+	Name           string
+	ReadLimit      SizeSuffix
+	WriteLimit     SizeSuffix
+	ConnReadLimit  SizeSuffix
+	ConnWriteLimit SizeSuffix
+}
+
+func (hp *HTTPProxy) listenerName(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return hp.config.ExtraListeners[i-1].Name
+}
+
+func (hp *HTTPProxy) listenerRateLimiter(name string) (*ratelimit.Listener, error) {
+	for i, l := range hp.listeners {
+		if hp.listenerName(i) != name {
+			continue
+		}
+		if fl, ok := l.(*Listener); ok && fl.rl != nil {
+			return fl.rl, nil
+		}
+		return nil, errNotRateLimited
+	}
+	return nil, fmt.Errorf("%w: %q", errListenerNotFound, name)
+}
+
+func listenerBandwidth(name string, rl *ratelimit.Listener) ListenerBandwidth {
+	b := ListenerBandwidth{Name: name}
+	r, w := rl.Limits()
+	b.ReadLimit, b.WriteLimit = SizeSuffix(r), SizeSuffix(w)
+	r, w = rl.ConnLimits()
+	b.ConnReadLimit, b.ConnWriteLimit = SizeSuffix(r), SizeSuffix(w)
+	return b
+}
+
+// ListenerBandwidth returns the current bandwidth limits of the listeners that limit bandwidth.
+func (hp *HTTPProxy) ListenerBandwidth() []ListenerBandwidth {
+	var res []ListenerBandwidth
+	for i, l := range hp.listeners {
+		if fl, ok := l.(*Listener); ok && fl.rl != nil {
+			res = append(res, listenerBandwidth(hp.listenerName(i), fl.rl))
+		}
+	}
+	return res
+}
+
+// SetListenerBandwidth changes the bandwidth limits of the listener with the given name.
+// The connection limits apply to new connections, existing connections keep their limits, see SetConnBandwidth.
+// The listener must be started with a bandwidth limit or with DynamicRateLimit enabled.
+func (hp *HTTPProxy) SetListenerBandwidth(b ListenerBandwidth) error {
+	rl, err := hp.listenerRateLimiter(b.Name)
+	if err != nil {
+		return err
+	}
+
+	rl.SetLimits(int64(b.ReadLimit), int64(b.WriteLimit))
+	rl.SetConnLimits(int64(b.ConnReadLimit), int64(b.ConnWriteLimit))
+
+	hp.log.Info("listener bandwidth limits changed", "listener", b.Name,
+		"read_limit", b.ReadLimit, "write_limit", b.WriteLimit,
+		"conn_read_limit", b.ConnReadLimit, "conn_write_limit", b.ConnWriteLimit)
+
+	return nil
+}
+
+// SetConnBandwidth changes the bandwidth limits of the client connection with the given ID, see Conns.
+// It replaces the per-connection limits of the listener for that connection, other limits still apply.
+func (hp *HTTPProxy) SetConnBandwidth(id uint64, readLimit, writeLimit SizeSuffix) error {
+	conn := hp.proxy.Conn(id)
+	if conn == nil {
+		return errConnNotFound
+	}
+	if !ratelimit.SetConnLimits(conn, int64(readLimit), int64(writeLimit)) {
+		return errNotRateLimited
+	}
+
+	hp.log.Info("connection bandwidth limits changed", "id", id, "read_limit", readLimit, "write_limit", writeLimit)
+
+	return nil
+}
+
+type bandwidthz struct {
+	Listener       string `json:"listener"`
+	ReadLimit      int64  `json:"read_limit"`
+	WriteLimit     int64  `json:"write_limit"`
+	ConnReadLimit  int64  `json:"conn_read_limit"`
+	ConnWriteLimit int64  `json:"conn_write_limit"`
+}
+
+// BandwidthzHandler returns a handler that lists the bandwidth limits of the listeners as JSON.
+// Limits are in bytes per second, zero means no limit.
+func (hp *HTTPProxy) BandwidthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		lb := hp.ListenerBandwidth()
+		res := make([]bandwidthz, 0, len(lb))
+		for _, b := range lb {
+			res = append(res, bandwidthz{
+				Listener:       b.Name,
+				ReadLimit:      int64(b.ReadLimit),
+				WriteLimit:     int64(b.WriteLimit),
+				ConnReadLimit:  int64(b.ConnReadLimit),
+				ConnWriteLimit: int64(b.ConnWriteLimit),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res) //nolint:errcheck // ignore error
+	})
+}
+
+// SetBandwidthHandler returns a handler that changes bandwidth limits.
+// The limits are given in the read-limit, write-limit, read-limit-per-connection and write-limit-per-connection
+// query parameters in the same format as the flags, limits that are not given are not changed.
+// If the id query parameter is set, the read and write limits of the client connection with that ID are changed.
+// Otherwise, the limits of the listener given in the listener query parameter, or the main listener, are changed.
+// It only accepts POST requests.
+func (hp *HTTPProxy) SetBandwidthHandler() http.Handler {
+	return postHandler(hp.setBandwidth)
+}
+
+func (hp *HTTPProxy) setBandwidth(r *http.Request) error {
+	q := r.URL.Query()
+
+	limit := func(name string, v *SizeSuffix) error {
+		if !q.Has(name) {
+			return nil
+		}
+		if err := v.Set(q.Get(name)); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return nil
+	}
+
+	if q.Has("id") {
+		id, err := strconv.ParseUint(q.Get("id"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid id: %w", err)
+		}
+		if q.Has("listener") || q.Has("read-limit-per-connection") || q.Has("write-limit-per-connection") {
+			return errConnBandwidthArgs
+		}
+
+		conn := hp.proxy.Conn(id)
+		if conn == nil {
+			return errConnNotFound
+		}
+		rl, wl, ok := ratelimit.ConnLimits(conn)
+		if !ok {
+			return errNotRateLimited
+		}
+		readLimit, writeLimit := SizeSuffix(rl), SizeSuffix(wl)
+		if err := limit("read-limit", &readLimit); err != nil {
+			return err
+		}
+		if err := limit("write-limit", &writeLimit); err != nil {
+			return err
+		}
+		return hp.SetConnBandwidth(id, readLimit, writeLimit)
+	}
+
+	name := q.Get("listener")
+	rl, err := hp.listenerRateLimiter(name)
+	if err != nil {
+		return err
+	}
+	b := listenerBandwidth(name, rl)
+
+	for _, p := range []struct {
+		name string
+		v    *SizeSuffix
+	}{
+		{"read-limit", &b.ReadLimit},
+		{"write-limit", &b.WriteLimit},
+		{"read-limit-per-connection", &b.ConnReadLimit},
+		{"write-limit-per-connection", &b.ConnWriteLimit},
+	} {
+		if err := limit(p.name, p.v); err != nil {
+			return err
+		}
+	}
+
+	return hp.SetListenerBandwidth(b)
+}
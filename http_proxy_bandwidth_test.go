@@ -0,0 +1,58 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/saucelabs/forwarder/log/slog"
+)
+
+func TestSetBandwidthHandler(t *testing.T) {
+	cfg := DefaultHTTPProxyConfig()
+	cfg.Address = "localhost:0"
+	cfg.DynamicRateLimit = true
+
+	p, err := NewHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	post := func(query string) int {
+		rw := httptest.NewRecorder()
+		p.SetBandwidthHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/admin/bandwidth?"+query, http.NoBody))
+		return rw.Code
+	}
+
+	if got := post("read-limit=1Mi&write-limit-per-connection=2Mi"); got != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, got)
+	}
+	if got := post("write-limit=512Ki"); got != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, got)
+	}
+	lb := p.ListenerBandwidth()
+	if len(lb) != 1 {
+		t.Fatalf("expected one listener, got %d", len(lb))
+	}
+	if want := (ListenerBandwidth{ReadLimit: Mebi, WriteLimit: 512 * Kibi, ConnWriteLimit: 2 * Mebi}); lb[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, lb[0])
+	}
+
+	for query, code := range map[string]int{
+		"read-limit=foo":                   http.StatusBadRequest,
+		"listener=foo":                     http.StatusNotFound,
+		"id=1":                             http.StatusNotFound,
+		"id=1&read-limit-per-connection=1": http.StatusBadRequest,
+	} {
+		if got := post(query); got != code {
+			t.Errorf("%s: expected %d, got %d", query, code, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+	"github.com/saucelabs/forwarder/ratelimit"
+)
+
+// ConnInfo is a snapshot of a client connection state.
+type ConnInfo = martian.ConnInfo
+
+// Conns returns the client connections handled by the proxy ordered by ID.
+func (hp *HTTPProxy) Conns() []ConnInfo {
+	return hp.proxy.Conns()
+}
+
+// CloseConn closes the client connection with the given ID, and if it is a tunnel, the upstream connection.
+// It returns false if there is no such connection.
+func (hp *HTTPProxy) CloseConn(id uint64) bool {
+	return hp.proxy.CloseConn(id)
+}
+
+type connz struct {
+	ID         uint64    `json:"id"`
+	ClientAddr string    `json:"client_addr"`
+	Host       string    `json:"host,omitempty"`
+	Upstream   string    `json:"upstream,omitempty"`
+	Tunnel     string    `json:"tunnel,omitempty"`
+	MITM       bool      `json:"mitm"`
+	Start      time.Time `json:"start"`
+	Duration   string    `json:"duration"`
+	Rx         *uint64   `json:"rx_bytes,omitempty"`
+	Tx         *uint64   `json:"tx_bytes,omitempty"`
+	ReadLimit  *int64    `json:"read_limit,omitempty"`
+	WriteLimit *int64    `json:"write_limit,omitempty"`
+	Profile    string    `json:"network_profile,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	User       string    `json:"user,omitempty"`
+}
+
+// ConnzHandler returns a handler that lists the client connections as JSON.
+// Received and sent bytes are only reported if the listener tracks traffic, see ListenerConfig.TrackTraffic.
+// Bytes sent to the client through a tunnel may only be accounted when the tunnel is closed.
+// Connection bandwidth limits are only reported if the listener limits bandwidth, see SetConnBandwidth.
+func (hp *HTTPProxy) ConnzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		conns := hp.Conns()
+		res := make([]connz, 0, len(conns))
+		for _, ci := range conns {
+			c := connz{
+				ID:         ci.ID,
+				ClientAddr: ci.ClientAddr,
+				Host:       ci.Host,
+				Upstream:   ci.Upstream,
+				Tunnel:     ci.Tunnel,
+				MITM:       ci.MITM,
+				Start:      ci.Start,
+				Duration:   ci.Duration().Truncate(time.Millisecond).String(),
+				RequestID:  ci.RequestID,
+				User:       ci.User,
+			}
+			if ci.HasTraffic {
+				c.Rx = &ci.Rx
+				c.Tx = &ci.Tx
+			}
+			if rl, wl, ok := ratelimit.ConnLimits(ci.Conn); ok {
+				c.ReadLimit = &rl
+				c.WriteLimit = &wl
+				c.Profile = profileName(ratelimit.ConnProfile(ci.Conn))
+			}
+			res = append(res, c)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res) //nolint:errcheck // ignore error
+	})
+}
+
+// CloseConnHandler returns a handler that closes the client connection with the ID given in the id query parameter.
+// It only accepts POST requests.
+func (hp *HTTPProxy) CloseConnHandler() http.Handler {
+	return postHandler(func(r *http.Request) error {
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid id: %w", err)
+		}
+		if !hp.CloseConn(id) {
+			return errConnNotFound
+		}
+
+		hp.log.Info("closed connection on API request", "id", id)
+
+		return nil
+	})
+}
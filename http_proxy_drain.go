@@ -0,0 +1,132 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// upstreamDialTimeout is the maximum time to wait for the upstream proxy readiness check.
+const upstreamDialTimeout = time.Second
+
+// upstreamCheckTTL is the time the upstream proxy readiness check result is cached,
+// so that frequent probes do not open a connection to the upstream proxy each.
+const upstreamCheckTTL = 5 * time.Second
+
+// Drain stops accepting new connections, existing connections are served until they are closed by the client
+// or the proxy is shut down.
+// After Drain the proxy is not ready, see ReadinessChecks.
+func (hp *HTTPProxy) Drain() error {
+	if !hp.draining.CompareAndSwap(false, true) {
+		return nil
+	}
+	hp.log.Info("draining, new connections will not be accepted")
+	return hp.Close()
+}
+
+// Draining returns true if Drain was called.
+func (hp *HTTPProxy) Draining() bool {
+	return hp.draining.Load()
+}
+
+// ReadinessChecks returns the proxy readiness checks, those are:
+//   - listeners: the proxy is accepting connections and is not draining,
+//   - upstream: the upstream proxy, if configured, accepts TCP connections,
+//     upstream proxies selected by PAC or ACL rules are not checked.
+func (hp *HTTPProxy) ReadinessChecks() ReadinessChecks {
+	return ReadinessChecks{
+		{Name: "listeners", Check: hp.checkListeners},
+		{Name: "upstream", Check: hp.checkUpstream},
+	}
+}
+
+func (hp *HTTPProxy) checkListeners(_ context.Context) error {
+	if hp.draining.Load() {
+		return errors.New("draining")
+	}
+	if !hp.serving.Load() {
+		return errors.New("not accepting connections")
+	}
+	return nil
+}
+
+// upstreamCheck caches the result of the upstream proxy readiness check.
+type upstreamCheck struct {
+	mu      sync.Mutex
+	addr    string
+	checked time.Time
+	err     error
+}
+
+func (hp *HTTPProxy) checkUpstream(ctx context.Context) error {
+	u := hp.state.Load().config.UpstreamProxy
+	if u == nil {
+		return nil
+	}
+	addr := upstreamProxyAddr(u)
+
+	uc := hp.upstreamCheck
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if uc.addr == addr && time.Since(uc.checked) < upstreamCheckTTL {
+		return uc.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, upstreamDialTimeout)
+	defer cancel()
+
+	conn, err := hp.dialUpstream(ctx, addr)
+	if err == nil {
+		conn.Close()
+	}
+	uc.addr, uc.checked, uc.err = addr, time.Now(), err
+
+	return err
+}
+
+// dialUpstream dials the upstream proxy with the transport dialer if available,
+// so that the dial settings, like DNS servers and denied networks, apply.
+func (hp *HTTPProxy) dialUpstream(ctx context.Context, addr string) (net.Conn, error) {
+	if tr, ok := hp.transport.(*http.Transport); ok && tr.DialContext != nil {
+		return tr.DialContext(ctx, "tcp", addr)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// upstreamProxyAddr returns the host:port of the upstream proxy, using the default port of the scheme if not set.
+func upstreamProxyAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "socks5":
+		port = "1080"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// DrainHandler returns a handler that drains the proxy, see Drain.
+// It only accepts POST requests.
+func (hp *HTTPProxy) DrainHandler() http.Handler {
+	return postHandler(func(_ *http.Request) error {
+		if err := hp.Drain(); err != nil {
+			hp.log.Debug("failed to close listeners", "error", err)
+		}
+		return nil
+	})
+}
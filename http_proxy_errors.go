@@ -13,12 +13,15 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
 	"os"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/saucelabs/forwarder/internal/martian"
 	"github.com/saucelabs/forwarder/internal/martian/proxyutil"
@@ -43,10 +46,24 @@ var (
 	ErrProxyOutsideAllowedTimeframe = prohibitedError{errors.New("proxying denied outside allowed time frame")}
 )
 
-const skipMetricsLabel = "-"
+// Labels of errors that are responses to the proxy policy, they are not counted in metrics.
+const (
+	deniedLabel     = "denied"
+	prohibitedLabel = "prohibited"
+)
+
+func skipMetrics(label string) bool {
+	return label == deniedLabel || label == prohibitedLabel
+}
+
+// retryAfterError is implemented by errors that set the Retry-After header of the error response.
+type retryAfterError interface {
+	RetryAfter() time.Duration
+}
 
 func (hp *HTTPProxy) errorResponse(req *http.Request, err error) *http.Response {
 	handlers := []errorHandler{
+		handleDestinationDeniedError,
 		handleWindowsNetError,
 		handleNetError,
 		handleTLSRecordHeader,
@@ -55,8 +72,15 @@ func (hp *HTTPProxy) errorResponse(req *http.Request, err error) *http.Response
 		handleTLSAlertError,
 		handleMartianErrorStatus,
 		handleAuthenticationError,
+		handleAuthLockedError,
+		handleRateLimitedError,
+		handleOverloadedError,
+		handleNetworkProfileError,
 		handleDenyError,
+		handlePortDeniedError,
+		handleURLRuleError,
 		handleProhibitedError,
+		handleForwardAuthError,
 		handleContextCancelationError,
 		handleStatusText,
 	}
@@ -78,30 +102,67 @@ func (hp *HTTPProxy) errorResponse(req *http.Request, err error) *http.Response
 		label = "unexpected_error"
 	}
 
-	if label != skipMetricsLabel {
+	if !skipMetrics(label) {
 		hp.metrics.error(label)
 	}
 
+	cfg := hp.state.Load().config
+
 	var body bytes.Buffer
-	body.WriteString(hp.config.Name)
-	body.WriteString(" ")
-	body.WriteString(msg)
-	body.WriteString("\n")
-	body.WriteString(err.Error())
-	body.WriteString("\n")
+	page, contentType := hp.renderErrorPage(cfg, req, err, code, msg, label)
+	if page != nil {
+		body.Write(page)
+	} else {
+		body.WriteString(cfg.Name)
+		body.WriteString(" ")
+		body.WriteString(msg)
+		body.WriteString("\n")
+		body.WriteString(err.Error())
+		body.WriteString("\n")
+		contentType = "text/plain; charset=utf-8"
+	}
 
 	resp := proxyutil.NewResponse(code, &body, req)
 	if code == http.StatusProxyAuthRequired {
-		resp.Header.Set("Proxy-Authenticate", fmt.Sprintf("Basic realm=%q", hp.config.Name))
+		for _, c := range proxyAuthChallenges(cfg) {
+			resp.Header.Add("Proxy-Authenticate", c)
+		}
+	}
+	var ra retryAfterError
+	if errors.As(err, &ra) {
+		resp.Header.Set("Retry-After", strconv.Itoa(int(math.Ceil(ra.RetryAfter().Seconds()))))
 	}
-	resp.Header.Set(ErrorHeader, hp.config.Name+" "+err.Error())
-	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set(ErrorHeader, cfg.Name+" "+err.Error())
+	resp.Header.Set("Content-Type", contentType)
 	resp.ContentLength = int64(body.Len())
 	return resp
 }
 
+// proxyAuthChallenges returns the Proxy-Authenticate challenges for the authentication methods enabled in cfg.
+// Basic is also offered with forward auth, as the authorization service checks the client credentials.
+func proxyAuthChallenges(cfg *HTTPProxyConfig) []string {
+	var res []string
+	if cfg.BasicAuth != nil || cfg.BasicAuthUsers != nil || cfg.ForwardAuth != nil {
+		res = append(res, fmt.Sprintf("Basic realm=%q", cfg.Name))
+	}
+	if cfg.BearerAuth != nil {
+		res = append(res, fmt.Sprintf("Bearer realm=%q", cfg.Name))
+	}
+	return res
+}
+
 type errorHandler func(*http.Request, error) (int, string, string)
 
+func handleDestinationDeniedError(req *http.Request, err error) (code int, msg, label string) {
+	if errors.Is(err, ErrDestinationDenied) {
+		code = http.StatusForbidden
+		msg = fmt.Sprintf("proxying is denied to host %q", req.Host)
+		label = "destination_denied"
+	}
+
+	return
+}
+
 func handleWindowsNetError(req *http.Request, err error) (code int, msg, label string) {
 	if runtime.GOOS != "windows" {
 		return
@@ -222,12 +283,73 @@ func handleAuthenticationError(req *http.Request, err error) (code int, msg, lab
 	return
 }
 
+func handleAuthLockedError(_ *http.Request, err error) (code int, msg, label string) {
+	if errors.Is(err, ErrProxyAuthLocked) {
+		code = http.StatusTooManyRequests
+		msg = "client IP or user is temporarily locked out after failed proxy authentications"
+		label = "auth_lockout"
+	}
+
+	return
+}
+
+func handleRateLimitedError(req *http.Request, err error) (code int, msg, label string) {
+	if errors.Is(err, ErrProxyRateLimited) {
+		code = http.StatusTooManyRequests
+		msg = fmt.Sprintf("too many requests to host %q", req.Host)
+		label = "rate_limited"
+	}
+
+	return
+}
+
+func handleOverloadedError(req *http.Request, err error) (code int, msg, label string) {
+	if errors.Is(err, ErrProxyOverloaded) {
+		code = http.StatusServiceUnavailable
+		msg = fmt.Sprintf("proxy is overloaded, cannot serve host %q", req.Host)
+		label = "overloaded"
+	}
+
+	return
+}
+
+func handleNetworkProfileError(req *http.Request, err error) (code int, msg, label string) {
+	if errors.Is(err, ErrUnknownNetworkProfile) {
+		code = http.StatusBadRequest
+		msg = err.Error()
+		label = "network_profile"
+	}
+
+	return
+}
+
 func handleDenyError(req *http.Request, err error) (code int, msg, label string) {
 	var denyErr denyError
 	if errors.As(err, &denyErr) {
 		code = http.StatusForbidden
 		msg = fmt.Sprintf("proxying is denied to host %q", req.Host)
-		label = skipMetricsLabel
+		label = deniedLabel
+	}
+
+	return
+}
+
+func handlePortDeniedError(req *http.Request, err error) (code int, msg, label string) {
+	if errors.Is(err, ErrProxyPortDenied) {
+		code = http.StatusForbidden
+		msg = fmt.Sprintf("proxying is denied to port of host %q", req.Host)
+		label = "port_denied"
+	}
+
+	return
+}
+
+func handleURLRuleError(req *http.Request, err error) (code int, msg, label string) {
+	var ruleErr urlRuleError
+	if errors.As(err, &ruleErr) {
+		code = ruleErr.status
+		msg = fmt.Sprintf("request to host %q is denied by URL rule", req.Host)
+		label = "url_rule"
 	}
 
 	return
@@ -238,7 +360,18 @@ func handleProhibitedError(req *http.Request, err error) (code int, msg, label s
 	if errors.As(err, &currentErr) {
 		code = http.StatusUnavailableForLegalReasons
 		msg = fmt.Sprintf("proxying is denied to host %q for administrative reasons", req.Host)
-		label = skipMetricsLabel
+		label = prohibitedLabel
+	}
+
+	return
+}
+
+func handleForwardAuthError(_ *http.Request, err error) (code int, msg, label string) {
+	var faErr forwardAuthError
+	if errors.As(err, &faErr) {
+		code = http.StatusServiceUnavailable
+		msg = "authorization service failed"
+		label = "forward_auth"
 	}
 
 	return
@@ -13,7 +13,12 @@ import (
 )
 
 type httpProxyMetrics struct {
-	errors *prometheus.CounterVec
+	errors          *prometheus.CounterVec
+	authFailures    *prometheus.CounterVec
+	forwardAuths    *prometheus.CounterVec
+	clientCertAuths *prometheus.CounterVec
+	authLockouts    *prometheus.CounterVec
+	shedRequests    *prometheus.CounterVec
 }
 
 func newHTTPProxyMetrics(r prometheus.Registerer, namespace string) *httpProxyMetrics {
@@ -28,6 +33,31 @@ func newHTTPProxyMetrics(r prometheus.Registerer, namespace string) *httpProxyMe
 			Namespace: namespace,
 			Help:      "Number of proxy errors",
 		}, []string{"reason"}),
+		authFailures: f.NewCounterVec(prometheus.CounterOpts{
+			Name:      "proxy_auth_failures_total",
+			Namespace: namespace,
+			Help:      "Number of failed proxy authentications by user",
+		}, []string{"user"}),
+		forwardAuths: f.NewCounterVec(prometheus.CounterOpts{
+			Name:      "proxy_forward_auth_decisions_total",
+			Namespace: namespace,
+			Help:      "Number of authorization service decisions by result",
+		}, []string{"result"}),
+		clientCertAuths: f.NewCounterVec(prometheus.CounterOpts{
+			Name:      "proxy_client_cert_auth_total",
+			Namespace: namespace,
+			Help:      "Number of requests with verified client certificates by authentication result",
+		}, []string{"result"}),
+		authLockouts: f.NewCounterVec(prometheus.CounterOpts{
+			Name:      "proxy_auth_lockouts_total",
+			Namespace: namespace,
+			Help:      "Number of client IP and user lockouts after failed proxy authentications",
+		}, []string{"kind"}),
+		shedRequests: f.NewCounterVec(prometheus.CounterOpts{
+			Name:      "proxy_shed_requests_total",
+			Namespace: namespace,
+			Help:      "Number of requests refused because the proxy is overloaded by reason",
+		}, []string{"reason"}),
 	}
 }
 
@@ -35,6 +65,26 @@ func (m *httpProxyMetrics) error(reason string) {
 	m.errors.WithLabelValues(reason).Inc()
 }
 
+func (m *httpProxyMetrics) authFailure(user string) {
+	m.authFailures.WithLabelValues(user).Inc()
+}
+
+func (m *httpProxyMetrics) forwardAuth(result string) {
+	m.forwardAuths.WithLabelValues(result).Inc()
+}
+
+func (m *httpProxyMetrics) clientCertAuth(result string) {
+	m.clientCertAuths.WithLabelValues(result).Inc()
+}
+
+func (m *httpProxyMetrics) authLockout(kind string) {
+	m.authLockouts.WithLabelValues(kind).Inc()
+}
+
+func (m *httpProxyMetrics) shed(reason string) {
+	m.shedRequests.WithLabelValues(reason).Inc()
+}
+
 func registerMITMCacheMetrics(r prometheus.Registerer, namespace string, cm mitmprom.CacheMetricsFunc) {
 	if r == nil {
 		r = prometheus.NewRegistry() // This registry will be discarded.
@@ -0,0 +1,222 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/saucelabs/forwarder/ratelimit"
+)
+
+var (
+	errNetworkEmulationDisabled = errors.New("network emulation is not enabled, configure network profiles")
+	errNetworkProfileTarget     = errors.New("exactly one of id, listener or client is required")
+)
+
+// SetListenerNetworkProfile sets the network profile emulated on new connections to the listener with the given name,
+// empty profile disables emulation. Existing connections are not affected.
+func (hp *HTTPProxy) SetListenerNetworkProfile(listener, profile string) error {
+	if hp.netem == nil {
+		return errNetworkEmulationDisabled
+	}
+	p, err := hp.netem.profile(profile)
+	if err != nil {
+		return err
+	}
+	rl, err := hp.listenerRateLimiter(listener)
+	if err != nil {
+		return err
+	}
+	rl.SetProfile(p)
+
+	hp.log.Info("listener network profile changed", "listener", listener, "profile", profile)
+
+	return nil
+}
+
+// SetConnNetworkProfile sets the network profile emulated on the client connection with the given ID, see Conns.
+// The profile is not changed by requests on the connection, empty profile reverts to the listener profile.
+func (hp *HTTPProxy) SetConnNetworkProfile(id uint64, profile string) error {
+	if hp.netem == nil {
+		return errNetworkEmulationDisabled
+	}
+	p, err := hp.netem.profile(profile)
+	if err != nil {
+		return err
+	}
+	conn := hp.proxy.Conn(id)
+	if conn == nil {
+		return errConnNotFound
+	}
+	if !ratelimit.PinConnProfile(conn, p) {
+		return errNotRateLimited
+	}
+
+	hp.log.Info("connection network profile changed", "id", id, "profile", profile)
+
+	return nil
+}
+
+// SetClientNetworkProfile sets the network profile emulated on connections from the client IP,
+// it takes precedence over NetworkProfileRules and applies from the next request, empty profile removes the setting.
+func (hp *HTTPProxy) SetClientNetworkProfile(ip netip.Addr, profile string) error {
+	if hp.netem == nil {
+		return errNetworkEmulationDisabled
+	}
+	p, err := hp.netem.profile(profile)
+	if err != nil {
+		return err
+	}
+	hp.netem.setClientProfile(ip.Unmap(), p)
+
+	hp.log.Info("client network profile changed", "client", ip, "profile", profile)
+
+	return nil
+}
+
+type netemzProfile struct {
+	Name             string  `json:"name"`
+	ReadLimit        int64   `json:"read_limit,omitempty"`
+	WriteLimit       int64   `json:"write_limit,omitempty"`
+	Latency          string  `json:"latency,omitempty"`
+	Jitter           string  `json:"jitter,omitempty"`
+	ResetProbability float64 `json:"reset_probability,omitempty"`
+	StallProbability float64 `json:"stall_probability,omitempty"`
+	StallDuration    string  `json:"stall_duration,omitempty"`
+}
+
+type netemzListener struct {
+	Listener string `json:"listener"`
+	Profile  string `json:"profile"`
+}
+
+type netemzClient struct {
+	Client  string `json:"client"`
+	Profile string `json:"profile"`
+}
+
+type netemz struct {
+	Profiles  []netemzProfile  `json:"profiles"`
+	Listeners []netemzListener `json:"listeners"`
+	Clients   []netemzClient   `json:"clients"`
+}
+
+// NetemzHandler returns a handler that lists the network profiles, and the profiles set for listeners and clients as JSON.
+// The profiles of client connections are listed by ConnzHandler.
+func (hp *HTTPProxy) NetemzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		res := netemz{
+			Profiles:  []netemzProfile{},
+			Listeners: []netemzListener{},
+			Clients:   []netemzClient{},
+		}
+
+		if e := hp.netem; e != nil {
+			duration := func(d time.Duration) string {
+				if d == 0 {
+					return ""
+				}
+				return d.String()
+			}
+			for _, p := range hp.config.NetworkProfiles {
+				res.Profiles = append(res.Profiles, netemzProfile{
+					Name:             p.Name,
+					ReadLimit:        int64(p.ReadLimit),
+					WriteLimit:       int64(p.WriteLimit),
+					Latency:          duration(p.Latency),
+					Jitter:           duration(p.Jitter),
+					ResetProbability: p.ResetProbability,
+					StallProbability: p.StallProbability,
+					StallDuration:    duration(p.StallDuration),
+				})
+			}
+
+			for i, l := range hp.listeners {
+				fl, ok := l.(*Listener)
+				if !ok || fl.rl == nil {
+					continue
+				}
+				res.Listeners = append(res.Listeners, netemzListener{
+					Listener: hp.listenerName(i),
+					Profile:  profileName(fl.rl.Profile()),
+				})
+			}
+
+			e.mu.Lock()
+			for ip, p := range e.clients {
+				res.Clients = append(res.Clients, netemzClient{
+					Client:  ip.String(),
+					Profile: p.Name,
+				})
+			}
+			e.mu.Unlock()
+			slices.SortFunc(res.Clients, func(a, b netemzClient) int {
+				return cmp.Compare(a.Client, b.Client)
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res) //nolint:errcheck // ignore error
+	})
+}
+
+func profileName(p *ratelimit.Profile) string {
+	if p == nil {
+		return ""
+	}
+	return p.Name
+}
+
+// SetNetworkProfileHandler returns a handler that sets the network profile given in the profile query parameter,
+// empty profile disables emulation.
+// The profile is set for the client connection given in the id query parameter, see SetConnNetworkProfile,
+// the listener given in the listener query parameter, see SetListenerNetworkProfile,
+// or the client IP given in the client query parameter, see SetClientNetworkProfile.
+// It only accepts POST requests.
+func (hp *HTTPProxy) SetNetworkProfileHandler() http.Handler {
+	return postHandler(hp.setNetworkProfile)
+}
+
+func (hp *HTTPProxy) setNetworkProfile(r *http.Request) error {
+	q := r.URL.Query()
+	profile := q.Get("profile")
+
+	n := 0
+	for _, k := range []string{"id", "listener", "client"} {
+		if q.Has(k) {
+			n++
+		}
+	}
+	if n != 1 {
+		return errNetworkProfileTarget
+	}
+
+	switch {
+	case q.Has("id"):
+		id, err := strconv.ParseUint(q.Get("id"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid id: %w", err)
+		}
+		return hp.SetConnNetworkProfile(id, profile)
+	case q.Has("listener"):
+		return hp.SetListenerNetworkProfile(q.Get("listener"), profile)
+	default:
+		ip, err := netip.ParseAddr(q.Get("client"))
+		if err != nil {
+			return fmt.Errorf("invalid client: %w", err)
+		}
+		return hp.SetClientNetworkProfile(ip, profile)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -279,3 +280,304 @@ func TestAllowTimeFrame(t *testing.T) {
 		assert.Equal(t, http.StatusUnavailableForLegalReasons, res.StatusCode)
 	})
 }
+
+func TestReload(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	cfg := DefaultHTTPProxyConfig()
+	cfg.ProxyLocalhost = AllowProxyLocalhost
+
+	p, err := NewHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	status := func() int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, s.URL, http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw := httptest.NewRecorder()
+		p.handler().ServeHTTP(rw, req)
+		return rw.Result().StatusCode
+	}
+
+	if got := status(); got != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, got)
+	}
+
+	ncfg := DefaultHTTPProxyConfig()
+	ncfg.ProxyLocalhost = DenyProxyLocalhost
+	if err := p.Reload(ncfg, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, got)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		ncfg := DefaultHTTPProxyConfig()
+		ncfg.ProxyLocalhost = "foo"
+		if err := p.Reload(ncfg, nil, nil); err == nil {
+			t.Fatal("expected error")
+		}
+		if got := status(); got != http.StatusForbidden {
+			t.Fatalf("expected %d, got %d", http.StatusForbidden, got)
+		}
+	})
+}
+
+type testTokenAuthenticator struct{}
+
+func (testTokenAuthenticator) AuthenticateToken(string) (string, []string, error) {
+	return "", nil, errors.New("invalid token")
+}
+
+func TestReloadProxyAuthenticate(t *testing.T) {
+	cfg := DefaultHTTPProxyConfig()
+	cfg.BasicAuth = url.UserPassword("user", "pass")
+
+	p, err := NewHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	challenges := func() []string {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+		rw := httptest.NewRecorder()
+		p.handler().ServeHTTP(rw, req)
+		res := rw.Result()
+		if res.StatusCode != http.StatusProxyAuthRequired {
+			t.Fatalf("expected %d, got %d", http.StatusProxyAuthRequired, res.StatusCode)
+		}
+		return res.Header.Values("Proxy-Authenticate")
+	}
+
+	assert.Equal(t, []string{`Basic realm="forwarder"`}, challenges())
+
+	ncfg := DefaultHTTPProxyConfig()
+	ncfg.BearerAuth = testTokenAuthenticator{}
+	if err := p.Reload(ncfg, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{`Bearer realm="forwarder"`}, challenges())
+}
+
+// TestSetReloadable makes sure that every config field is either reloaded or kept,
+// new fields must be added to one of the lists and to setReloadable if reloadable.
+func TestSetReloadable(t *testing.T) {
+	reloadable := []string{
+		"BasicAuth", "BasicAuthUsers", "BearerAuth", "ACL", "ForwardAuth", "LogHTTPMode",
+		"MITMDomains", "ProxyLocalhost", "UpstreamProxy", "UpstreamProxyFunc", "DenyDomains", "DirectDomains",
+		"ConnectPorts", "ConnectPortRules", "HTTPPorts", "RequestRateLimits", "URLRules", "ErrorPages",
+		"RequestModifiers", "ResponseModifiers", "AllowTimeFrame", "DenyDomainsTimeFrame", "AllowDomainsTimeFrame",
+	}
+	kept := []string{
+		"ListenerConfig", "TLSServerConfig", "PromConfig", "Protocol", "IdleTimeout", "ReadTimeout", "ReadHeaderTimeout", "WriteTimeout",
+		"AuthLockout", "LoadShedding", "ClientCertIdentity", "NetworkProfiles", "NetworkProfileRules", "NetworkProfileHeader",
+		"ExtraListeners", "Name", "MITM", "RequestIDHeader", "ConnectFunc", "ConnectTimeout", "PromHTTPOpts", "TestingHTTPHandler",
+	}
+
+	fields := func(v reflect.Value) map[string]reflect.Value {
+		m := make(map[string]reflect.Value)
+		for _, v := range []reflect.Value{v, v.FieldByName("HTTPServerConfig")} {
+			for i := range v.NumField() {
+				f := v.Type().Field(i)
+				if f.IsExported() && f.Name != "HTTPServerConfig" {
+					m[f.Name] = v.Field(i)
+				}
+			}
+		}
+		return m
+	}
+
+	var c HTTPProxyConfig
+	all := fields(reflect.ValueOf(&c).Elem())
+	for _, name := range append(reloadable, kept...) {
+		if _, ok := all[name]; !ok {
+			t.Errorf("unknown field %s", name)
+		}
+		delete(all, name)
+	}
+	for name := range all {
+		t.Errorf("field %s is neither reloadable nor kept", name)
+	}
+
+	for _, name := range reloadable {
+		var src, dst HTTPProxyConfig
+		v := fields(reflect.ValueOf(&src).Elem())[name]
+		if !setNonZero(v) {
+			continue
+		}
+		dst.setReloadable(&src)
+		if fields(reflect.ValueOf(&dst).Elem())[name].IsZero() {
+			t.Errorf("field %s is not reloaded", name)
+		}
+	}
+	for _, name := range kept {
+		var src, dst HTTPProxyConfig
+		if !setNonZero(fields(reflect.ValueOf(&src).Elem())[name]) {
+			continue
+		}
+		dst.setReloadable(&src)
+		if !fields(reflect.ValueOf(&dst).Elem())[name].IsZero() {
+			t.Errorf("field %s is reloaded", name)
+		}
+	}
+}
+
+// setNonZero sets v to a non-zero value, it returns false if it does not know how.
+func setNonZero(v reflect.Value) bool {
+	switch v.Kind() { //nolint:exhaustive // other kinds are not used in config
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+	case reflect.Func:
+		v.Set(reflect.MakeFunc(v.Type(), func([]reflect.Value) []reflect.Value { return nil }))
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() && setNonZero(v.Field(i)) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+	return true
+}
+
+func TestDrain(t *testing.T) {
+	cfg := DefaultHTTPProxyConfig()
+	cfg.Address = "localhost:0"
+
+	p, err := NewHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ready := p.ReadinessChecks().Ready
+	if err := ready(context.Background()); err == nil {
+		t.Fatal("expected not ready before Run")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- p.Run(ctx)
+	}()
+
+	for i := 0; ; i++ {
+		if err := ready(context.Background()); err == nil {
+			break
+		} else if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	addr := p.Listeners()[0].Addr().String()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := p.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ready(context.Background()); err == nil || !strings.Contains(err.Error(), "listeners: draining") {
+		t.Fatalf("expected draining error, got %v", err)
+	}
+	if c, err := net.Dial("tcp", addr); err == nil {
+		c.Close()
+		t.Fatal("expected dial error after drain")
+	}
+
+	// Existing connections are still served.
+	if _, err := conn.Write([]byte("GET http://localhost/ HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, len("HTTP/1.1"))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("Run returned after drain: %v", err)
+	default:
+	}
+
+	conn.Close()
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+func TestCheckUpstream(t *testing.T) {
+	var dials []string
+	tr := &http.Transport{
+		DialContext: func(_ context.Context, _, addr string) (net.Conn, error) {
+			dials = append(dials, addr)
+			return nil, errors.New("refused")
+		},
+	}
+
+	cfg := DefaultHTTPProxyConfig()
+	cfg.UpstreamProxy = &url.URL{Scheme: "http", Host: "upstream:3128"}
+	p, err := NewHTTPProxy(cfg, nil, nil, tr, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for range 2 {
+		if err := p.checkUpstream(context.Background()); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	assert.Equal(t, []string{"upstream:3128"}, dials, "expected one dial with the transport dialer")
+}
+
+func TestUpstreamProxyAddr(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://squid", "squid:80"},
+		{"https://squid", "squid:443"},
+		{"socks5://squid", "squid:1080"},
+		{"http://squid:3128", "squid:3128"},
+		{"http://[::1]", "[::1]:80"},
+	}
+	for _, tc := range tests {
+		u, err := url.Parse(tc.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tc.want, upstreamProxyAddr(u), tc.url)
+	}
+}
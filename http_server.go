@@ -97,9 +97,15 @@ func DefaultHTTPServerConfig() *HTTPServerConfig {
 }
 
 func (c *HTTPServerConfig) Validate() error {
+	if err := c.ListenerConfig.Validate(); err != nil {
+		return err
+	}
 	if err := validatedUserInfo(c.BasicAuth); err != nil {
 		return fmt.Errorf("basic_auth: %w", err)
 	}
+	if err := c.TLSServerConfig.Validate(); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
 	return nil
 }
 
@@ -253,6 +259,11 @@ func (hs *HTTPServer) listen() (net.Listener, error) {
 	}
 }
 
+// Listener returns the server listener.
+func (hs *HTTPServer) Listener() net.Listener {
+	return hs.listener
+}
+
 // Addr returns the address the server is listening on.
 func (hs *HTTPServer) Addr() string {
 	return hs.listener.Addr().String()
@@ -60,6 +60,9 @@ func (w *logWriter) trace(e middleware.LogEntry) {
 	if trace := martian.ContextTraceID(e.Request.Context()); trace != "" {
 		fmt.Fprintf(&w.b, "[%s] ", trace)
 	}
+	if user := martian.ContextUser(e.Request.Context()); user != "" {
+		fmt.Fprintf(&w.b, "user=%s ", user)
+	}
 }
 
 func (w *logWriter) Dump(e middleware.LogEntry) {
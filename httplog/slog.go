@@ -148,6 +148,7 @@ type structuredLogBuilder struct {
 	res      response
 	duration string
 	id       string
+	user     string
 }
 
 // WithShortURL sets the URL using a short form along with basic fields.
@@ -188,6 +189,7 @@ func (b *structuredLogBuilder) initBasicFields(e middleware.LogEntry, urlStr str
 
 	b.duration = e.Duration.String()
 	b.id = martian.ContextTraceID(req.Context())
+	b.user = martian.ContextUser(req.Context())
 }
 
 // WithHeaders copies headers, trailers, and other metadata from the request and response.
@@ -266,5 +268,9 @@ func (b *structuredLogBuilder) WithBody(e middleware.LogEntry) {
 
 // Args returns a slice of key-value pairs for logging purposes.
 func (b *structuredLogBuilder) Args() []any {
-	return []any{"request", b.req, "response", b.res, "duration", b.duration, "id", b.id}
+	args := []any{"request", b.req, "response", b.res, "duration", b.duration, "id", b.id}
+	if b.user != "" {
+		args = append(args, "user", b.user)
+	}
+	return args
 }
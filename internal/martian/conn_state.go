@@ -0,0 +1,212 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package martian
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/saucelabs/forwarder/conntrack"
+)
+
+// ConnInfo is a snapshot of a client connection state.
+type ConnInfo struct {
+	ID         uint64
+	ClientAddr string
+	Start      time.Time
+
+	// Host is the target host of the current or last request.
+	Host string
+	// Upstream is the upstream proxy used for the current or last request, empty if connected directly.
+	Upstream string
+	// Tunnel is the tunnel type i.e. CONNECT or the upgrade protocol, empty if not tunneling.
+	Tunnel string
+	// MITM is true if the connection is a MITMed CONNECT tunnel.
+	MITM bool
+	// RequestID is the ID of the current or last request.
+	RequestID string
+	// User is the authenticated user of the last authenticated request.
+	User string
+
+	// Conn is the client connection.
+	Conn net.Conn
+
+	// Rx and Tx are the number of bytes received from and sent to the client.
+	// They are only available if the listener tracks traffic, see conntrack.Builder.
+	Rx, Tx     uint64
+	HasTraffic bool
+}
+
+func (ci ConnInfo) Duration() time.Duration {
+	return time.Since(ci.Start)
+}
+
+type connState struct {
+	id    uint64
+	conn  net.Conn
+	start time.Time
+	obs   *conntrack.Observer
+
+	mu        sync.Mutex
+	host      string
+	upstream  string
+	tunnel    string
+	upstreamc io.Closer
+	mitm      bool
+	requestID string
+	user      string
+}
+
+func newConnState(id uint64, conn net.Conn) *connState {
+	return &connState{
+		id:    id,
+		conn:  conn,
+		start: time.Now(),
+		obs:   conntrack.ObserverFromConn(conn),
+	}
+}
+
+func (s *connState) setRequest(req *http.Request) {
+	s.mu.Lock()
+	s.host = req.URL.Host
+	s.upstream = ""
+	s.requestID = ContextTraceID(req.Context())
+	s.mu.Unlock()
+}
+
+func (s *connState) setUpstream(u *url.URL) {
+	s.mu.Lock()
+	s.upstream = u.Redacted()
+	s.mu.Unlock()
+}
+
+// setTunnel records the tunnel name and the upstream connection, so that the tunnel can be closed with close.
+func (s *connState) setTunnel(name string, upstream io.Closer) {
+	s.mu.Lock()
+	s.tunnel = name
+	s.upstreamc = upstream
+	s.mu.Unlock()
+}
+
+// close closes the client connection and the upstream connection of the tunnel, if any.
+func (s *connState) close() {
+	s.mu.Lock()
+	u := s.upstreamc
+	s.mu.Unlock()
+
+	s.conn.Close()
+	if u != nil {
+		u.Close()
+	}
+}
+
+func (s *connState) setUser(user string) {
+	s.mu.Lock()
+	s.user = user
+	s.mu.Unlock()
+}
+
+func (s *connState) setMITM() {
+	s.mu.Lock()
+	s.mitm = true
+	s.mu.Unlock()
+}
+
+func (s *connState) info() ConnInfo {
+	s.mu.Lock()
+	ci := ConnInfo{
+		ID:         s.id,
+		ClientAddr: s.conn.RemoteAddr().String(),
+		Conn:       s.conn,
+		Start:      s.start,
+		Host:       s.host,
+		Upstream:   s.upstream,
+		Tunnel:     s.tunnel,
+		MITM:       s.mitm,
+		RequestID:  s.requestID,
+		User:       s.user,
+	}
+	s.mu.Unlock()
+
+	if s.obs != nil {
+		ci.Rx = s.obs.Rx()
+		ci.Tx = s.obs.Tx()
+		ci.HasTraffic = true
+	}
+
+	return ci
+}
+
+const connStateContextKey contextKey = traceIDContextKey + 1
+
+func withConnState(ctx context.Context, s *connState) context.Context {
+	return context.WithValue(ctx, connStateContextKey, s)
+}
+
+func contextConnState(ctx context.Context) *connState {
+	s, _ := ctx.Value(connStateContextKey).(*connState)
+	return s
+}
+
+// Conns returns the client connections handled by the proxy ordered by ID.
+func (p *Proxy) Conns() []ConnInfo {
+	p.init()
+
+	p.connsMu.Lock()
+	ss := make([]*connState, 0, len(p.conns))
+	for _, s := range p.conns {
+		ss = append(ss, s)
+	}
+	p.connsMu.Unlock()
+
+	res := make([]ConnInfo, 0, len(ss))
+	for _, s := range ss {
+		res = append(res, s.info())
+	}
+	slices.SortFunc(res, func(a, b ConnInfo) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return res
+}
+
+// CloseConn closes the client connection with the given ID, and if it is a tunnel, the upstream connection.
+// It returns false if there is no such connection.
+func (p *Proxy) CloseConn(id uint64) bool {
+	cs := p.connState(id)
+	if cs == nil {
+		return false
+	}
+	cs.close()
+
+	return true
+}
+
+// Conn returns the client connection with the given ID, or nil if there is no such connection.
+func (p *Proxy) Conn(id uint64) net.Conn {
+	cs := p.connState(id)
+	if cs == nil {
+		return nil
+	}
+	return cs.conn
+}
+
+func (p *Proxy) connState(id uint64) *connState {
+	p.init()
+
+	p.connsMu.Lock()
+	defer p.connsMu.Unlock()
+
+	return p.conns[id]
+}
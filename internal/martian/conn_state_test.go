@@ -0,0 +1,88 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package martian
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestConns(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstream, remote := net.Pipe()
+	defer remote.Close()
+
+	p := new(Proxy)
+	p.ConnectFunc = func(req *http.Request) (*http.Response, io.ReadWriteCloser, error) {
+		return newConnectResponse(req), upstream, nil
+	}
+	go p.Serve(l)
+	defer func() { l.Close(); p.Shutdown(context.Background()) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	req, err := http.NewRequest(http.MethodConnect, "//example.com:443", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", res.StatusCode)
+	}
+
+	var ci ConnInfo
+	for range 100 {
+		if cc := p.Conns(); len(cc) == 1 && cc[0].Tunnel != "" {
+			ci = cc[0]
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ci.Tunnel != "CONNECT" {
+		t.Fatalf("tunnel not found: %+v", p.Conns())
+	}
+	if ci.Host != "example.com:443" {
+		t.Errorf("unexpected host: %s", ci.Host)
+	}
+	if ci.ClientAddr != conn.LocalAddr().String() {
+		t.Errorf("unexpected client address: %s", ci.ClientAddr)
+	}
+	if ci.RequestID == "" {
+		t.Error("missing request ID")
+	}
+
+	if p.CloseConn(ci.ID + 1) {
+		t.Fatal("closed unknown connection")
+	}
+	if !p.CloseConn(ci.ID) {
+		t.Fatal("connection not found")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected connection to be closed")
+	}
+}
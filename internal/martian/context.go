@@ -16,6 +16,7 @@ package martian
 
 import (
 	"context"
+	"net"
 	"time"
 )
 
@@ -42,3 +43,61 @@ func ContextDuration(ctx context.Context) time.Duration {
 	}
 	return 0
 }
+
+// SetContextUser sets the authenticated user of the request,
+// it is reported in logs along with the trace ID, and in the client connection state.
+func SetContextUser(ctx context.Context, user string) {
+	if v := ctx.Value(traceIDContextKey); v != nil {
+		v.(traceID).values.user.Store(&user)
+	}
+	if s := contextConnState(ctx); s != nil {
+		s.setUser(user)
+	}
+}
+
+// ContextUser returns the authenticated user of the request set with SetContextUser.
+func ContextUser(ctx context.Context) string {
+	if v := ctx.Value(traceIDContextKey); v != nil {
+		if u := v.(traceID).values.user.Load(); u != nil {
+			return *u
+		}
+	}
+	return ""
+}
+
+// SetContextValue stores a value for the request,
+// unlike context.WithValue it is visible to all modifiers and proxy functions handling the request.
+func SetContextValue(ctx context.Context, key, val any) {
+	if v := ctx.Value(traceIDContextKey); v != nil {
+		v.(traceID).values.m.Store(key, val)
+	}
+}
+
+// ContextValue returns the value stored for the request with SetContextValue.
+func ContextValue(ctx context.Context, key any) any {
+	if v := ctx.Value(traceIDContextKey); v != nil {
+		val, _ := v.(traceID).values.m.Load(key)
+		return val
+	}
+	return nil
+}
+
+// ContextMITM returns true if the request was read from a MITMed CONNECT tunnel.
+func ContextMITM(ctx context.Context) bool {
+	s := contextConnState(ctx)
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mitm
+}
+
+// ContextConn returns the client connection the request was read from, or nil if not known.
+func ContextConn(ctx context.Context) net.Conn {
+	s := contextConnState(ctx)
+	if s == nil {
+		return nil
+	}
+	return s.conn
+}
@@ -126,7 +126,8 @@ type Proxy struct {
 	initOnce sync.Once
 
 	rt        http.RoundTripper
-	conns     map[net.Conn]struct{}
+	conns     map[uint64]*connState // client connections by ID
+	connID    atomic.Uint64
 	connsWg   atomic.Int32
 	connsMu   sync.Mutex // protects connsWg.Add/Wait and conns from concurrent access
 	closeCh   chan bool
@@ -157,8 +158,9 @@ func (p *Proxy) init() {
 			}
 			if p.ProxyURL == nil {
 				p.ProxyURL = t.Proxy
-			} else {
-				t.Proxy = p.ProxyURL
+			}
+			if p.ProxyURL != nil {
+				t.Proxy = p.proxyURL
 			}
 			t.OnProxyConnectResponse = OnProxyConnectResponse
 
@@ -176,7 +178,7 @@ func (p *Proxy) init() {
 			p.BaseContext = context.Background()
 		}
 
-		p.conns = make(map[net.Conn]struct{})
+		p.conns = make(map[uint64]*connState)
 		p.connsWg.Store(0)
 		p.closeCh = make(chan bool)
 	})
@@ -239,8 +241,8 @@ func (p *Proxy) Close() error {
 	})
 
 	var err error
-	for conn := range p.conns {
-		if e := conn.Close(); e != nil {
+	for _, s := range p.conns {
+		if e := s.conn.Close(); e != nil {
 			err = multierr.Append(err, e)
 		}
 	}
@@ -306,14 +308,16 @@ func (p *Proxy) Serve(l net.Listener) error {
 func (p *Proxy) handleLoop(conn net.Conn) {
 	start := time.Now()
 
+	s := newConnState(p.connID.Add(1), conn)
+
 	p.connsMu.Lock()
-	p.conns[conn] = struct{}{}
+	p.conns[s.id] = s
 	p.connsWg.Add(1)
 	p.connsMu.Unlock()
 
 	defer func() {
 		p.connsMu.Lock()
-		delete(p.conns, conn)
+		delete(p.conns, s.id)
 		p.connsMu.Unlock()
 	}()
 	defer p.connsWg.Add(-1)
@@ -322,7 +326,7 @@ func (p *Proxy) handleLoop(conn net.Conn) {
 		return
 	}
 
-	pc := newProxyConn(p, conn)
+	pc := newProxyConn(p, conn, s)
 
 	if err := pc.maybeHandshakeTLS(); err != nil {
 		log.Error(context.TODO(), "failed to do TLS handshake", "error", err)
@@ -350,6 +354,17 @@ func (p *Proxy) handleLoop(conn net.Conn) {
 	}
 }
 
+// proxyURL calls ProxyURL and records the upstream proxy in the connection state.
+func (p *Proxy) proxyURL(req *http.Request) (*url.URL, error) {
+	u, err := p.ProxyURL(req)
+	if u != nil {
+		if s := contextConnState(req.Context()); s != nil {
+			s.setUpstream(u)
+		}
+	}
+	return u, err
+}
+
 func (p *Proxy) idleTimeout() time.Duration {
 	if p.IdleTimeout > 0 {
 		return p.IdleTimeout
@@ -378,6 +393,17 @@ func (p *Proxy) modifyResponse(res *http.Response) error {
 	return p.ResponseModifier.ModifyResponse(res)
 }
 
+// modifyErrorResponse runs the response modifiers on an error response generated by the proxy.
+// Proxy-Authenticate is a hop-by-hop header, it is kept as it is set by the proxy for this hop.
+func (p *Proxy) modifyErrorResponse(res *http.Response) error {
+	pa := res.Header.Values("Proxy-Authenticate")
+	err := p.modifyResponse(res)
+	if len(pa) > 0 {
+		res.Header["Proxy-Authenticate"] = pa
+	}
+	return err
+}
+
 func (p *Proxy) shouldMITM(req *http.Request) bool {
 	if p.MITMConfig == nil {
 		return false
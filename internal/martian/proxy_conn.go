@@ -41,13 +41,15 @@ type proxyConn struct {
 	conn   net.Conn
 	secure bool
 	cs     tls.ConnectionState
+	state  *connState
 }
 
-func newProxyConn(p *Proxy, conn net.Conn) *proxyConn {
+func newProxyConn(p *Proxy, conn net.Conn, state *connState) *proxyConn {
 	return &proxyConn{
 		Proxy: p,
 		brw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
 		conn:  conn,
+		state: state,
 	}
 }
 
@@ -120,7 +122,10 @@ func (p *proxyConn) readRequest() (*http.Request, error) {
 		req.URL.Host = req.Host
 	}
 
-	req = req.WithContext(withTraceID(p.BaseContext, newTraceID(req.Header.Get(p.RequestIDHeader))))
+	ctx := withTraceID(p.BaseContext, newTraceID(req.Header.Get(p.RequestIDHeader)))
+	ctx = withConnState(ctx, p.state)
+	req = req.WithContext(ctx)
+	p.state.setRequest(req)
 
 	// Adjust the read deadline if necessary.
 	if !hdrDeadline.Equal(wholeReqDeadline) {
@@ -236,6 +241,7 @@ func (p *proxyConn) handleConnectRequest(req *http.Request) error {
 	}
 
 	if p.shouldMITM(req) {
+		p.state.setMITM()
 		return p.handleMITM(req)
 	}
 
@@ -299,6 +305,9 @@ func (p *proxyConn) tunnel(name string, res *http.Response, crw io.ReadWriteClos
 
 	ctx := res.Request.Context()
 
+	p.state.setTunnel(name, crw)
+	defer p.state.setTunnel("", nil)
+
 	log.Debug(ctx, "switched protocols, proxying traffic", "name", name)
 	bicopy(ctx,
 		copier{"upstream " + name, crw, p.conn},
@@ -404,7 +413,7 @@ func (p *proxyConn) writeErrorResponse(req *http.Request, err error) error {
 	if res == nil {
 		res = p.errorResponse(req, err)
 	}
-	if err := p.modifyResponse(res); err != nil {
+	if err := p.modifyErrorResponse(res); err != nil {
 		log.Error(req.Context(), "error modifying error response", "error", err)
 		if !p.WithoutWarning {
 			proxyutil.Warning(res.Header, err)
@@ -85,7 +85,7 @@ func (p *Proxy) connect(req *http.Request) (*http.Response, net.Conn, error) {
 
 	var proxyURL *url.URL
 	if p.ProxyURL != nil {
-		u, err := p.ProxyURL(req)
+		u, err := p.proxyURL(req)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -341,7 +341,7 @@ func (p proxyHandler) writeErrorResponse(rw http.ResponseWriter, req *http.Reque
 	if res == nil {
 		res = p.errorResponse(req, err)
 	}
-	if err := p.modifyResponse(res); err != nil {
+	if err := p.modifyErrorResponse(res); err != nil {
 		log.Error(req.Context(), "error modifying error response", "error", err)
 		if !p.WithoutWarning {
 			proxyutil.Warning(res.Header, err)
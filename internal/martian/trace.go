@@ -5,6 +5,7 @@ package martian
 import (
 	"context"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -15,6 +16,13 @@ import (
 type traceID struct {
 	id        string
 	createdAt time.Time
+	values    *requestValues
+}
+
+// requestValues holds values set by modifiers during request processing.
+type requestValues struct {
+	user atomic.Pointer[string]
+	m    sync.Map
 }
 
 var idSeq atomic.Uint64
@@ -30,6 +38,7 @@ func newTraceID(id string) traceID {
 	return traceID{
 		id:        id,
 		createdAt: t,
+		values:    new(requestValues),
 	}
 }
 
@@ -73,7 +82,10 @@ func (l TraceIDAppendingLogger) With(args ...any) log.StructuredLogger {
 
 func (l TraceIDAppendingLogger) args(ctx context.Context, args ...any) []any {
 	if id := ContextTraceID(ctx); id != "" {
-		return append(args, "id", id)
+		args = append(args, "id", id)
+	}
+	if user := ContextUser(ctx); user != "" {
+		args = append(args, "user", user)
 	}
 	return args
 }
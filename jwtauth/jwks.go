@@ -0,0 +1,294 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package jwtauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// KeySet holds public keys read from a JSON Web Key Set.
+type KeySet struct {
+	keys []key
+}
+
+type key struct {
+	kid string
+	alg string
+	pub crypto.PublicKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseKeySet parses a JSON Web Key Set as defined in RFC 7517.
+// RSA, EC (P-256, P-384, P-521) and OKP (Ed25519) keys are supported,
+// keys of other types and keys not intended for signatures are ignored.
+func ParseKeySet(b []byte) (*KeySet, error) {
+	var v struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	ks := new(KeySet)
+	for i, k := range v.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		if pub == nil {
+			continue
+		}
+		ks.keys = append(ks.keys, key{kid: k.Kid, alg: k.Alg, pub: pub})
+	}
+	if len(ks.keys) == 0 {
+		return nil, errors.New("no supported keys found")
+	}
+
+	return ks, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("e: too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var c elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		if !c.IsOnCurve(x, y) { //nolint:staticcheck // there is no replacement for arbitrary coordinates
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: c, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("x: invalid size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil //nolint:nilnil // unsupported key types are ignored
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Len returns the number of keys in the set.
+func (ks *KeySet) Len() int {
+	return len(ks.keys)
+}
+
+// hasKid reports if the set has a key with the given ID.
+func (ks *KeySet) hasKid(kid string) bool {
+	for _, k := range ks.keys {
+		if k.kid == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates returns keys that may verify a token signed with alg and kid.
+func (ks *KeySet) candidates(alg, kid string) []key {
+	var res []key
+	for _, k := range ks.keys {
+		if kid != "" && k.kid != kid {
+			continue
+		}
+		if k.alg != "" && k.alg != alg {
+			continue
+		}
+		res = append(res, k)
+	}
+	return res
+}
+
+// DefaultRefreshInterval is the default interval between key set reloads.
+const DefaultRefreshInterval = 5 * time.Minute
+
+// minRefreshInterval limits reloads triggered by tokens signed with unknown keys.
+const minRefreshInterval = 10 * time.Second
+
+// Keys provides a key set that is periodically reloaded to support key rotation.
+// The key set is also reloaded if a token is signed with an unknown key, at most once per 10 seconds.
+// Concurrent reloads are merged into one.
+// If the key set cannot be reloaded, the previously loaded keys are kept.
+type Keys struct {
+	// RefreshInterval is the interval between key set reloads.
+	RefreshInterval time.Duration
+	// OnReload is called after the key set is reloaded and changed, or if the reload failed.
+	OnReload func(ks *KeySet, err error)
+
+	load func() ([]byte, error)
+
+	mu         sync.Mutex
+	ks         *KeySet
+	raw        []byte
+	lastLoad   time.Time
+	refreshing atomic.Bool
+	sf         singleflight.Group
+}
+
+// NewKeys loads the key set with load and returns Keys that reload it periodically.
+// The load function typically reads a local file or fetches a URL.
+func NewKeys(load func() ([]byte, error)) (*Keys, error) {
+	k := &Keys{
+		RefreshInterval: DefaultRefreshInterval,
+		load:            load,
+	}
+	b, err := load()
+	if err != nil {
+		return nil, err
+	}
+	ks, err := ParseKeySet(b)
+	if err != nil {
+		return nil, err
+	}
+	k.ks = ks
+	k.raw = b
+	k.lastLoad = time.Now()
+
+	return k, nil
+}
+
+// KeySet returns the current key set, it starts a background reload if the refresh interval elapsed.
+func (k *Keys) KeySet() *KeySet {
+	k.mu.Lock()
+	ks := k.ks
+	stale := time.Since(k.lastLoad) >= k.RefreshInterval
+	k.mu.Unlock()
+
+	if stale && k.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer k.refreshing.Store(false)
+			k.sf.Do("", func() (any, error) { //nolint:errcheck // errors are reported with OnReload
+				return k.reload(), nil
+			})
+		}()
+	}
+
+	return ks
+}
+
+// reloadUnknown reloads the key set synchronously if it was not reloaded recently,
+// callers waiting for the same reload share its result.
+// It returns the current key set, or nil if the reload failed.
+func (k *Keys) reloadUnknown() *KeySet {
+	v, _, _ := k.sf.Do("", func() (any, error) {
+		k.mu.Lock()
+		ks := k.ks
+		recent := time.Since(k.lastLoad) < minRefreshInterval
+		k.mu.Unlock()
+		if recent {
+			return ks, nil
+		}
+		return k.reload(), nil
+	})
+	return v.(*KeySet) //nolint:forcetypeassert // always a *KeySet
+}
+
+func (k *Keys) reload() *KeySet {
+	b, err := k.load()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.lastLoad = time.Now()
+	if err != nil {
+		k.onReload(nil, err)
+		return nil
+	}
+	if bytes.Equal(b, k.raw) {
+		return k.ks
+	}
+	ks, err := ParseKeySet(b)
+	if err != nil {
+		k.onReload(nil, err)
+		return nil
+	}
+	k.ks = ks
+	k.raw = b
+	k.onReload(ks, nil)
+
+	return ks
+}
+
+func (k *Keys) onReload(ks *KeySet, err error) {
+	if k.OnReload != nil {
+		k.OnReload(ks, err)
+	}
+}
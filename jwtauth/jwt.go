@@ -0,0 +1,304 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package jwtauth implements user authentication with JSON Web Tokens (JWT) signed with keys from a JSON Web Key Set (JWKS).
+//
+// The supported signature algorithms are RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384, ES512 and EdDSA.
+// Tokens must have the exp claim, the nbf claim is checked if present.
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotYetValid = errors.New("token not yet valid")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+	ErrMissingIdentity  = errors.New("missing identity claim")
+)
+
+type Config struct {
+	// Issuer if set, the iss claim must be equal to it.
+	Issuer string
+	// Audience if set, the aud claim must contain it.
+	Audience string
+	// IdentityClaim is the claim used as the user identity.
+	IdentityClaim string
+	// GroupsClaim is the claim with user groups, it can be an array of strings or a space separated string.
+	GroupsClaim string
+	// Leeway is the allowed clock skew when checking exp and nbf claims.
+	Leeway time.Duration
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		IdentityClaim: "sub",
+		GroupsClaim:   "groups",
+		Leeway:        time.Minute,
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.IdentityClaim == "" {
+		return errors.New("identity claim is required")
+	}
+	if c.Leeway < 0 {
+		return errors.New("leeway must not be negative")
+	}
+	return nil
+}
+
+// Identity is the user identity read from a valid token.
+type Identity struct {
+	User   string
+	Groups []string
+}
+
+// Validator validates tokens and maps their claims to identities.
+type Validator struct {
+	config Config
+	keys   *Keys
+	now    func() time.Time
+}
+
+func NewValidator(cfg *Config, keys *Keys) (*Validator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Validator{
+		config: *cfg,
+		keys:   keys,
+		now:    time.Now,
+	}, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Validate verifies the token signature and claims, and returns the identity of the token.
+func (v *Validator) Validate(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrMalformedToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %w", ErrMalformedToken, err)
+	}
+	if err := v.verify(&h, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %w", ErrMalformedToken, err)
+	}
+
+	return v.identity(claims)
+}
+
+// AuthenticateToken validates the token and returns the user and groups of the token.
+func (v *Validator) AuthenticateToken(token string) (user string, groups []string, err error) {
+	id, err := v.Validate(token)
+	if err != nil {
+		return "", nil, err
+	}
+	return id.User, id.Groups, nil
+}
+
+func decodeSegment(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+func (v *Validator) verify(h *header, signed string, sig []byte) error {
+	alg, ok := algorithms[h.Alg]
+	if !ok {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrMalformedToken, h.Alg)
+	}
+
+	ks := v.keys.KeySet()
+	if verifyAny(ks.candidates(h.Alg, h.Kid), alg, signed, sig) {
+		return nil
+	}
+	if h.Kid != "" && !ks.hasKid(h.Kid) {
+		if ks := v.keys.reloadUnknown(); ks != nil && verifyAny(ks.candidates(h.Alg, h.Kid), alg, signed, sig) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func verifyAny(keys []key, alg algorithm, signed string, sig []byte) bool {
+	for _, k := range keys {
+		if alg.verifySignature(k.pub, signed, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Validator) identity(claims map[string]any) (*Identity, error) {
+	now := v.now()
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return nil, fmt.Errorf("%w: missing exp claim", ErrMalformedToken)
+	}
+	if now.After(exp.Add(v.config.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if _, has := claims["nbf"]; has {
+		nbf, ok := numericDate(claims["nbf"])
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid nbf claim", ErrMalformedToken)
+		}
+		if now.Add(v.config.Leeway).Before(nbf) {
+			return nil, ErrTokenNotYetValid
+		}
+	}
+
+	if v.config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.config.Issuer {
+			return nil, ErrInvalidIssuer
+		}
+	}
+	if v.config.Audience != "" && !slices.Contains(stringList(claims["aud"]), v.config.Audience) {
+		return nil, ErrInvalidAudience
+	}
+
+	user, _ := claims[v.config.IdentityClaim].(string)
+	if user == "" {
+		return nil, ErrMissingIdentity
+	}
+	id := &Identity{User: user}
+	if v.config.GroupsClaim != "" {
+		id.Groups = stringList(claims[v.config.GroupsClaim])
+	}
+
+	return id, nil
+}
+
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// stringList returns the strings of a JSON array, or the space separated fields of a JSON string.
+func stringList(v any) []string {
+	switch vv := v.(type) {
+	case string:
+		return strings.Fields(vv)
+	case []any:
+		res := make([]string, 0, len(vv))
+		for _, e := range vv {
+			if s, ok := e.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	default:
+		return nil
+	}
+}
+
+type algorithm struct {
+	hash   crypto.Hash
+	verify func(hash crypto.Hash, pub crypto.PublicKey, signed string, sig []byte) bool
+}
+
+func (a algorithm) verifySignature(pub crypto.PublicKey, signed string, sig []byte) bool {
+	return a.verify(a.hash, pub, signed, sig)
+}
+
+var algorithms = map[string]algorithm{
+	"RS256": {crypto.SHA256, verifyPKCS1v15},
+	"RS384": {crypto.SHA384, verifyPKCS1v15},
+	"RS512": {crypto.SHA512, verifyPKCS1v15},
+	"PS256": {crypto.SHA256, verifyPSS},
+	"PS384": {crypto.SHA384, verifyPSS},
+	"PS512": {crypto.SHA512, verifyPSS},
+	"ES256": {crypto.SHA256, verifyECDSA},
+	"ES384": {crypto.SHA384, verifyECDSA},
+	"ES512": {crypto.SHA512, verifyECDSA},
+	"EdDSA": {0, verifyEd25519},
+}
+
+func digest(hash crypto.Hash, signed string) []byte {
+	h := hash.New()
+	h.Write([]byte(signed))
+	return h.Sum(nil)
+}
+
+func verifyPKCS1v15(hash crypto.Hash, pub crypto.PublicKey, signed string, sig []byte) bool {
+	k, ok := pub.(*rsa.PublicKey)
+	return ok && rsa.VerifyPKCS1v15(k, hash, digest(hash, signed), sig) == nil
+}
+
+func verifyPSS(hash crypto.Hash, pub crypto.PublicKey, signed string, sig []byte) bool {
+	k, ok := pub.(*rsa.PublicKey)
+	return ok && rsa.VerifyPSS(k, hash, digest(hash, signed), sig, nil) == nil
+}
+
+// ecdsaCurveBits maps ES algorithm hashes to curve sizes, see RFC 7518, Section 3.4.
+var ecdsaCurveBits = map[crypto.Hash]int{
+	crypto.SHA256: 256,
+	crypto.SHA384: 384,
+	crypto.SHA512: 521,
+}
+
+func verifyECDSA(hash crypto.Hash, pub crypto.PublicKey, signed string, sig []byte) bool {
+	k, ok := pub.(*ecdsa.PublicKey)
+	if !ok || k.Curve.Params().BitSize != ecdsaCurveBits[hash] {
+		return false
+	}
+	size := (k.Curve.Params().BitSize + 7) / 8
+	if len(sig) != 2*size {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:size])
+	s := new(big.Int).SetBytes(sig[size:])
+	return ecdsa.Verify(k, digest(hash, signed), r, s)
+}
+
+func verifyEd25519(_ crypto.Hash, pub crypto.PublicKey, signed string, sig []byte) bool {
+	k, ok := pub.(ed25519.PublicKey)
+	return ok && ed25519.Verify(k, []byte(signed), sig)
+}
@@ -0,0 +1,341 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testKey struct {
+	kid  string
+	alg  string
+	priv crypto.Signer
+}
+
+func (k *testKey) jwk() map[string]string {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	m := map[string]string{"kid": k.kid, "use": "sig"}
+	switch pub := k.priv.Public().(type) {
+	case *rsa.PublicKey:
+		m["kty"] = "RSA"
+		m["n"] = b64(pub.N.Bytes())
+		m["e"] = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		m["kty"] = "EC"
+		m["crv"] = pub.Curve.Params().Name
+		m["x"] = b64(pub.X.FillBytes(make([]byte, 32)))
+		m["y"] = b64(pub.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		m["kty"] = "OKP"
+		m["crv"] = "Ed25519"
+		m["x"] = b64(pub)
+	}
+	return m
+}
+
+func (k *testKey) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": k.alg, "kid": k.kid, "typ": "JWT"}) + "." + enc(claims)
+
+	var (
+		sig []byte
+		err error
+	)
+	switch priv := k.priv.(type) {
+	case *rsa.PrivateKey:
+		h := sha256.Sum256([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, h[:])
+	case *ecdsa.PrivateKey:
+		h := sha256.Sum256([]byte(signed))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, priv, h[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(priv, []byte(signed))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newTestKeys(t *testing.T) []*testKey {
+	t.Helper()
+
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []*testKey{
+		{kid: "rsa", alg: "RS256", priv: rk},
+		{kid: "ec", alg: "ES256", priv: ek},
+		{kid: "ed", alg: "EdDSA", priv: edk},
+	}
+}
+
+func keySetJSON(t *testing.T, keys ...*testKey) []byte {
+	t.Helper()
+
+	var v struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for _, k := range keys {
+		v.Keys = append(v.Keys, k.jwk())
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestValidate(t *testing.T) {
+	keys := newTestKeys(t)
+	ks, err := NewKeys(func() ([]byte, error) { return keySetJSON(t, keys...), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Issuer = "https://ci.example.com"
+	cfg.Audience = "forwarder"
+	v, err := NewValidator(cfg, ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(mod func(c map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss":    "https://ci.example.com",
+			"aud":    []string{"forwarder", "other"},
+			"sub":    "ci-job",
+			"groups": []string{"ci", "qa"},
+			"exp":    now.Add(time.Hour).Unix(),
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+
+	for _, k := range keys {
+		t.Run(k.alg, func(t *testing.T) {
+			id, err := v.Validate(k.sign(t, claims(nil)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.User != "ci-job" || !slices.Equal(id.Groups, []string{"ci", "qa"}) {
+				t.Fatalf("unexpected identity %+v", id)
+			}
+		})
+	}
+
+	tests := []struct {
+		name string
+		mod  func(c map[string]any)
+		err  error
+	}{
+		{"expired", func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() }, ErrTokenExpired},
+		{"within leeway", func(c map[string]any) { c["exp"] = now.Add(-time.Second).Unix() }, nil},
+		{"no exp", func(c map[string]any) { delete(c, "exp") }, ErrMalformedToken},
+		{"not yet valid", func(c map[string]any) { c["nbf"] = now.Add(time.Hour).Unix() }, ErrTokenNotYetValid},
+		{"issuer", func(c map[string]any) { c["iss"] = "https://evil.example.com" }, ErrInvalidIssuer},
+		{"audience", func(c map[string]any) { c["aud"] = "other" }, ErrInvalidAudience},
+		{"audience string", func(c map[string]any) { c["aud"] = "forwarder" }, nil},
+		{"no identity", func(c map[string]any) { delete(c, "sub") }, ErrMissingIdentity},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := v.Validate(keys[0].sign(t, claims(tc.mod))); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+
+	t.Run("bad signature", func(t *testing.T) {
+		token := keys[0].sign(t, claims(nil))
+		other := keys[1].sign(t, claims(nil))
+		token = token[:len(token)-10] + other[len(other)-10:]
+		if _, err := v.Validate(token); !errors.Is(err, ErrInvalidSignature) && !errors.Is(err, ErrMalformedToken) {
+			t.Fatalf("expected signature error, got %v", err)
+		}
+	})
+
+	t.Run("alg none", func(t *testing.T) {
+		k := &testKey{kid: "rsa", alg: "none", priv: keys[0].priv}
+		if _, err := v.Validate(k.sign(t, claims(nil))); !errors.Is(err, ErrMalformedToken) {
+			t.Fatalf("expected %v, got %v", ErrMalformedToken, err)
+		}
+	})
+}
+
+func TestKeysRotation(t *testing.T) {
+	keys := newTestKeys(t)
+
+	var current atomic.Pointer[[]byte]
+	b := keySetJSON(t, keys[0])
+	current.Store(&b)
+
+	var reloads atomic.Int32
+	ks, err := NewKeys(func() ([]byte, error) {
+		reloads.Add(1)
+		return *current.Load(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewValidator(DefaultConfig(), ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]any{"sub": "ci-job", "exp": time.Now().Add(time.Hour).Unix()}
+
+	// Rotate to a new key, the key set is not reloaded because it was loaded recently.
+	b = keySetJSON(t, keys[1])
+	current.Store(&b)
+	if _, err := v.Validate(keys[1].sign(t, claims)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+
+	// Unknown key triggers reload.
+	ks.mu.Lock()
+	ks.lastLoad = time.Now().Add(-time.Minute)
+	ks.mu.Unlock()
+	if _, err := v.Validate(keys[1].sign(t, claims)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Validate(keys[0].sign(t, claims)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected old key to be removed, got %v", err)
+	}
+	if n := reloads.Load(); n != 2 {
+		t.Fatalf("expected 2 loads, got %d", n)
+	}
+}
+
+func TestKeysReloadUnknown(t *testing.T) {
+	keys := newTestKeys(t)
+
+	var current atomic.Pointer[[]byte]
+	b := keySetJSON(t, keys[0])
+	current.Store(&b)
+
+	var (
+		reloads atomic.Int32
+		block   atomic.Bool
+		release = make(chan struct{})
+	)
+	ks, err := NewKeys(func() ([]byte, error) {
+		reloads.Add(1)
+		if block.Load() {
+			<-release
+		}
+		return *current.Load(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewValidator(DefaultConfig(), ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.mu.Lock()
+	ks.lastLoad = time.Now().Add(-time.Minute)
+	ks.mu.Unlock()
+
+	claims := map[string]any{"sub": "ci-job", "exp": time.Now().Add(time.Hour).Unix()}
+
+	// A known key ID with a bad signature does not trigger reload.
+	forged := &testKey{kid: keys[0].kid, alg: keys[1].alg, priv: keys[1].priv}
+	if _, err := v.Validate(forged.sign(t, claims)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+	if n := reloads.Load(); n != 1 {
+		t.Fatalf("expected no reload, got %d loads", n)
+	}
+
+	// Concurrent tokens signed with an unknown key share a single reload.
+	b = keySetJSON(t, keys[1])
+	current.Store(&b)
+	token := keys[1].sign(t, claims)
+	block.Store(true)
+
+	const n = 10
+	errs := make(chan error, n)
+	for range n {
+		go func() {
+			_, err := v.Validate(token)
+			errs <- err
+		}()
+	}
+	for reloads.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for range n {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := reloads.Load(); n != 2 {
+		t.Fatalf("expected 2 loads, got %d", n)
+	}
+}
+
+func TestParseKeySetErrors(t *testing.T) {
+	tests := []struct {
+		name, data string
+	}{
+		{"invalid json", "{"},
+		{"no keys", `{"keys":[]}`},
+		{"unsupported only", `{"keys":[{"kty":"oct","k":"AAAA"}]}`},
+		{"bad curve", `{"keys":[{"kty":"EC","crv":"P-192","x":"AA","y":"AA"}]}`},
+		{"not on curve", `{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseKeySet([]byte(tc.data)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
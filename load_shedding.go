@@ -0,0 +1,197 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+)
+
+// ErrProxyOverloaded is returned when the proxy refuses a request because it is overloaded.
+var ErrProxyOverloaded = errors.New("proxy overloaded")
+
+// Load shedding reasons.
+const (
+	shedRequests = "requests"
+	shedTunnels  = "tunnels"
+	shedMemory   = "memory"
+)
+
+type overloadedError struct {
+	reason string
+}
+
+func (e overloadedError) Error() string {
+	return ErrProxyOverloaded.Error() + ": " + e.reason
+}
+
+func (e overloadedError) Is(target error) bool {
+	return target == ErrProxyOverloaded
+}
+
+func (e overloadedError) RetryAfter() time.Duration {
+	return time.Second
+}
+
+type LoadSheddingConfig struct {
+	// MaxRequests is the maximum number of requests in flight, excluding CONNECT tunnels.
+	// Zero means no limit.
+	MaxRequests int
+	// MaxTunnels is the maximum number of open CONNECT tunnels, MITMed tunnels are not counted.
+	// Zero means no limit.
+	MaxTunnels int
+	// MemoryLimitRatio, if set, refuses requests when the live heap exceeds this fraction of the Go memory limit (GOMEMLIMIT).
+	// It has no effect if the memory limit is not set.
+	MemoryLimitRatio float64
+}
+
+func DefaultLoadSheddingConfig() *LoadSheddingConfig {
+	return &LoadSheddingConfig{}
+}
+
+func (c *LoadSheddingConfig) Validate() error {
+	if c.MaxRequests < 0 {
+		return errors.New("max requests must not be negative")
+	}
+	if c.MaxTunnels < 0 {
+		return errors.New("max tunnels must not be negative")
+	}
+	if c.MemoryLimitRatio < 0 || c.MemoryLimitRatio > 1 {
+		return errors.New("memory limit ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+func (c *LoadSheddingConfig) enabled() bool {
+	return c.MaxRequests > 0 || c.MaxTunnels > 0 || c.MemoryLimitRatio > 0
+}
+
+type loadSheddingContextKey struct{}
+
+// loadShedder counts requests in flight and open CONNECT tunnels,
+// a request is counted from the time it is checked until the response is written or the tunnel is closed.
+type loadShedder struct {
+	config  LoadSheddingConfig
+	metrics *httpProxyMetrics
+	mitm    func(req *http.Request) bool
+
+	requests atomic.Int64
+	tunnels  atomic.Int64
+	memory   memoryPressure
+}
+
+// newLoadShedder creates a new load shedder, mitm reports if a CONNECT request is going to be MITMed.
+func newLoadShedder(cfg *LoadSheddingConfig, metrics *httpProxyMetrics, mitm func(req *http.Request) bool) *loadShedder {
+	return &loadShedder{
+		config:  *cfg,
+		metrics: metrics,
+		mitm:    mitm,
+		memory:  memoryPressure{ratio: cfg.MemoryLimitRatio},
+	}
+}
+
+// counter returns the counter and the limit for the request.
+// The MITM decision is made after the CONNECT request modifiers run, so it is not known from the request context yet.
+func (s *loadShedder) counter(req *http.Request) (*atomic.Int64, int) {
+	if req.Method == http.MethodConnect && !s.mitm(req) {
+		return &s.tunnels, s.config.MaxTunnels
+	}
+	return &s.requests, s.config.MaxRequests
+}
+
+// check counts the request and returns an error if any of the limits is exceeded.
+// The request stays counted until done is called for the response.
+func (s *loadShedder) check(req *http.Request) error {
+	c, limit := s.counter(req)
+	n := c.Add(1)
+	martian.SetContextValue(req.Context(), loadSheddingContextKey{}, c)
+
+	var reason string
+	switch {
+	case limit > 0 && n > int64(limit):
+		reason = shedRequests
+		if c == &s.tunnels {
+			reason = shedTunnels
+		}
+	case s.memory.over():
+		reason = shedMemory
+	default:
+		return nil
+	}
+
+	s.metrics.shed(reason)
+	return overloadedError{reason: reason}
+}
+
+// done is called after the response is written, for CONNECT requests after the tunnel is closed.
+func (s *loadShedder) done(res *http.Response) {
+	if res.Request == nil {
+		return
+	}
+	ctx := res.Request.Context()
+	if c, ok := martian.ContextValue(ctx, loadSheddingContextKey{}).(*atomic.Int64); ok {
+		// Make sure the request is not uncounted twice.
+		martian.SetContextValue(ctx, loadSheddingContextKey{}, nil)
+		c.Add(-1)
+	}
+}
+
+// memoryPressureInterval is the minimum time between reads of the heap size.
+const memoryPressureInterval = 100 * time.Millisecond
+
+// memoryPressure reports if the live heap exceeds the ratio of the Go memory limit.
+type memoryPressure struct {
+	ratio float64
+
+	mu       sync.Mutex
+	lastRead time.Time
+	isOver   bool
+}
+
+func (m *memoryPressure) over() bool {
+	if m.ratio <= 0 {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastRead) < memoryPressureInterval {
+		return m.isOver
+	}
+	m.lastRead = now
+
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		m.isOver = false
+		return false
+	}
+
+	sample := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		m.isOver = false
+		return false
+	}
+	m.isOver = float64(sample[0].Value.Uint64()) > m.ratio*float64(limit)
+
+	return m.isOver
+}
+
+// loadShedding refuses requests when the proxy is overloaded with 503 status code.
+func (hp *HTTPProxy) loadShedding(s *loadShedder) martian.RequestModifier {
+	return martian.RequestModifierFunc(s.check)
+}
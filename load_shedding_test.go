@@ -0,0 +1,121 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/saucelabs/forwarder/log/slog"
+	"github.com/saucelabs/forwarder/ruleset"
+)
+
+func TestLoadSheddingMaxRequests(t *testing.T) {
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/block" {
+			inFlight <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	cfg := DefaultHTTPProxyConfig()
+	cfg.ProxyLocalhost = AllowProxyLocalhost
+	cfg.LoadShedding.MaxRequests = 1
+
+	p, err := NewHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	do := func(path string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, s.URL+path, http.NoBody)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		rw := httptest.NewRecorder()
+		p.handler().ServeHTTP(rw, req)
+		return rw.Result()
+	}
+
+	done := make(chan int)
+	go func() {
+		done <- do("/block").StatusCode
+	}()
+	<-inFlight
+
+	res := do("/")
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+	if ra := res.Header.Get("Retry-After"); ra != "1" {
+		t.Fatalf("unexpected Retry-After %q", ra)
+	}
+
+	close(release)
+	if got := <-done; got != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, got)
+	}
+
+	// Rejected requests are not counted after the response is written.
+	if got := do("/").StatusCode; got != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, got)
+	}
+	if n := p.loadShedder.requests.Load(); n != 0 {
+		t.Fatalf("expected no requests in flight, got %d", n)
+	}
+}
+
+func TestLoadSheddingMITMTunnels(t *testing.T) {
+	cfg := DefaultHTTPProxyConfig()
+	cfg.PromRegistry = prometheus.NewRegistry()
+	cfg.MITM = DefaultMITMConfig()
+	d, err := ruleset.NewRegexpMatcher([]*regexp.Regexp{regexp.MustCompile(`^mitm\.test$`)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MITMDomains = d
+	cfg.LoadShedding.MaxTunnels = 1
+
+	p, err := newHTTPProxy(cfg, nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	connect := func(host string) *http.Request {
+		return httptest.NewRequest(http.MethodConnect, host+":443", http.NoBody)
+	}
+
+	s := p.loadShedder
+	if c, _ := s.counter(connect("mitm.test")); c != &s.requests {
+		t.Fatal("expected MITMed CONNECT to be counted as request")
+	}
+	if c, _ := s.counter(connect("tunnel.test")); c != &s.tunnels {
+		t.Fatal("expected CONNECT to be counted as tunnel")
+	}
+}
+
+func TestLoadSheddingConfigValidate(t *testing.T) {
+	for _, c := range []LoadSheddingConfig{
+		{MaxRequests: -1},
+		{MaxTunnels: -1},
+		{MemoryLimitRatio: 1.5},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v: expected error", c)
+		}
+	}
+}
@@ -15,3 +15,29 @@ type MatchFunc func(string) bool
 func (m MatchFunc) Match(s string) bool {
 	return m(s)
 }
+
+// AnyMatcher returns a Matcher that matches if any of the matchers matches, nil matchers are ignored.
+// It returns nil if all matchers are nil.
+func AnyMatcher(ms ...Matcher) Matcher {
+	var res []Matcher
+	for _, m := range ms {
+		if m != nil {
+			res = append(res, m)
+		}
+	}
+	switch len(res) {
+	case 0:
+		return nil
+	case 1:
+		return res[0]
+	default:
+		return MatchFunc(func(s string) bool {
+			for _, m := range res {
+				if m.Match(s) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
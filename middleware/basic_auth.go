@@ -80,6 +80,31 @@ func parseBasicAuth(auth string) (username, password string, ok bool) {
 	return username, password, true
 }
 
+// BearerToken returns the token provided in the request's authorization header,
+// if the request uses Bearer Authentication.
+// See RFC 6750, Section 2.1.
+func (ba *BasicAuth) BearerToken(r *http.Request) (token string, ok bool) {
+	auth := r.Header.Get(ba.header)
+	if auth == "" {
+		return "", false
+	}
+	return parseBearerAuth(auth)
+}
+
+// parseBearerAuth parses an HTTP Bearer Authentication string.
+// "Bearer mF_9.B5f-4.1JqM" returns ("mF_9.B5f-4.1JqM", true).
+func parseBearerAuth(auth string) (token string, ok bool) {
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	token = strings.TrimSpace(auth[len(prefix):])
+	if token == "" {
+		return "", false
+	}
+	return token, true
+}
+
 // Wrap wraps the provided http.Handler with basic authentication.
 // If header is Proxy-Authorization and the request is not authenticated, the handler is not called and a 407 Proxy Authentication Required is returned.
 // Otherwise, if the request is not authenticated, the handler is not called and a 401 Unauthorized is returned.
@@ -25,6 +25,31 @@ func TestBasicAuth(t *testing.T) {
 	}
 }
 
+func TestBearerToken(t *testing.T) {
+	ba := NewProxyBasicAuth()
+
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"Bearer abc.def.ghi", "abc.def.ghi", true},
+		{"bearer abc", "abc", true},
+		{"Bearer ", "", false},
+		{"Basic dXNlcjpwYXNz", "", false},
+		{"", "", false},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		if tc.header != "" {
+			r.Header.Set(ProxyAuthorizationHeader, tc.header)
+		}
+		if token, ok := ba.BearerToken(r); token != tc.token || ok != tc.ok {
+			t.Errorf("BearerToken(%q) = %q, %v, want %q, %v", tc.header, token, ok, tc.token, tc.ok)
+		}
+	}
+}
+
 func TestBasicAuthWrap(t *testing.T) {
 	ba := NewBasicAuth()
 
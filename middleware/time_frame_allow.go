@@ -14,14 +14,7 @@ import (
 
 var getCurrentTime = time.Now
 
-// returns true if current time matches any entry in a list of allowed timeFrameEntry objects.
+// returns true if current time matches the allowed time frame, see ruleset.MatchTimeFrame.
 func TimeFrameAllows(allowRules []ruleset.TimeFrameEntry) bool {
-	currentTime := getCurrentTime()
-
-	for _, rule := range allowRules {
-		if rule.Match(currentTime) {
-			return true
-		}
-	}
-	return false
+	return ruleset.MatchTimeFrame(allowRules, getCurrentTime())
 }
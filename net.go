@@ -9,11 +9,16 @@ package forwarder
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"net/netip"
+	"os"
 	"slices"
+	"sync/atomic"
 	"time"
 
+	"github.com/saucelabs/connfu"
 	"github.com/saucelabs/forwarder/conntrack"
 	"github.com/saucelabs/forwarder/proxyproto"
 	"github.com/saucelabs/forwarder/ratelimit"
@@ -71,6 +76,13 @@ type DialConfig struct {
 
 	// Retry specifies the number of attempts and backoff duration between them.
 	Retry DialRetryConfig
+
+	// DenyNetworks are networks the dialer does not connect to.
+	// The check is done on resolved IP addresses right before connecting.
+	DenyNetworks []IPNetwork
+
+	// AllowNetworks are exceptions to DenyNetworks.
+	AllowNetworks []IPNetwork
 }
 
 func DefaultDialConfig() *DialConfig {
@@ -114,6 +126,9 @@ func NewDialer(cfg *DialConfig) *Dialer {
 			PreferGo: true,
 		},
 	}
+	if len(cfg.DenyNetworks) > 0 {
+		nd.ControlContext = denyDestinationControl(cfg.DenyNetworks, cfg.AllowNetworks)
+	}
 
 	return &Dialer{
 		nd:      nd,
@@ -198,6 +213,9 @@ func (d *Dialer) dialContext(ctx context.Context, network, address string) (net.
 		if conn != nil {
 			conn.Close()
 		}
+		if errors.Is(err, ErrDestinationDenied) {
+			break
+		}
 	}
 
 	return nil, lastErr
@@ -220,13 +238,102 @@ type ListenerConfig struct {
 	ReadLimit           SizeSuffix
 	WriteLimit          SizeSuffix
 	TrackTraffic        bool
+
+	// ConnReadLimit and ConnWriteLimit limit the bandwidth of each connection.
+	ConnReadLimit  SizeSuffix
+	ConnWriteLimit SizeSuffix
+	// ClientReadLimit and ClientWriteLimit limit the bandwidth shared by connections from the same client IP.
+	ClientReadLimit  SizeSuffix
+	ClientWriteLimit SizeSuffix
+	// UserReadLimit and UserWriteLimit limit the bandwidth shared by connections of the same authenticated user.
+	// They apply to a connection after the proxy authenticates the user.
+	UserReadLimit  SizeSuffix
+	UserWriteLimit SizeSuffix
+	// RateLimitIdleTimeout is the time after which per-client and per-user limiters that are not used are removed.
+	RateLimitIdleTimeout time.Duration
+	// DynamicRateLimit allows to change the listener and connection bandwidth limits at runtime even if no limit is set,
+	// see HTTPProxy.SetListenerBandwidth and HTTPProxy.SetConnBandwidth.
+	// Rate limited connections do not use zero-copy forwarding of tunneled traffic.
+	// It is always enabled for proxy listeners if network profiles are configured, see HTTPProxyConfig.NetworkProfiles.
+	DynamicRateLimit bool
+	// NetworkProfile is the name of the network profile emulated on connections unless another profile is selected,
+	// see HTTPProxyConfig.NetworkProfiles.
+	NetworkProfile string
+
+	// MaxConns is the maximum number of open connections, zero means no limit.
+	MaxConns int
+	// MaxConnsPerClient is the maximum number of open connections from a client IP, zero means no limit.
+	MaxConnsPerClient int
+	// OverloadResponse specifies how connections over MaxConns and MaxConnsPerClient are rejected.
+	OverloadResponse OverloadResponse
+
+	// ClientAllowCIDRs, if set, only connections from these networks are accepted.
+	ClientAllowCIDRs []netip.Prefix
+	// ClientDenyCIDRs are networks from which connections are rejected, it takes precedence over ClientAllowCIDRs.
+	ClientDenyCIDRs []netip.Prefix
+
+	// Inherited, if set, is used instead of listening on Address.
+	// It allows to serve on sockets passed by a service manager, see the activation package.
+	Inherited net.Listener
 }
 
 func DefaultListenerConfig(addr string) *ListenerConfig {
 	return &ListenerConfig{
-		Address:         addr,
-		KeepAliveConfig: defaultKeepAliveConfig(),
+		Address:              addr,
+		KeepAliveConfig:      defaultKeepAliveConfig(),
+		RateLimitIdleTimeout: 5 * time.Minute,
+		OverloadResponse:     OverloadClose,
+	}
+}
+
+func (c *ListenerConfig) Validate() error {
+	if c.RateLimitIdleTimeout <= 0 {
+		return errors.New("rate limit idle timeout must be positive")
 	}
+	return nil
+}
+
+var errClientIPDenied = errors.New("client IP denied")
+
+func (c *ListenerConfig) hasClientIPFilter() bool {
+	return len(c.ClientAllowCIDRs) > 0 || len(c.ClientDenyCIDRs) > 0
+}
+
+// clientIPAllowed returns true if connections from addr are allowed by the client IP allow and deny lists.
+func (c *ListenerConfig) clientIPAllowed(addr net.Addr) bool {
+	ip, ok := addrIP(addr)
+	if !ok {
+		return false
+	}
+	for _, p := range c.ClientDenyCIDRs {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	if len(c.ClientAllowCIDRs) == 0 {
+		return true
+	}
+	for _, p := range c.ClientAllowCIDRs {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func addrIP(addr net.Addr) (netip.Addr, bool) {
+	if ta, ok := addr.(*net.TCPAddr); ok {
+		ip, ok := netip.AddrFromSlice(ta.IP)
+		return ip.Unmap(), ok
+	}
+	if addr == nil {
+		return netip.Addr{}, false
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ap.Addr().Unmap(), true
 }
 
 type NamedListenerConfig struct {
@@ -277,8 +384,14 @@ type Listener struct {
 	TLSConfig *tls.Config
 	PromConfig
 
+	base     net.Listener
 	listener net.Listener
 	metrics  *listenerMetrics
+	rl       *ratelimit.Listener
+	conns    atomic.Int64
+	clients  *clientConns
+
+	shedWriters atomic.Int32
 }
 
 func (l *Listener) Listen() error {
@@ -290,28 +403,59 @@ func (l *Listener) Listen() error {
 	if err != nil {
 		return err
 	}
+	l.base = ll
 
 	if l.ProxyProtocolConfig != nil {
-		ll = &proxyproto.Listener{
+		pl := &proxyproto.Listener{
 			Listener:          ll,
 			ReadHeaderTimeout: l.ProxyProtocolConfig.ReadHeaderTimeout,
 		}
+		// The source address is known only after the header is read, do not block Accept waiting for it.
+		if l.hasClientIPFilter() {
+			pl.CheckSource = l.checkClientIP
+		}
+		ll = pl
 	}
 
-	if rl, wl := l.ReadLimit, l.WriteLimit; rl > 0 || wl > 0 {
-		ll = ratelimit.NewListener(ll, int64(rl), int64(wl))
+	if l.metrics == nil {
+		l.metrics = newListenerMetrics(l.PromRegistry, l.PromNamespace)
 	}
 
-	l.listener = ll
+	if rc := l.rateLimitConfig(); rc.Enabled() || l.DynamicRateLimit {
+		l.rl = ratelimit.NewListenerWithConfig(ll, rc)
+		ll = l.rl
+	}
 
-	if l.metrics == nil {
-		l.metrics = newListenerMetrics(l.PromRegistry, l.PromNamespace)
+	if l.MaxConnsPerClient > 0 {
+		l.clients = newClientConns(l.MaxConnsPerClient)
 	}
 
+	l.listener = ll
+
 	return nil
 }
 
+func (l *Listener) rateLimitConfig() ratelimit.Config {
+	return ratelimit.Config{
+		ReadLimit:        int64(l.ReadLimit),
+		WriteLimit:       int64(l.WriteLimit),
+		ConnReadLimit:    int64(l.ConnReadLimit),
+		ConnWriteLimit:   int64(l.ConnWriteLimit),
+		ClientReadLimit:  int64(l.ClientReadLimit),
+		ClientWriteLimit: int64(l.ClientWriteLimit),
+		UserReadLimit:    int64(l.UserReadLimit),
+		UserWriteLimit:   int64(l.UserWriteLimit),
+		IdleTimeout:      l.RateLimitIdleTimeout,
+		OnThrottle:       l.metrics.throttle,
+		OnFault:          l.metrics.fault,
+	}
+}
+
 func (l *Listener) listen() (net.Listener, error) {
+	if l.Inherited != nil {
+		return l.Inherited, nil
+	}
+
 	lc := &net.ListenConfig{
 		KeepAlive:       -1,
 		KeepAliveConfig: l.ListenerConfig.KeepAliveConfig,
@@ -321,19 +465,52 @@ func (l *Listener) listen() (net.Listener, error) {
 	return lc.Listen(context.Background(), "tcp", l.Address)
 }
 
+func (l *Listener) checkClientIP(addr net.Addr) error {
+	if !l.clientIPAllowed(addr) {
+		l.metrics.reject()
+		return fmt.Errorf("%w: %s", errClientIPDenied, addr)
+	}
+	return nil
+}
+
 // Accept returns tls.Conn if TLSConfig is set, as martian expects it to be on top.
 // Otherwise, it returns forwarder.TrackedConn.
+// Connections from client IPs not allowed by the listener configuration are closed right away,
+// unless proxy protocol is enabled, in which case they are closed after the header is read.
+// Connections over MaxConns are rejected right away, and connections over MaxConnsPerClient on first read.
 func (l *Listener) Accept() (net.Conn, error) {
-	conn, err := l.listener.Accept()
-	if err != nil {
-		l.metrics.error()
-		return nil, err
+	var (
+		conn net.Conn
+		err  error
+	)
+	for {
+		conn, err = l.listener.Accept()
+		if err != nil {
+			l.metrics.error()
+			return nil, err
+		}
+		if l.MaxConns > 0 && l.conns.Load() >= int64(l.MaxConns) {
+			l.shed(conn, shedMaxConns, true)
+			continue
+		}
+		if l.ProxyProtocolConfig != nil || !l.hasClientIPFilter() {
+			break
+		}
+		if err := l.checkClientIP(conn.RemoteAddr()); err == nil {
+			break
+		}
+		conn.Close()
+	}
+
+	if l.clients != nil {
+		conn = connfu.Combine(&clientLimitConn{Conn: conn, l: l}, conn)
 	}
 
 	l.metrics.accept()
+	l.conns.Add(1)
 	conn = conntrack.Builder{
 		TrackTraffic: l.TrackTraffic,
-		OnClose:      l.metrics.close,
+		OnClose:      l.onClose,
 	}.Build(conn)
 
 	if l.TLSConfig != nil {
@@ -343,6 +520,11 @@ func (l *Listener) Accept() (net.Conn, error) {
 	return conn, nil
 }
 
+func (l *Listener) onClose() {
+	l.conns.Add(-1)
+	l.metrics.close()
+}
+
 func (l *Listener) Addr() net.Addr {
 	if l.listener == nil {
 		return nil
@@ -350,6 +532,16 @@ func (l *Listener) Addr() net.Addr {
 	return l.listener.Addr()
 }
 
+// File returns a copy of the underlying socket file descriptor.
+// It can be passed to another process to continue serving on the same socket.
+func (l *Listener) File() (*os.File, error) {
+	fl, ok := l.base.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener %T does not support file descriptors", l.base)
+	}
+	return fl.File()
+}
+
 func (l *Listener) Close() error {
 	if l.listener == nil {
 		return nil
@@ -9,9 +9,11 @@ package forwarder
 import (
 	"net"
 	"slices"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/saucelabs/forwarder/ratelimit"
 )
 
 type dialerMetrics struct {
@@ -94,9 +96,13 @@ func addr2Host(addr string) string {
 }
 
 type listenerMetrics struct {
-	errors   prometheus.Counter
-	accepted prometheus.Counter
-	active   prometheus.Gauge
+	errors    prometheus.Counter
+	accepted  prometheus.Counter
+	rejected  prometheus.Counter
+	active    prometheus.Gauge
+	shedConns *prometheus.CounterVec
+	throttled *prometheus.CounterVec
+	faults    *prometheus.CounterVec
 }
 
 func newListenerMetrics(r prometheus.Registerer, namespace string) *listenerMetrics {
@@ -116,11 +122,31 @@ func newListenerMetrics(r prometheus.Registerer, namespace string) *listenerMetr
 			Namespace: namespace,
 			Help:      "Number of accepted connections",
 		}),
+		rejected: f.NewCounter(prometheus.CounterOpts{
+			Name:      "listener_rejected_cx_total",
+			Namespace: namespace,
+			Help:      "Number of connections rejected by client IP allow and deny lists",
+		}),
 		active: f.NewGauge(prometheus.GaugeOpts{
 			Name:      "listener_cx_active",
 			Namespace: namespace,
 			Help:      "Number of active connections",
 		}),
+		shedConns: f.NewCounterVec(prometheus.CounterOpts{
+			Name:      "listener_shed_cx_total",
+			Namespace: namespace,
+			Help:      "Number of connections rejected by connection limits by reason",
+		}, []string{"reason"}),
+		throttled: f.NewCounterVec(prometheus.CounterOpts{
+			Name:      "listener_throttled_seconds_total",
+			Namespace: namespace,
+			Help:      "Time connections were delayed by bandwidth limits",
+		}, []string{"scope", "direction"}),
+		faults: f.NewCounterVec(prometheus.CounterOpts{
+			Name:      "listener_emulated_faults_total",
+			Namespace: namespace,
+			Help:      "Number of connection resets and stalls emulated by network profiles",
+		}, []string{"profile", "fault"}),
 	}
 }
 
@@ -133,10 +159,30 @@ func (m *listenerMetrics) accept() {
 	m.active.Inc()
 }
 
+func (m *listenerMetrics) reject() {
+	m.rejected.Inc()
+}
+
 func (m *listenerMetrics) close() {
 	m.active.Dec()
 }
 
+func (m *listenerMetrics) shed(reason string) {
+	m.shedConns.WithLabelValues(reason).Inc()
+}
+
+func (m *listenerMetrics) throttle(scope ratelimit.Scope, read bool, d time.Duration) {
+	direction := "write"
+	if read {
+		direction = "read"
+	}
+	m.throttled.WithLabelValues(string(scope), direction).Add(d.Seconds())
+}
+
+func (m *listenerMetrics) fault(profile string, f ratelimit.Fault) {
+	m.faults.WithLabelValues(profile, string(f)).Inc()
+}
+
 func newListenerMetricsWithNameFunc(r prometheus.Registerer, namespace string) func(name string) *listenerMetrics {
 	if r == nil {
 		r = prometheus.NewRegistry() // This registry will be discarded.
@@ -153,17 +199,41 @@ func newListenerMetricsWithNameFunc(r prometheus.Registerer, namespace string) f
 		Namespace: namespace,
 		Help:      "Number of accepted connections",
 	}, []string{"name"})
+	rejected := f.NewCounterVec(prometheus.CounterOpts{
+		Name:      "listener_rejected_cx_total",
+		Namespace: namespace,
+		Help:      "Number of connections rejected by client IP allow and deny lists",
+	}, []string{"name"})
 	active := f.NewGaugeVec(prometheus.GaugeOpts{
 		Name:      "listener_cx_active",
 		Namespace: namespace,
 		Help:      "Number of active connections",
 	}, []string{"name"})
+	shedConns := f.NewCounterVec(prometheus.CounterOpts{
+		Name:      "listener_shed_cx_total",
+		Namespace: namespace,
+		Help:      "Number of connections rejected by connection limits by reason",
+	}, []string{"name", "reason"})
+	throttled := f.NewCounterVec(prometheus.CounterOpts{
+		Name:      "listener_throttled_seconds_total",
+		Namespace: namespace,
+		Help:      "Time connections were delayed by bandwidth limits",
+	}, []string{"name", "scope", "direction"})
+	faults := f.NewCounterVec(prometheus.CounterOpts{
+		Name:      "listener_emulated_faults_total",
+		Namespace: namespace,
+		Help:      "Number of connection resets and stalls emulated by network profiles",
+	}, []string{"name", "profile", "fault"})
 
 	return func(name string) *listenerMetrics {
 		return &listenerMetrics{
-			errors:   errors.WithLabelValues(name),
-			accepted: accepted.WithLabelValues(name),
-			active:   active.WithLabelValues(name),
+			errors:    errors.WithLabelValues(name),
+			accepted:  accepted.WithLabelValues(name),
+			rejected:  rejected.WithLabelValues(name),
+			active:    active.WithLabelValues(name),
+			shedConns: shedConns.MustCurryWith(prometheus.Labels{"name": name}),
+			throttled: throttled.MustCurryWith(prometheus.Labels{"name": name}),
+			faults:    faults.MustCurryWith(prometheus.Labels{"name": name}),
 		}
 	}
 }
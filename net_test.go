@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
 	"strconv"
 	"testing"
 	"time"
@@ -283,6 +284,37 @@ func TestListenerListenOnce(t *testing.T) {
 	}
 }
 
+func TestListenerInherited(t *testing.T) {
+	il, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := Listener{
+		ListenerConfig: ListenerConfig{
+			Inherited: il,
+		},
+	}
+	defer l.Close()
+
+	l.listenAndWait(t)
+	go l.acceptAndCopy()
+
+	if got, want := l.Addr().String(), il.Addr().String(); got != want {
+		t.Fatalf("l.Addr(): got %s, want %s", got, want)
+	}
+
+	conn, err := net.Dial("tcp", il.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial(): got %v, want no error", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "Hello, World!\n")
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestListenerMetricsAccepted(t *testing.T) {
 	r := prometheus.NewRegistry()
 	l := Listener{
@@ -484,3 +516,96 @@ func TestMultiListenerMetrics(t *testing.T) {
 
 	golden.DiffPrometheusMetrics(t, r)
 }
+
+func TestListenerClientIPFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ListenerConfig
+		header string
+		allow  bool
+	}{
+		{
+			name:   "allow",
+			config: ListenerConfig{ClientAllowCIDRs: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}},
+			allow:  true,
+		},
+		{
+			name:   "not allowed",
+			config: ListenerConfig{ClientAllowCIDRs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+		},
+		{
+			name: "deny takes precedence",
+			config: ListenerConfig{
+				ClientAllowCIDRs: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+				ClientDenyCIDRs:  []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+			},
+		},
+		{
+			name: "proxy protocol allow",
+			config: ListenerConfig{
+				ProxyProtocolConfig: DefaultProxyProtocolConfig(),
+				ClientAllowCIDRs:    []netip.Prefix{netip.MustParsePrefix("1.1.1.0/24")},
+			},
+			header: "PROXY TCP4 1.1.1.1 2.2.2.2 1000 2000\r\n",
+			allow:  true,
+		},
+		{
+			name: "proxy protocol deny",
+			config: ListenerConfig{
+				ProxyProtocolConfig: DefaultProxyProtocolConfig(),
+				ClientDenyCIDRs:     []netip.Prefix{netip.MustParsePrefix("1.1.1.0/24")},
+			},
+			header: "PROXY TCP4 1.1.1.1 2.2.2.2 1000 2000\r\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := prometheus.NewRegistry()
+			l := Listener{
+				ListenerConfig: tc.config,
+				PromConfig: PromConfig{
+					PromNamespace: "test",
+					PromRegistry:  r,
+				},
+			}
+			l.Address = testListenerConfig.Address
+			defer l.Close()
+
+			l.listenAndWait(t)
+			go l.acceptAndCopy()
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatalf("net.Dial(): got %v, want no error", err)
+			}
+			defer conn.Close()
+			fmt.Fprintf(conn, "%sHello, World!\n", tc.header)
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, err = conn.Read(make([]byte, 1))
+			if tc.allow && err != nil {
+				t.Fatalf("conn.Read(): got %v, want no error", err)
+			}
+			if !tc.allow && err == nil {
+				t.Fatal("conn.Read(): got no error, want connection closed")
+			}
+			conn.Close()
+
+			golden.DiffPrometheusMetrics(t, r)
+		})
+	}
+}
+
+func TestListenerConfigValidate(t *testing.T) {
+	if err := DefaultListenerConfig(":0").Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []time.Duration{0, -time.Second} {
+		c := DefaultListenerConfig(":0")
+		c.RateLimitIdleTimeout = d
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: expected error", d)
+		}
+	}
+}
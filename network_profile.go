@@ -0,0 +1,367 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+	"github.com/saucelabs/forwarder/ratelimit"
+	"github.com/saucelabs/forwarder/ruleset"
+)
+
+// ErrUnknownNetworkProfile is returned when a request selects a network profile that is not configured.
+var ErrUnknownNetworkProfile = errors.New("unknown network profile")
+
+// NetworkProfile is a named set of network conditions emulated on client connections,
+// it applies to plain HTTP requests and CONNECT tunnels alike.
+type NetworkProfile struct {
+	Name string
+	// ReadLimit and WriteLimit limit the bandwidth of each connection, see ListenerConfig.
+	ReadLimit  SizeSuffix
+	WriteLimit SizeSuffix
+	// Latency is added to each read and write, Jitter is the maximum random deviation from Latency.
+	Latency time.Duration
+	Jitter  time.Duration
+	// ResetProbability is the probability of resetting the connection on a read or write.
+	ResetProbability float64
+	// StallProbability is the probability of delaying a read or write by StallDuration.
+	StallProbability float64
+	StallDuration    time.Duration
+
+	spec string
+}
+
+// defaultStallDuration is used if the stall probability is set without duration.
+const defaultStallDuration = 5 * time.Second
+
+var networkProfileNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// ParseNetworkProfile parses a profile in the format <name>:<key>=<value>[;<key>=<value>...].
+// The keys are read-limit, write-limit, latency, jitter, reset, stall and stall-duration.
+func ParseNetworkProfile(val string) (NetworkProfile, error) {
+	name, params, ok := strings.Cut(val, ":")
+	if !ok {
+		return NetworkProfile{}, fmt.Errorf("invalid network profile %q, expected <name>:<key>=<value>[;...]", val)
+	}
+	if !networkProfileNameRe.MatchString(name) {
+		return NetworkProfile{}, fmt.Errorf("invalid network profile name %q", name)
+	}
+
+	p := NetworkProfile{
+		Name: name,
+		spec: val,
+	}
+	for _, kv := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return NetworkProfile{}, fmt.Errorf("invalid network profile parameter %q, expected <key>=<value>", kv)
+		}
+		if err := p.set(k, v); err != nil {
+			return NetworkProfile{}, fmt.Errorf("network profile %s: %s: %w", name, k, err)
+		}
+	}
+	if p.StallProbability > 0 && p.StallDuration == 0 {
+		p.StallDuration = defaultStallDuration
+	}
+
+	return p, nil
+}
+
+func (p *NetworkProfile) set(key, val string) error {
+	duration := func(d *time.Duration) error {
+		v, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		if v < 0 {
+			return errors.New("must not be negative")
+		}
+		*d = v
+		return nil
+	}
+	probability := func(f *float64) error {
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return err
+		}
+		if v < 0 || v > 1 {
+			return errors.New("must be between 0 and 1")
+		}
+		*f = v
+		return nil
+	}
+
+	switch key {
+	case "read-limit":
+		return p.ReadLimit.Set(val)
+	case "write-limit":
+		return p.WriteLimit.Set(val)
+	case "latency":
+		return duration(&p.Latency)
+	case "jitter":
+		return duration(&p.Jitter)
+	case "reset":
+		return probability(&p.ResetProbability)
+	case "stall":
+		return probability(&p.StallProbability)
+	case "stall-duration":
+		return duration(&p.StallDuration)
+	default:
+		return errors.New("unknown parameter")
+	}
+}
+
+func (p NetworkProfile) String() string {
+	return p.spec
+}
+
+func (p *NetworkProfile) profile() *ratelimit.Profile {
+	return &ratelimit.Profile{
+		Name:             p.Name,
+		ReadLimit:        int64(p.ReadLimit),
+		WriteLimit:       int64(p.WriteLimit),
+		Latency:          p.Latency,
+		Jitter:           p.Jitter,
+		ResetProbability: p.ResetProbability,
+		StallProbability: p.StallProbability,
+		StallDuration:    p.StallDuration,
+	}
+}
+
+// NetworkProfileRule selects the network profile for requests from clients in a network or to matching domains.
+type NetworkProfileRule struct {
+	Client  netip.Prefix
+	Domains Matcher
+	Profile string
+
+	spec string
+}
+
+// ParseNetworkProfileRule parses a rule in the format client:<cidr>=<profile> or domain:<regexp>=<profile>.
+func ParseNetworkProfileRule(val string) (NetworkProfileRule, error) {
+	i := strings.LastIndex(val, "=")
+	if i < 0 {
+		return NetworkProfileRule{}, fmt.Errorf("invalid network profile rule %q, expected <client|domain>:<value>=<profile>", val)
+	}
+	sel, profile := val[:i], val[i+1:]
+	if !networkProfileNameRe.MatchString(profile) {
+		return NetworkProfileRule{}, fmt.Errorf("invalid network profile name %q", profile)
+	}
+
+	r := NetworkProfileRule{
+		Profile: profile,
+		spec:    val,
+	}
+	kind, v, _ := strings.Cut(sel, ":")
+	switch kind {
+	case "client":
+		p, err := parseCIDROrIP(v)
+		if err != nil {
+			return NetworkProfileRule{}, err
+		}
+		r.Client = p
+	case "domain":
+		item, err := ruleset.ParseRegexpListItem(v)
+		if err != nil {
+			return NetworkProfileRule{}, err
+		}
+		if item.Exclude {
+			return NetworkProfileRule{}, errors.New("exclude rules are not supported")
+		}
+		m, err := ruleset.NewRegexpMatcherFromList([]ruleset.RegexpListItem{item})
+		if err != nil {
+			return NetworkProfileRule{}, err
+		}
+		r.Domains = m
+	default:
+		return NetworkProfileRule{}, fmt.Errorf("invalid network profile rule %q, expected <client|domain>:<value>=<profile>", val)
+	}
+
+	return r, nil
+}
+
+func parseCIDROrIP(val string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(val); err == nil {
+		return p.Masked(), nil
+	}
+	ip, err := netip.ParseAddr(val)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid client network %q", val)
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+func (r NetworkProfileRule) String() string {
+	return r.spec
+}
+
+func (r *NetworkProfileRule) match(ip netip.Addr, host string) bool {
+	if r.Client.IsValid() {
+		return ip.IsValid() && r.Client.Contains(ip)
+	}
+	return r.Domains != nil && r.Domains.Match(host)
+}
+
+// networkEmulator selects network profiles for client connections.
+type networkEmulator struct {
+	profiles map[string]*ratelimit.Profile
+	rules    []NetworkProfileRule
+	header   string
+
+	// clients are profiles set for client IPs at runtime, they take precedence over the rules.
+	mu      sync.Mutex
+	clients map[netip.Addr]*ratelimit.Profile
+}
+
+func newNetworkEmulator(cfg *HTTPProxyConfig) *networkEmulator {
+	e := &networkEmulator{
+		profiles: make(map[string]*ratelimit.Profile, len(cfg.NetworkProfiles)),
+		rules:    cfg.NetworkProfileRules,
+		header:   cfg.NetworkProfileHeader,
+		clients:  make(map[netip.Addr]*ratelimit.Profile),
+	}
+	for i := range cfg.NetworkProfiles {
+		p := &cfg.NetworkProfiles[i]
+		e.profiles[p.Name] = p.profile()
+	}
+	return e
+}
+
+// profile returns the profile with the given name, empty name returns nil profile.
+func (e *networkEmulator) profile(name string) (*ratelimit.Profile, error) {
+	if name == "" {
+		return nil, nil //nolint:nilnil // nil profile means no emulation
+	}
+	p, ok := e.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownNetworkProfile, name)
+	}
+	return p, nil
+}
+
+func (e *networkEmulator) setClientProfile(ip netip.Addr, p *ratelimit.Profile) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if p == nil {
+		delete(e.clients, ip)
+	} else {
+		e.clients[ip] = p
+	}
+}
+
+func (e *networkEmulator) clientProfile(ip netip.Addr) *ratelimit.Profile {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.clients[ip]
+}
+
+// selectProfile returns the profile selected by the request header, the client IP set at runtime or the first matching rule.
+// Nil profile means the listener profile applies.
+func (e *networkEmulator) selectProfile(req *http.Request) (*ratelimit.Profile, error) {
+	if e.header != "" {
+		name := req.Header.Get(e.header)
+		req.Header.Del(e.header)
+		if name != "" {
+			return e.profile(name)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip, _ := netip.ParseAddr(host)
+	ip = ip.Unmap()
+	if p := e.clientProfile(ip); p != nil {
+		return p, nil
+	}
+
+	for i := range e.rules {
+		if e.rules[i].match(ip, req.URL.Hostname()) {
+			return e.profile(e.rules[i].Profile)
+		}
+	}
+
+	return nil, nil //nolint:nilnil // nil profile means the listener profile
+}
+
+// networkProfile applies the network profile selected for the request to the client connection,
+// requests selecting unknown profiles are rejected with 400 status code.
+// The profile applies to the connection until another request selects a different one.
+func (hp *HTTPProxy) networkProfile(e *networkEmulator) martian.RequestModifier {
+	return martian.RequestModifierFunc(func(req *http.Request) error {
+		p, err := e.selectProfile(req)
+		if err != nil {
+			return err
+		}
+		if conn := martian.ContextConn(req.Context()); conn != nil {
+			ratelimit.SetConnProfile(conn, p)
+		}
+		return nil
+	})
+}
+
+func (c *HTTPProxyConfig) validateNetworkProfiles() error {
+	names := make(map[string]bool, len(c.NetworkProfiles))
+	for _, p := range c.NetworkProfiles {
+		if names[p.Name] {
+			return fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+
+	check := func(name string) error {
+		if name != "" && !names[name] {
+			return fmt.Errorf("%w: %q", ErrUnknownNetworkProfile, name)
+		}
+		return nil
+	}
+	for _, r := range c.NetworkProfileRules {
+		if err := check(r.Profile); err != nil {
+			return err
+		}
+	}
+	if err := check(c.NetworkProfile); err != nil {
+		return err
+	}
+	for _, lc := range c.ExtraListeners {
+		if err := check(lc.NetworkProfile); err != nil {
+			return fmt.Errorf("listener %s: %w", lc.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// applyListenerNetworkProfiles sets the network profiles of the listeners, see ListenerConfig.NetworkProfile.
+func (hp *HTTPProxy) applyListenerNetworkProfiles() {
+	if hp.netem == nil {
+		return
+	}
+	for i, l := range hp.listeners {
+		name := hp.config.NetworkProfile
+		if i > 0 {
+			name = hp.config.ExtraListeners[i-1].NetworkProfile
+		}
+		if fl, ok := l.(*Listener); ok && fl.rl != nil {
+			p, _ := hp.netem.profile(name) //nolint:errcheck // validated in HTTPProxyConfig.Validate
+			fl.rl.SetProfile(p)
+		}
+	}
+}
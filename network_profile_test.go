@@ -0,0 +1,113 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParseNetworkProfile(t *testing.T) {
+	p, err := ParseNetworkProfile("3g:read-limit=1M;write-limit=256K;latency=100ms;jitter=20ms;stall=0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "3g" || p.ReadLimit != 1<<20 || p.WriteLimit != 256<<10 || p.Latency != 100*time.Millisecond ||
+		p.Jitter != 20*time.Millisecond || p.StallProbability != 0.1 || p.StallDuration != defaultStallDuration {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+
+	for _, val := range []string{"3g", "3 g:latency=1s", "3g:latency", "3g:latency=-1s", "3g:reset=2", "3g:foo=1"} {
+		if _, err := ParseNetworkProfile(val); err == nil {
+			t.Errorf("%q: expected error", val)
+		}
+	}
+}
+
+func TestNetworkEmulatorSelectProfile(t *testing.T) {
+	parse := func(vals ...string) []NetworkProfileRule {
+		var res []NetworkProfileRule
+		for _, v := range vals {
+			r, err := ParseNetworkProfileRule(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, r)
+		}
+		return res
+	}
+
+	cfg := DefaultHTTPProxyConfig()
+	for _, v := range []string{"slow:latency=1s", "flaky:reset=0.5"} {
+		p, err := ParseNetworkProfile(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.NetworkProfiles = append(cfg.NetworkProfiles, p)
+	}
+	cfg.NetworkProfileRules = parse("client:10.0.0.0/8=slow", `domain:\.example\.com$=flaky`)
+	cfg.NetworkProfileHeader = "X-Network-Profile"
+	if err := cfg.validateNetworkProfiles(); err != nil {
+		t.Fatal(err)
+	}
+	e := newNetworkEmulator(cfg)
+
+	tests := []struct {
+		remoteAddr string
+		url        string
+		header     string
+		profile    string
+		err        error
+	}{
+		{"10.1.2.3:1234", "http://foo.com/", "", "slow", nil},
+		{"192.168.0.1:1234", "http://www.example.com/", "", "flaky", nil},
+		{"192.168.0.1:1234", "http://foo.com/", "", "", nil},
+		{"192.168.0.1:1234", "http://foo.com/", "slow", "slow", nil},
+		{"10.1.2.3:1234", "http://foo.com/", "fast", "", ErrUnknownNetworkProfile},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", tc.url, nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.header != "" {
+			req.Header.Set(cfg.NetworkProfileHeader, tc.header)
+		}
+		p, err := e.selectProfile(req)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s %s: expected error %v, got %v", tc.remoteAddr, tc.url, tc.err, err)
+			continue
+		}
+		if name := profileName(p); name != tc.profile {
+			t.Errorf("%s %s: expected profile %q, got %q", tc.remoteAddr, tc.url, tc.profile, name)
+		}
+		if req.Header.Get(cfg.NetworkProfileHeader) != "" {
+			t.Errorf("%s %s: expected header to be removed", tc.remoteAddr, tc.url)
+		}
+	}
+
+	// Client profile set at runtime takes precedence over the rules.
+	slow, _ := e.profile("slow")
+	e.setClientProfile(netip.MustParseAddr("192.168.0.1"), slow)
+	req := httptest.NewRequest("GET", "http://www.example.com/", nil)
+	req.RemoteAddr = "192.168.0.1:1234"
+	if p, _ := e.selectProfile(req); profileName(p) != "slow" {
+		t.Errorf("expected client profile, got %q", profileName(p))
+	}
+
+	for _, val := range []string{"client:10.0.0.0/8", "client:foo=slow", "host:foo=slow", `domain:-foo=slow`, "client:10.0.0.1=s low"} {
+		if _, err := ParseNetworkProfileRule(val); err == nil {
+			t.Errorf("%q: expected error", val)
+		}
+	}
+
+	cfg.NetworkProfileRules = parse("client:10.0.0.1=fast")
+	if err := cfg.validateNetworkProfiles(); !errors.Is(err, ErrUnknownNetworkProfile) {
+		t.Errorf("expected unknown profile error, got %v", err)
+	}
+}
@@ -7,6 +7,7 @@
 package forwarder
 
 import (
+	"io"
 	"net/url"
 
 	"github.com/saucelabs/forwarder/log"
@@ -32,3 +33,11 @@ func (r *LoggingPACResolver) FindProxyForURL(u *url.URL, hostname string) (strin
 	}
 	return s, err
 }
+
+// Close closes the underlying resolver if it implements io.Closer.
+func (r *LoggingPACResolver) Close() error {
+	if c, ok := r.Resolver.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
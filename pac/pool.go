@@ -10,10 +10,12 @@ import (
 	"net"
 	"net/url"
 	"sync"
+	"sync/atomic"
 )
 
 type ProxyResolverPool struct {
-	pool sync.Pool
+	pool   sync.Pool
+	closed atomic.Bool
 }
 
 func NewProxyResolverPool(cfg *ProxyResolverConfig, r *net.Resolver, opts ...Option) (*ProxyResolverPool, error) {
@@ -42,10 +44,19 @@ func NewProxyResolverPool(cfg *ProxyResolverConfig, r *net.Resolver, opts ...Opt
 func (pool *ProxyResolverPool) FindProxyForURL(u *url.URL, hostname string) (p string, err error) {
 	pr := pool.get()
 	p, err = pr.FindProxyForURL(u, hostname)
-	pool.pool.Put(pr)
+	if !pool.closed.Load() {
+		pool.pool.Put(pr)
+	}
 	return
 }
 
+// Close stops the pool from keeping resolvers, so that they can be garbage collected once in-flight calls return.
+// The pool can still be used after Close, every call creates a new resolver.
+func (pool *ProxyResolverPool) Close() error {
+	pool.closed.Store(true)
+	return nil
+}
+
 func (pool *ProxyResolverPool) get() *ProxyResolver {
 	return pool.pool.Get().(*ProxyResolver) //nolint:forcetypeassert // we know it's a ProxyResolver
 }
@@ -47,3 +47,27 @@ func TestProxyResolverPoolHammering(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestProxyResolverPoolClose(t *testing.T) {
+	u, err := url.ParseRequestURI("https://www.google.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := NewProxyResolverPool(&ProxyResolverConfig{Script: `function FindProxyForURL(url, host) { return "DIRECT"; }`}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// In-flight calls of a replaced pool still work after Close.
+	p, err := pool.FindProxyForURL(u, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "DIRECT" {
+		t.Fatalf("expected DIRECT, got %s", p)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+	"github.com/saucelabs/forwarder/ruleset"
+)
+
+// ErrProxyPortDenied is returned when the destination port is not allowed.
+var ErrProxyPortDenied = errors.New("proxying to port denied")
+
+func portAllowed(ranges []PortRange, port int) bool {
+	return slices.ContainsFunc(ranges, func(pr PortRange) bool { return pr.Contains(port) })
+}
+
+// PortRule allows a set of destination ports for matching domains.
+type PortRule struct {
+	Domains Matcher
+	Ports   []PortRange
+
+	spec string
+}
+
+// ParsePortRule parses a rule in the format <regexp>=<port>[;<port>...], where port is a single port or a port range.
+func ParsePortRule(val string) (PortRule, error) {
+	i := strings.LastIndex(val, "=")
+	if i <= 0 {
+		return PortRule{}, fmt.Errorf("invalid port rule %q, expected <regexp>=<ports>", val)
+	}
+
+	item, err := ruleset.ParseRegexpListItem(val[:i])
+	if err != nil {
+		return PortRule{}, err
+	}
+	if item.Exclude {
+		return PortRule{}, errors.New("exclude rules are not supported")
+	}
+	m, err := ruleset.NewRegexpMatcherFromList([]ruleset.RegexpListItem{item})
+	if err != nil {
+		return PortRule{}, err
+	}
+
+	var ports []PortRange
+	for _, s := range strings.Split(val[i+1:], ";") {
+		r, err := ParsePortRange(s)
+		if err != nil {
+			return PortRule{}, err
+		}
+		ports = append(ports, r)
+	}
+
+	return PortRule{Domains: m, Ports: ports, spec: val}, nil
+}
+
+func (r PortRule) String() string {
+	return r.spec
+}
+
+// denyPorts denies CONNECT requests to ports not allowed by the first matching rule or connectPorts,
+// and plain HTTP requests to ports not in httpPorts.
+// Requests read from MITMed tunnels are not checked, the port was checked on CONNECT.
+func (hp *HTTPProxy) denyPorts(connectPorts []PortRange, rules []PortRule, httpPorts []PortRange) martian.RequestModifier {
+	return martian.RequestModifierFunc(func(req *http.Request) error {
+		var (
+			allowed     []PortRange
+			defaultPort string
+		)
+		switch {
+		case req.Method == http.MethodConnect:
+			allowed, defaultPort = connectPorts, "443"
+			for _, r := range rules {
+				if r.Domains.Match(req.URL.Hostname()) {
+					allowed = r.Ports
+					break
+				}
+			}
+		case req.URL.Scheme == "http" && !martian.ContextMITM(req.Context()):
+			allowed, defaultPort = httpPorts, "80"
+		}
+		if len(allowed) == 0 {
+			return nil
+		}
+
+		port := req.URL.Port()
+		if port == "" {
+			port = defaultPort
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil || !portAllowed(allowed, p) {
+			return fmt.Errorf("%w: %s", ErrProxyPortDenied, port)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePortRule(t *testing.T) {
+	r, err := ParsePortRule(`^ssh\.example\.com$=22;2200-2299`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Domains.Match("ssh.example.com") || r.Domains.Match("www.example.com") {
+		t.Fatal("unexpected domain match")
+	}
+	if len(r.Ports) != 2 || r.Ports[0] != (PortRange{22, 22}) || r.Ports[1] != (PortRange{2200, 2299}) {
+		t.Fatalf("unexpected ports %v", r.Ports)
+	}
+
+	for _, val := range []string{"example.com", "=22", "example.com=", "example.com=0", "-example.com=22", "example.com=22;x"} {
+		if _, err := ParsePortRule(val); err == nil {
+			t.Errorf("%q: expected error", val)
+		}
+	}
+}
+
+func TestDenyPorts(t *testing.T) {
+	rule, err := ParsePortRule(`^ssh\.example\.com$=22`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectPorts := []PortRange{{443, 443}, {8000, 8100}}
+	httpPorts := []PortRange{{80, 80}}
+
+	tests := []struct {
+		method, url string
+		deny        bool
+	}{
+		{http.MethodConnect, "example.com:443", false},
+		{http.MethodConnect, "example.com:8050", false},
+		{http.MethodConnect, "example.com:25", true},
+		{http.MethodConnect, "ssh.example.com:22", false},
+		{http.MethodConnect, "ssh.example.com:443", true},
+		{http.MethodGet, "http://example.com/", false},
+		{http.MethodGet, "http://example.com:8080/", true},
+		{http.MethodGet, "https://example.com:8443/", false},
+	}
+
+	m := new(HTTPProxy).denyPorts(connectPorts, []PortRule{rule}, httpPorts)
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.url, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, http.NoBody)
+			err := m.ModifyRequest(req)
+			if tc.deny != errors.Is(err, ErrProxyPortDenied) {
+				t.Fatalf("expected deny=%v, got %v", tc.deny, err)
+			}
+		})
+	}
+}
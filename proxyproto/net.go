@@ -25,6 +25,7 @@ type Conn struct {
 	net.Conn
 
 	readHeaderTimeout time.Duration
+	checkSource       func(net.Addr) error
 	isHeaderRead      atomic.Bool
 	headerMu          sync.Mutex
 	header            Header
@@ -142,6 +143,17 @@ func (c *Conn) readHeaderContext(ctx context.Context) error {
 		c.headerErr = r.err
 	}
 
+	if c.headerErr == nil && c.checkSource != nil {
+		src := c.header.Source
+		if src == nil || c.header.IsLocal {
+			src = c.Conn.RemoteAddr()
+		}
+		if err := c.checkSource(src); err != nil {
+			c.Conn.Close()
+			c.headerErr = err
+		}
+	}
+
 	c.isHeaderRead.Store(true)
 
 	return c.headerErr
@@ -150,6 +162,11 @@ func (c *Conn) readHeaderContext(ctx context.Context) error {
 type Listener struct {
 	net.Listener
 	ReadHeaderTimeout time.Duration
+
+	// CheckSource, if set, is called with the source address from the header after it is read.
+	// If it returns an error, the connection is closed and the error is returned by all subsequent operations.
+	CheckSource func(net.Addr) error
+
 	TestingSkipConnfu bool
 }
 
@@ -162,6 +179,7 @@ func (l *Listener) Accept() (net.Conn, error) {
 	pc := &Conn{
 		Conn:              c,
 		readHeaderTimeout: l.ReadHeaderTimeout,
+		checkSource:       l.CheckSource,
 	}
 
 	if l.TestingSkipConnfu {
@@ -7,32 +7,253 @@
 package ratelimit
 
 import (
-	"context"
+	"crypto/tls"
 	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/saucelabs/forwarder/utils/reflectx"
 	"golang.org/x/time/rate"
 )
 
+// ThrottleFunc is called with the time a read or write was delayed by a limiter of the scope.
+type ThrottleFunc func(scope Scope, read bool, d time.Duration)
+
 type Conn struct {
 	net.Conn
-	rxLimiter *rate.Limiter
-	txLimiter *rate.Limiter
-}
 
-var waitContext = context.Background()
+	// limiters are set when the connection is accepted, the last one is the connection limiter.
+	limiters []*limiter
+
+	// clients is used to lazily acquire the client limiter on first read or write,
+	// so that Accept does not block on reading the proxy protocol header.
+	clients    *Pool
+	clientKey  string
+	client     *limiter
+	clientOnce sync.Once
+
+	// users is used to acquire the user limiter when the user is set.
+	users   *Pool
+	userMu  sync.Mutex
+	userKey string
+	user    atomic.Pointer[limiter]
+	closed  bool
+
+	// listenerProfile is emulated unless another profile is set, see SetProfile.
+	listenerProfile *Profile
+	profileMu       sync.Mutex
+	pinned          bool
+	emu             atomic.Pointer[emulation]
+
+	onThrottle ThrottleFunc
+	onFault    FaultFunc
+	closeOnce  sync.Once
+	// done is closed on Close to cancel pending waits.
+	done chan struct{}
+}
 
 func (c *Conn) Read(b []byte) (n int, err error) {
+	if err := c.beforeIO(true); err != nil {
+		return 0, err
+	}
 	n, err = c.Conn.Read(b)
-	if n > 0 && c.rxLimiter != nil {
-		c.rxLimiter.WaitN(waitContext, n)
+	if n > 0 {
+		c.wait(n, true)
 	}
 	return
 }
 
 func (c *Conn) Write(b []byte) (n int, err error) {
+	if err := c.beforeIO(false); err != nil {
+		return 0, err
+	}
 	n, err = c.Conn.Write(b)
-	if n > 0 && c.txLimiter != nil {
-		c.txLimiter.WaitN(waitContext, n)
+	if n > 0 {
+		c.wait(n, false)
 	}
 	return
 }
+
+func (c *Conn) wait(n int, read bool) {
+	for _, l := range c.limiters {
+		c.waitN(l, n, read)
+	}
+	if c.clients != nil {
+		c.clientOnce.Do(c.acquireClient)
+		c.waitN(c.client, n, read)
+	}
+	if l := c.user.Load(); l != nil {
+		c.waitN(l, n, read)
+	}
+	c.afterIO(n, read)
+}
+
+func (c *Conn) waitN(l *limiter, n int, read bool) {
+	var rl *rate.Limiter
+	if read {
+		rl = l.rxLimiter.Load()
+	} else {
+		rl = l.txLimiter.Load()
+	}
+	if rl == nil {
+		return
+	}
+
+	now := time.Now()
+	r := rl.ReserveN(now, n)
+	if !r.OK() {
+		return
+	}
+	d := r.DelayFrom(now)
+	if d <= 0 {
+		return
+	}
+
+	if !c.sleep(d) {
+		r.Cancel()
+		d = time.Since(now)
+	}
+	if c.onThrottle != nil {
+		c.onThrottle(l.scope, read, d)
+	}
+}
+
+// sleep waits for d or until the connection is closed, it returns false if the connection was closed.
+func (c *Conn) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *Conn) acquireClient() {
+	host, _, err := net.SplitHostPort(c.Conn.RemoteAddr().String())
+	if err != nil {
+		host = c.Conn.RemoteAddr().String()
+	}
+	c.clientKey = host
+	c.client = c.clients.acquire(host)
+}
+
+// SetUser limits the connection with the limiter of the user, it replaces the limiter of the previous user.
+// It is a no-op if the listener has no per-user limits.
+func (c *Conn) SetUser(user string) {
+	if c.users == nil || user == "" {
+		return
+	}
+
+	c.userMu.Lock()
+	defer c.userMu.Unlock()
+
+	if c.closed || c.userKey == user {
+		return
+	}
+	prev := c.userKey
+	c.userKey = user
+	c.user.Store(c.users.acquire(user))
+	if prev != "" {
+		c.users.release(prev)
+	}
+}
+
+// SetLimits changes the bandwidth limits of the connection, zero means no limit.
+// See NewListener for the meaning of readLimit and writeLimit.
+func (c *Conn) SetLimits(readLimit, writeLimit int64) {
+	c.limiters[len(c.limiters)-1].setLimits(readLimit, writeLimit)
+}
+
+// Limits returns the bandwidth limits of the connection set with SetLimits or in the listener Config.
+func (c *Conn) Limits() (readLimit, writeLimit int64) {
+	return c.limiters[len(c.limiters)-1].limits()
+}
+
+// Close closes the connection, pending reads and writes waiting for the limiters return right away.
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(c.release)
+	return err
+}
+
+func (c *Conn) release() {
+	close(c.done)
+
+	// Make sure the client limiter is not acquired after release.
+	c.clientOnce.Do(func() {})
+	if c.client != nil {
+		c.clients.release(c.clientKey)
+	}
+
+	c.userMu.Lock()
+	if c.userKey != "" {
+		c.users.release(c.userKey)
+	}
+	c.userKey = ""
+	c.user.Store(nil)
+	c.closed = true
+	c.userMu.Unlock()
+}
+
+func (c *Conn) rateLimitConn() *Conn {
+	return c
+}
+
+// SetConnUser calls SetUser on the rate limited connection underlying conn, if any.
+func SetConnUser(conn net.Conn, user string) {
+	if c := connFromConn(conn); c != nil {
+		c.SetUser(user)
+	}
+}
+
+// SetConnLimits calls SetLimits on the rate limited connection underlying conn.
+// It returns false if conn is not rate limited.
+func SetConnLimits(conn net.Conn, readLimit, writeLimit int64) bool {
+	c := connFromConn(conn)
+	if c == nil {
+		return false
+	}
+	c.SetLimits(readLimit, writeLimit)
+	return true
+}
+
+// ConnLimits returns the bandwidth limits of the rate limited connection underlying conn.
+// The last return value is false if conn is not rate limited.
+func ConnLimits(conn net.Conn) (readLimit, writeLimit int64, ok bool) {
+	c := connFromConn(conn)
+	if c == nil {
+		return 0, 0, false
+	}
+	readLimit, writeLimit = c.Limits()
+	return readLimit, writeLimit, true
+}
+
+func connFromConn(conn net.Conn) *Conn {
+	type ifce interface {
+		rateLimitConn() *Conn
+	}
+
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+
+	if c, ok := conn.(ifce); ok {
+		return c.rateLimitConn()
+	}
+
+	v, ok := reflectx.LookupImpl[ifce](reflect.ValueOf(conn))
+	if !ok {
+		return nil
+	}
+
+	return v.rateLimitConn()
+}
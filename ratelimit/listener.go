@@ -8,15 +8,59 @@ package ratelimit
 
 import (
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/saucelabs/connfu"
-	"golang.org/x/time/rate"
 )
 
+// Config specifies the limits of a listener.
+// The read and write limits should be seen from the perspective of a peer that opens a connection to this listener.
+// How much they can read and write, respectively.
+// Limits are in bytes per second, zero means no limit.
+type Config struct {
+	// ReadLimit and WriteLimit are shared by all connections.
+	ReadLimit  int64
+	WriteLimit int64
+
+	// ConnReadLimit and ConnWriteLimit apply to each connection.
+	ConnReadLimit  int64
+	ConnWriteLimit int64
+
+	// ClientReadLimit and ClientWriteLimit are shared by connections from the same client IP.
+	ClientReadLimit  int64
+	ClientWriteLimit int64
+
+	// UserReadLimit and UserWriteLimit are shared by connections of the same user, see Conn.SetUser.
+	UserReadLimit  int64
+	UserWriteLimit int64
+
+	// IdleTimeout is the time after which per-client and per-user limiters that are not used are removed.
+	IdleTimeout time.Duration
+
+	// OnThrottle, if set, is called when a read or write is delayed.
+	OnThrottle ThrottleFunc
+	// OnFault, if set, is called when a network profile emulates a fault, see Listener.SetProfile.
+	OnFault FaultFunc
+}
+
+// Enabled returns true if any limit is set.
+func (c *Config) Enabled() bool {
+	return c.ReadLimit > 0 || c.WriteLimit > 0 ||
+		c.ConnReadLimit > 0 || c.ConnWriteLimit > 0 ||
+		c.ClientReadLimit > 0 || c.ClientWriteLimit > 0 ||
+		c.UserReadLimit > 0 || c.UserWriteLimit > 0
+}
+
 type Listener struct {
 	net.Listener
-	rxLimiter *rate.Limiter
-	txLimiter *rate.Limiter
+	mu      sync.Mutex
+	cfg     Config
+	limiter *limiter
+	clients *Pool
+	users   *Pool
+	profile atomic.Pointer[Profile]
 }
 
 // NewListener creates a new rate-limited listener.
@@ -24,22 +68,24 @@ type Listener struct {
 // How much they can read and write, respectively.
 // Limits are in bytes per second.
 func NewListener(l net.Listener, readLimit, writeLimit int64) *Listener {
+	return NewListenerWithConfig(l, Config{
+		ReadLimit:  readLimit,
+		WriteLimit: writeLimit,
+	})
+}
+
+// NewListenerWithConfig creates a new rate-limited listener with per-connection, per-client and per-user limits.
+func NewListenerWithConfig(l net.Listener, cfg Config) *Listener {
 	// Notice that the readLimit should be seen from the perspective of a peer that opens a connection to this listener.
 	// Thus, the readLimit is in fact a txBandwidth - How much data can be sent to the peer that opened the connection,
 	// controls how much data they can *read*.
 	// The same goes for writeLimit.
-	var rxLimiter, txLimiter *rate.Limiter
-	if readLimit > 0 {
-		txLimiter = newRateLimiter(readLimit)
-	}
-	if writeLimit > 0 {
-		rxLimiter = newRateLimiter(writeLimit)
-	}
-
 	return &Listener{
-		Listener:  l,
-		rxLimiter: rxLimiter,
-		txLimiter: txLimiter,
+		Listener: l,
+		cfg:      cfg,
+		limiter:  newAdjustableLimiter(ScopeListener, cfg.ReadLimit, cfg.WriteLimit),
+		clients:  NewPool(ScopeClient, cfg.ClientReadLimit, cfg.ClientWriteLimit, cfg.IdleTimeout),
+		users:    NewPool(ScopeUser, cfg.UserReadLimit, cfg.UserWriteLimit, cfg.IdleTimeout),
 	}
 }
 
@@ -49,11 +95,64 @@ func (l *Listener) Accept() (net.Conn, error) {
 		return nil, err
 	}
 
-	c = connfu.CombineWithConfig(&Conn{
-		Conn:      c,
-		rxLimiter: l.rxLimiter,
-		txLimiter: l.txLimiter,
-	}, c, connfu.Config{}) // hide ReadFrom and WriteTo methods
+	l.mu.Lock()
+	connRead, connWrite := l.cfg.ConnReadLimit, l.cfg.ConnWriteLimit
+	l.mu.Unlock()
+
+	rc := &Conn{
+		Conn:       c,
+		clients:    l.clients,
+		users:      l.users,
+		onThrottle: l.cfg.OnThrottle,
+		onFault:    l.cfg.OnFault,
+		done:       make(chan struct{}),
+		limiters: []*limiter{
+			l.limiter,
+			newAdjustableLimiter(ScopeConnection, connRead, connWrite),
+		},
+	}
+
+	rc.listenerProfile = l.profile.Load()
+	rc.setProfile(nil)
+
+	c = connfu.CombineWithConfig(rc, c, connfu.Config{}) // hide ReadFrom and WriteTo methods
 
 	return c, nil
 }
+
+// SetLimits changes the bandwidth limits shared by all connections, zero means no limit.
+// See NewListener for the meaning of readLimit and writeLimit.
+func (l *Listener) SetLimits(readLimit, writeLimit int64) {
+	l.limiter.setLimits(readLimit, writeLimit)
+}
+
+// Limits returns the bandwidth limits shared by all connections.
+func (l *Listener) Limits() (readLimit, writeLimit int64) {
+	return l.limiter.limits()
+}
+
+// SetConnLimits changes the default bandwidth limits of new connections, zero means no limit.
+// Existing connections are not affected, see Conn.SetLimits.
+func (l *Listener) SetConnLimits(readLimit, writeLimit int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg.ConnReadLimit, l.cfg.ConnWriteLimit = readLimit, writeLimit
+}
+
+// ConnLimits returns the default bandwidth limits of new connections.
+func (l *Listener) ConnLimits() (readLimit, writeLimit int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg.ConnReadLimit, l.cfg.ConnWriteLimit
+}
+
+// SetProfile sets the network profile applied to new connections, nil means no emulation.
+// Existing connections are not affected, see Conn.SetProfile.
+func (l *Listener) SetProfile(p *Profile) {
+	l.profile.Store(p)
+}
+
+// Profile returns the network profile applied to new connections, or nil.
+func (l *Listener) Profile() *Profile {
+	return l.profile.Load()
+}
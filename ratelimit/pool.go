@@ -0,0 +1,98 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Pool holds limiters keyed by identity e.g. client IP or user.
+// Limiters are created on first use and removed when they are not used by any connection for the idle timeout,
+// idle limiters are collected when other limiters are acquired.
+type Pool struct {
+	scope       Scope
+	readLimit   int64
+	writeLimit  int64
+	idleTimeout time.Duration
+
+	mu        sync.Mutex
+	m         map[string]*poolEntry
+	lastSweep time.Time
+}
+
+type poolEntry struct {
+	l        *limiter
+	refs     int
+	lastUsed time.Time
+}
+
+// NewPool creates a pool of limiters, see NewListener for the meaning of readLimit and writeLimit.
+// It returns nil if both limits are not set.
+func NewPool(scope Scope, readLimit, writeLimit int64, idleTimeout time.Duration) *Pool {
+	if readLimit <= 0 && writeLimit <= 0 {
+		return nil
+	}
+
+	return &Pool{
+		scope:       scope,
+		readLimit:   readLimit,
+		writeLimit:  writeLimit,
+		idleTimeout: idleTimeout,
+		m:           make(map[string]*poolEntry),
+		lastSweep:   time.Now(),
+	}
+}
+
+// acquire returns the limiter for the key, it must be released with release when no longer used.
+func (p *Pool) acquire(key string) *limiter {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Sub(p.lastSweep) >= p.idleTimeout {
+		p.sweepLocked(now)
+	}
+
+	e, ok := p.m[key]
+	if !ok {
+		e = &poolEntry{l: newLimiter(p.scope, p.readLimit, p.writeLimit)}
+		p.m[key] = e
+	}
+	e.refs++
+	e.lastUsed = now
+
+	return e.l
+}
+
+func (p *Pool) release(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.m[key]; ok {
+		e.refs--
+		e.lastUsed = time.Now()
+	}
+}
+
+// sweepLocked removes limiters not used by any connection for the idle timeout.
+func (p *Pool) sweepLocked(now time.Time) {
+	for k, e := range p.m {
+		if e.refs <= 0 && now.Sub(e.lastUsed) >= p.idleTimeout {
+			delete(p.m, k)
+		}
+	}
+	p.lastSweep = now
+}
+
+// Len returns the number of limiters in the pool.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.m)
+}
@@ -0,0 +1,203 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ratelimit
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/saucelabs/forwarder/utils/reflectx"
+)
+
+// ScopeProfile is the scope of the bandwidth limits of a network profile.
+const ScopeProfile Scope = "profile"
+
+// ErrReset is returned from Read and Write when a network profile resets the connection.
+var ErrReset = errors.New("connection reset by network emulation")
+
+// Fault is a network failure emulated by a profile.
+type Fault string
+
+const (
+	FaultReset Fault = "reset"
+	FaultStall Fault = "stall"
+)
+
+// FaultFunc is called when a network profile emulates a fault on a connection.
+type FaultFunc func(profile string, f Fault)
+
+// Profile describes network conditions emulated on a connection e.g. a slow mobile network or a flaky Wi-Fi.
+type Profile struct {
+	Name string
+
+	// ReadLimit and WriteLimit limit the bandwidth of each connection using the profile, see NewListener.
+	ReadLimit  int64
+	WriteLimit int64
+
+	// Latency delays each write before the data is sent, and each read after the data is received.
+	Latency time.Duration
+	// Jitter is the maximum random deviation from Latency.
+	Jitter time.Duration
+
+	// ResetProbability is the probability of resetting the connection on a read or write.
+	ResetProbability float64
+	// StallProbability is the probability of delaying a read or write by StallDuration.
+	StallProbability float64
+	StallDuration    time.Duration
+}
+
+// delay returns the latency with random jitter added.
+func (p *Profile) delay() time.Duration {
+	d := p.Latency
+	if p.Jitter > 0 {
+		d += rand.N(2*p.Jitter+1) - p.Jitter //nolint:gosec // emulation does not need secure random numbers
+	}
+	return d
+}
+
+// emulation is the state of a profile applied to a connection.
+type emulation struct {
+	profile *Profile
+	limiter *limiter
+}
+
+func newEmulation(p *Profile) *emulation {
+	if p == nil {
+		return nil
+	}
+	return &emulation{
+		profile: p,
+		limiter: newLimiter(ScopeProfile, p.ReadLimit, p.WriteLimit),
+	}
+}
+
+// SetProfile applies the network profile to the connection, nil profile reverts to the listener profile.
+// It is a no-op if the profile was pinned with PinProfile.
+func (c *Conn) SetProfile(p *Profile) {
+	c.profileMu.Lock()
+	defer c.profileMu.Unlock()
+
+	if c.pinned {
+		return
+	}
+	c.setProfile(p)
+}
+
+// PinProfile applies the network profile to the connection, SetProfile does not change it afterwards.
+// Nil profile unpins and reverts to the listener profile.
+func (c *Conn) PinProfile(p *Profile) {
+	c.profileMu.Lock()
+	defer c.profileMu.Unlock()
+
+	c.pinned = p != nil
+	c.setProfile(p)
+}
+
+func (c *Conn) setProfile(p *Profile) {
+	if p == nil {
+		p = c.listenerProfile
+	}
+	if e := c.emu.Load(); e != nil && e.profile == p || e == nil && p == nil {
+		return
+	}
+	c.emu.Store(newEmulation(p))
+}
+
+// Profile returns the network profile applied to the connection, or nil.
+func (c *Conn) Profile() *Profile {
+	if e := c.emu.Load(); e != nil {
+		return e.profile
+	}
+	return nil
+}
+
+// beforeIO emulates connection reset or stall before a read or write, and latency before a write.
+func (c *Conn) beforeIO(read bool) error {
+	e := c.emu.Load()
+	if e == nil {
+		return nil
+	}
+
+	p := e.profile
+	if p.ResetProbability > 0 && rand.Float64() < p.ResetProbability { //nolint:gosec // emulation does not need secure random numbers
+		if c.onFault != nil {
+			c.onFault(p.Name, FaultReset)
+		}
+		c.reset()
+		return ErrReset
+	}
+	if p.StallProbability > 0 && rand.Float64() < p.StallProbability { //nolint:gosec // emulation does not need secure random numbers
+		if c.onFault != nil {
+			c.onFault(p.Name, FaultStall)
+		}
+		c.sleep(p.StallDuration)
+	}
+	if !read {
+		c.sleep(p.delay())
+	}
+
+	return nil
+}
+
+// afterIO emulates the profile bandwidth limits after a read or write, and latency after a read.
+func (c *Conn) afterIO(n int, read bool) {
+	e := c.emu.Load()
+	if e == nil {
+		return
+	}
+	if e.limiter != nil {
+		c.waitN(e.limiter, n, read)
+	}
+	if read {
+		c.sleep(e.profile.delay())
+	}
+}
+
+// reset closes the connection sending TCP RST if possible.
+// The underlying TCP connection is looked up through wrappers like PROXY protocol connections.
+func (c *Conn) reset() {
+	type lingerer interface {
+		SetLinger(sec int) error
+	}
+	if lc, ok := reflectx.LookupImpl[lingerer](reflect.ValueOf(c.Conn)); ok {
+		lc.SetLinger(0) //nolint:errcheck // best effort
+	}
+	c.Close()
+}
+
+// SetConnProfile calls SetProfile on the rate limited connection underlying conn.
+// It returns false if conn is not rate limited.
+func SetConnProfile(conn net.Conn, p *Profile) bool {
+	c := connFromConn(conn)
+	if c == nil {
+		return false
+	}
+	c.SetProfile(p)
+	return true
+}
+
+// PinConnProfile calls PinProfile on the rate limited connection underlying conn.
+// It returns false if conn is not rate limited.
+func PinConnProfile(conn net.Conn, p *Profile) bool {
+	c := connFromConn(conn)
+	if c == nil {
+		return false
+	}
+	c.PinProfile(p)
+	return true
+}
+
+// ConnProfile returns the network profile applied to the rate limited connection underlying conn, or nil.
+func ConnProfile(conn net.Conn) *Profile {
+	if c := connFromConn(conn); c != nil {
+		return c.Profile()
+	}
+	return nil
+}
@@ -7,12 +7,18 @@
 package ratelimit
 
 import (
+	"sync/atomic"
+
 	"golang.org/x/time/rate"
 )
 
 const defaultMaxBurstSize = 4 * 1024 * 1024 // Must be bigger than the biggest request.
 
 func newRateLimiter(bandwidth int64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bandwidth), burstSize(bandwidth))
+}
+
+func burstSize(bandwidth int64) int {
 	// Relate maxBurstSize to bandwidth limit
 	// 4M gives 2.5 Gb/s on Windows
 	// Use defaultMaxBurstSize up to 2GBit/s (256MiB/s) then scale
@@ -21,5 +27,71 @@ func newRateLimiter(bandwidth int64) *rate.Limiter {
 	if maxBurstSize < defaultMaxBurstSize {
 		maxBurstSize = defaultMaxBurstSize
 	}
-	return rate.NewLimiter(rate.Limit(bandwidth), int(maxBurstSize))
+	return int(maxBurstSize)
+}
+
+// Scope is the set of connections sharing a limiter.
+type Scope string
+
+const (
+	ScopeListener   Scope = "listener"
+	ScopeConnection Scope = "connection"
+	ScopeClient     Scope = "client"
+	ScopeUser       Scope = "user"
+)
+
+// limiter limits the bandwidth of connections in both directions, nil rate limiter means no limit.
+// The rate limiters can be replaced at any time, see setLimits.
+type limiter struct {
+	scope     Scope
+	rxLimiter atomic.Pointer[rate.Limiter]
+	txLimiter atomic.Pointer[rate.Limiter]
+}
+
+// newLimiter creates a limiter, see NewListener for the meaning of readLimit and writeLimit.
+// It returns nil if both limits are not set.
+func newLimiter(scope Scope, readLimit, writeLimit int64) *limiter {
+	if readLimit <= 0 && writeLimit <= 0 {
+		return nil
+	}
+	return newAdjustableLimiter(scope, readLimit, writeLimit)
+}
+
+// newAdjustableLimiter is like newLimiter but it always returns a limiter, so that the limits can be set later.
+func newAdjustableLimiter(scope Scope, readLimit, writeLimit int64) *limiter {
+	l := &limiter{scope: scope}
+	l.setLimits(readLimit, writeLimit)
+	return l
+}
+
+// setLimits changes the limits, zero or negative limit removes the limit.
+// Pending waits are not affected.
+func (l *limiter) setLimits(readLimit, writeLimit int64) {
+	// See NewListenerWithConfig for why read and write are swapped.
+	setRateLimit(&l.txLimiter, readLimit)
+	setRateLimit(&l.rxLimiter, writeLimit)
+}
+
+func setRateLimit(p *atomic.Pointer[rate.Limiter], bandwidth int64) {
+	if bandwidth <= 0 {
+		p.Store(nil)
+		return
+	}
+	if rl := p.Load(); rl != nil {
+		rl.SetLimit(rate.Limit(bandwidth))
+		rl.SetBurst(burstSize(bandwidth))
+		return
+	}
+	p.Store(newRateLimiter(bandwidth))
+}
+
+func (l *limiter) limits() (readLimit, writeLimit int64) {
+	return rateLimit(&l.txLimiter), rateLimit(&l.rxLimiter)
+}
+
+func rateLimit(p *atomic.Pointer[rate.Limiter]) int64 {
+	if rl := p.Load(); rl != nil {
+		return int64(rl.Limit())
+	}
+	return 0
 }
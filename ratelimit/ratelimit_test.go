@@ -0,0 +1,323 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ratelimit
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPoolIdleTimeout(t *testing.T) {
+	p := NewPool(ScopeClient, 1024, 0, 10*time.Millisecond)
+
+	a := p.acquire("a")
+	if p.acquire("a") != a {
+		t.Fatal("expected the same limiter for the same key")
+	}
+	p.acquire("b")
+	p.release("b")
+
+	time.Sleep(20 * time.Millisecond)
+	p.acquire("c")
+	if p.Len() != 2 {
+		t.Fatalf("expected idle limiter to be removed, got %d limiters", p.Len())
+	}
+
+	p.release("a")
+	p.release("a")
+	p.release("c")
+	time.Sleep(20 * time.Millisecond)
+	p.acquire("d")
+	if p.Len() != 1 {
+		t.Fatalf("expected only the new limiter, got %d limiters", p.Len())
+	}
+}
+
+func TestNewPoolNoLimits(t *testing.T) {
+	if NewPool(ScopeUser, 0, 0, time.Minute) != nil {
+		t.Fatal("expected nil pool")
+	}
+}
+
+func TestListenerLimits(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var (
+		mu        sync.Mutex
+		throttled = map[Scope]time.Duration{}
+	)
+	l := NewListenerWithConfig(ln, Config{
+		ConnReadLimit:   1,
+		ClientReadLimit: 1,
+		UserReadLimit:   1,
+		IdleTimeout:     time.Minute,
+		OnThrottle: func(scope Scope, read bool, d time.Duration) {
+			if read {
+				t.Errorf("unexpected read throttling")
+			}
+			mu.Lock()
+			throttled[scope] += d
+			mu.Unlock()
+		},
+	})
+
+	for range 2 {
+		go func() {
+			c, err := net.Dial("tcp", ln.Addr().String())
+			if err == nil {
+				defer c.Close()
+				io.Copy(io.Discard, c)
+			}
+		}()
+	}
+
+	var conns []net.Conn
+	for range 2 {
+		c, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, c)
+	}
+
+	// The limiters start with a full bucket, drain them with the first write.
+	if _, err := conns[0].Write(make([]byte, defaultMaxBurstSize)); err != nil {
+		t.Fatal(err)
+	}
+	if l.clients.Len() != 1 {
+		t.Fatalf("expected one client limiter, got %d", l.clients.Len())
+	}
+	if _, ok := throttled[ScopeConnection]; ok {
+		t.Fatal("unexpected connection throttling")
+	}
+
+	// The second connection has its own connection limiter but shares the client limiter.
+	SetConnUser(tls.Server(conns[1], &tls.Config{}), "user")
+	if l.users.Len() != 1 {
+		t.Fatalf("expected one user limiter, got %d", l.users.Len())
+	}
+	done := make(chan struct{})
+	go func() {
+		conns[1].Write([]byte("x"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected write to be throttled by the client limiter")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+func TestListenerSetLimits(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	l := NewListener(ln, 0, 0)
+	if r, w := l.Limits(); r != 0 || w != 0 {
+		t.Fatalf("expected no limits, got %d %d", r, w)
+	}
+	l.SetLimits(1, 0)
+	l.SetConnLimits(2, 3)
+	if r, w := l.Limits(); r != 1 || w != 0 {
+		t.Fatalf("unexpected limits %d %d", r, w)
+	}
+
+	go func() {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err == nil {
+			defer c.Close()
+			io.Copy(io.Discard, c)
+		}
+	}()
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if r, w, ok := ConnLimits(c); !ok || r != 2 || w != 3 {
+		t.Fatalf("unexpected connection limits %d %d", r, w)
+	}
+	if !SetConnLimits(c, 0, 0) {
+		t.Fatal("expected rate limited connection")
+	}
+	if r, w, _ := ConnLimits(c); r != 0 || w != 0 {
+		t.Fatalf("unexpected connection limits %d %d", r, w)
+	}
+
+	// The listener limiter starts with a full bucket, drain it with the first write.
+	if _, err := c.Write(make([]byte, defaultMaxBurstSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Write([]byte("x"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected write to be throttled by the listener limiter")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Close cancels the pending wait.
+	c.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected write to return after close")
+	}
+}
+
+func TestListenerProfile(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var faults []Fault
+	l := NewListenerWithConfig(ln, Config{
+		OnFault: func(profile string, f Fault) {
+			if profile != "broken" {
+				t.Errorf("unexpected profile %q", profile)
+			}
+			faults = append(faults, f)
+		},
+	})
+	slow := &Profile{Name: "slow", Latency: 50 * time.Millisecond}
+	l.SetProfile(slow)
+
+	accept := func() net.Conn {
+		go func() {
+			c, err := net.Dial("tcp", ln.Addr().String())
+			if err == nil {
+				defer c.Close()
+				io.Copy(io.Discard, c)
+			}
+		}()
+		c, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := accept()
+	defer c.Close()
+	if ConnProfile(c) != slow {
+		t.Fatal("expected listener profile")
+	}
+	start := time.Now()
+	if _, err := c.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < slow.Latency {
+		t.Fatalf("expected write to be delayed, took %s", d)
+	}
+
+	// Pinned profile is not changed by SetConnProfile, unpinning reverts to the listener profile.
+	fast := &Profile{Name: "fast"}
+	PinConnProfile(c, fast)
+	SetConnProfile(c, nil)
+	if ConnProfile(c) != fast {
+		t.Fatal("expected pinned profile")
+	}
+	PinConnProfile(c, nil)
+	if ConnProfile(c) != slow {
+		t.Fatal("expected listener profile after unpin")
+	}
+
+	// Profile changes on the listener do not affect existing connections.
+	l.SetProfile(nil)
+	if ConnProfile(c) != slow {
+		t.Fatal("expected existing connection to keep the profile")
+	}
+	c2 := accept()
+	defer c2.Close()
+	if ConnProfile(c2) != nil {
+		t.Fatal("expected no profile")
+	}
+
+	SetConnProfile(c2, &Profile{Name: "broken", ResetProbability: 1})
+	if _, err := c2.Write([]byte("x")); !errors.Is(err, ErrReset) {
+		t.Fatalf("expected reset error, got %v", err)
+	}
+	if len(faults) != 1 || faults[0] != FaultReset {
+		t.Fatalf("unexpected faults %v", faults)
+	}
+}
+
+type wrappedConn struct {
+	net.Conn
+}
+
+type wrappingListener struct {
+	net.Listener
+}
+
+func (l wrappingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConn{c}, nil
+}
+
+func TestConnResetWrapped(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	l := NewListenerWithConfig(wrappingListener{ln}, Config{})
+	l.SetProfile(&Profile{Name: "broken", ResetProbability: 1})
+
+	errc := make(chan error, 1)
+	go func() {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer c.Close()
+		_, err = c.Read(make([]byte, 1))
+		errc <- err
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Write([]byte("x")); !errors.Is(err, ErrReset) {
+		t.Fatalf("expected reset error, got %v", err)
+	}
+	if err := <-errc; !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("expected connection reset by peer, got %v", err)
+	}
+}
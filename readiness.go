@@ -0,0 +1,34 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ReadinessCheck is a named check that reports an error if a component is not ready to serve traffic.
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// ReadinessChecks is a list of readiness checks.
+type ReadinessChecks []ReadinessCheck
+
+// Ready runs all the checks and returns an error listing the checks that failed, one per line.
+// It can be passed to NewAPIHandlerWithReadiness.
+func (rc ReadinessChecks) Ready(ctx context.Context) error {
+	var errs []error
+	for _, c := range rc {
+		if err := c.Check(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
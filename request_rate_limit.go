@@ -0,0 +1,284 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+	"github.com/saucelabs/forwarder/ruleset"
+	"golang.org/x/time/rate"
+)
+
+// ErrProxyRateLimited is returned when a request exceeds a request rate limit.
+var ErrProxyRateLimited = errors.New("too many requests")
+
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e rateLimitedError) Error() string {
+	return ErrProxyRateLimited.Error()
+}
+
+func (e rateLimitedError) Is(target error) bool {
+	return target == ErrProxyRateLimited
+}
+
+func (e rateLimitedError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// Request rate limit keys.
+const (
+	RateLimitKeyHost = "host"
+	RateLimitKeyIP   = "ip"
+	RateLimitKeyUser = "user"
+)
+
+// RequestRateLimitRule limits the rate of requests to matching domains,
+// requests are counted separately for each destination host, client IP or authenticated user depending on the key.
+type RequestRateLimitRule struct {
+	// Domains, if set, limits the rule to matching destination hosts.
+	Domains Matcher
+	Key     string
+	// Rate is the number of requests per second.
+	Rate  float64
+	Burst int
+
+	spec string
+}
+
+// ParseRequestRateLimitRule parses a rule in the format [<regexp>=]<host|ip|user>:<rate>[/s|/m|/h][:<burst>].
+// The default burst is the rate per second rounded up.
+func ParseRequestRateLimitRule(val string) (RequestRateLimitRule, error) {
+	r := RequestRateLimitRule{spec: val}
+
+	limit := val
+	if i := strings.LastIndex(val, "="); i >= 0 {
+		if i == 0 {
+			return RequestRateLimitRule{}, fmt.Errorf("invalid rate limit rule %q, expected [<regexp>=]<key>:<rate>", val)
+		}
+		item, err := ruleset.ParseRegexpListItem(val[:i])
+		if err != nil {
+			return RequestRateLimitRule{}, err
+		}
+		if item.Exclude {
+			return RequestRateLimitRule{}, errors.New("exclude rules are not supported")
+		}
+		m, err := ruleset.NewRegexpMatcherFromList([]ruleset.RegexpListItem{item})
+		if err != nil {
+			return RequestRateLimitRule{}, err
+		}
+		r.Domains = m
+		limit = val[i+1:]
+	}
+
+	parts := strings.Split(limit, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return RequestRateLimitRule{}, fmt.Errorf("invalid rate limit rule %q, expected [<regexp>=]<key>:<rate>", val)
+	}
+
+	switch k := strings.TrimSpace(parts[0]); k {
+	case RateLimitKeyHost, RateLimitKeyIP, RateLimitKeyUser:
+		r.Key = k
+	default:
+		return RequestRateLimitRule{}, fmt.Errorf("invalid rate limit key %q, expected host, ip or user", k)
+	}
+
+	rps, err := parseRequestRate(parts[1])
+	if err != nil {
+		return RequestRateLimitRule{}, err
+	}
+	r.Rate = rps
+	r.Burst = int(math.Ceil(rps))
+
+	if len(parts) == 3 {
+		b, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+		if err != nil || b <= 0 {
+			return RequestRateLimitRule{}, fmt.Errorf("invalid burst %q", parts[2])
+		}
+		r.Burst = b
+	}
+
+	return r, nil
+}
+
+// parseRequestRate parses a rate in the format <number>[/s|/m|/h] and returns it in requests per second.
+func parseRequestRate(val string) (float64, error) {
+	n, unit, _ := strings.Cut(strings.TrimSpace(val), "/")
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil || v <= 0 || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid rate %q", val)
+	}
+	switch unit {
+	case "", "s":
+	case "m":
+		v /= 60
+	case "h":
+		v /= 3600
+	default:
+		return 0, fmt.Errorf("invalid rate unit %q, expected s, m or h", unit)
+	}
+	return v, nil
+}
+
+func (r RequestRateLimitRule) String() string {
+	return r.spec
+}
+
+// maxRequestRateLimitEntries limits the number of tracked hosts, client IPs and users per rule,
+// keys over the limit share one bucket of the rule.
+const maxRequestRateLimitEntries = 100000
+
+// requestRateLimitShards is the number of shards the buckets of each rule are split into,
+// it reduces lock contention and bounds the work done by sweep.
+const requestRateLimitShards = 64
+
+type requestRateLimitEntry struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+type requestRateLimitShard struct {
+	mu        sync.Mutex
+	entries   map[string]*requestRateLimitEntry
+	lastSweep time.Time
+}
+
+// requestRateLimitBuckets holds token buckets of a rule.
+type requestRateLimitBuckets struct {
+	rule     RequestRateLimitRule
+	seed     maphash.Seed
+	shards   [requestRateLimitShards]requestRateLimitShard
+	overflow *rate.Limiter
+}
+
+func newRequestRateLimitBuckets(r RequestRateLimitRule) *requestRateLimitBuckets {
+	b := &requestRateLimitBuckets{
+		rule:     r,
+		seed:     maphash.MakeSeed(),
+		overflow: rate.NewLimiter(rate.Limit(r.Rate), r.Burst),
+	}
+	for i := range b.shards {
+		b.shards[i].entries = make(map[string]*requestRateLimitEntry)
+	}
+	return b
+}
+
+// limiter returns the bucket for the key, or the overflow bucket if there are too many keys.
+func (b *requestRateLimitBuckets) limiter(key string, now time.Time) *rate.Limiter {
+	s := &b.shards[maphash.String(b.seed, key)%requestRateLimitShards]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b.sweep(s, now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		if len(s.entries) >= maxRequestRateLimitEntries/requestRateLimitShards {
+			return b.overflow
+		}
+		e = &requestRateLimitEntry{limiter: rate.NewLimiter(rate.Limit(b.rule.Rate), b.rule.Burst)}
+		s.entries[key] = e
+	}
+	e.lastUsed = now
+
+	return e.limiter
+}
+
+// sweep removes entries with full buckets from the shard, they behave the same as new ones.
+func (b *requestRateLimitBuckets) sweep(s *requestRateLimitShard, now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	full := time.Duration(float64(b.rule.Burst) / b.rule.Rate * float64(time.Second))
+	for k, e := range s.entries {
+		if now.Sub(e.lastUsed) > full {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// requestRateLimiter holds token buckets for each rule and key.
+type requestRateLimiter struct {
+	buckets []*requestRateLimitBuckets
+}
+
+func newRequestRateLimiter(rules []RequestRateLimitRule) *requestRateLimiter {
+	l := &requestRateLimiter{
+		buckets: make([]*requestRateLimitBuckets, len(rules)),
+	}
+	for i, r := range rules {
+		l.buckets[i] = newRequestRateLimitBuckets(r)
+	}
+	return l
+}
+
+// allow takes a token from the buckets of all rules matching the request.
+// If any of the buckets is empty, no tokens are taken and an error with the time to wait is returned.
+func (l *requestRateLimiter) allow(host, ip, user string, now time.Time) error {
+	var (
+		reservations []*rate.Reservation
+		retryAfter   time.Duration
+	)
+	for _, b := range l.buckets {
+		r := b.rule
+		if r.Domains != nil && !r.Domains.Match(host) {
+			continue
+		}
+		var key string
+		switch r.Key {
+		case RateLimitKeyHost:
+			key = host
+		case RateLimitKeyIP:
+			key = ip
+		case RateLimitKeyUser:
+			key = user
+		}
+		if key == "" {
+			continue
+		}
+
+		res := b.limiter(key, now).ReserveN(now, 1)
+		reservations = append(reservations, res)
+		retryAfter = max(retryAfter, res.DelayFrom(now))
+	}
+
+	if retryAfter > 0 {
+		for _, res := range reservations {
+			res.CancelAt(now)
+		}
+		return rateLimitedError{retryAfter: retryAfter}
+	}
+	return nil
+}
+
+// requestRateLimit rejects requests exceeding the request rate limits with 429 status code.
+// Requests read from MITMed tunnels are counted as well as the CONNECT request.
+// It runs after authentication, ACL and forward auth, so that user limits apply to all authentication methods.
+func (hp *HTTPProxy) requestRateLimit(rules []RequestRateLimitRule) martian.RequestModifier {
+	l := newRequestRateLimiter(rules)
+	return martian.RequestModifierFunc(func(req *http.Request) error {
+		ip, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			ip = req.RemoteAddr
+		}
+		return l.allow(req.URL.Hostname(), ip, martian.ContextUser(req.Context()), time.Now())
+	})
+}
@@ -0,0 +1,143 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/forwarder/log/slog"
+	"golang.org/x/time/rate"
+)
+
+func TestParseRequestRateLimitRule(t *testing.T) {
+	tests := []struct {
+		val   string
+		key   string
+		rate  float64
+		burst int
+	}{
+		{"host:10", RateLimitKeyHost, 10, 10},
+		{"ip:0.5", RateLimitKeyIP, 0.5, 1},
+		{"user:120/m:5", RateLimitKeyUser, 2, 5},
+		{`^api\.example\.com$=host:3600/h`, RateLimitKeyHost, 1, 1},
+	}
+	for _, tc := range tests {
+		r, err := ParseRequestRateLimitRule(tc.val)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.val, err)
+		}
+		if r.Key != tc.key || r.Rate != tc.rate || r.Burst != tc.burst {
+			t.Errorf("%q: got %s %v %d", tc.val, r.Key, r.Rate, r.Burst)
+		}
+	}
+
+	for _, val := range []string{"host", "=host:1", "path:1", "host:0", "host:-1", "host:1/d", "host:1:0", "host:1:2:3", "-example.com=host:1"} {
+		if _, err := ParseRequestRateLimitRule(val); err == nil {
+			t.Errorf("%q: expected error", val)
+		}
+	}
+}
+
+func TestRequestRateLimiter(t *testing.T) {
+	parse := func(vals ...string) []RequestRateLimitRule {
+		var res []RequestRateLimitRule
+		for _, v := range vals {
+			r, err := ParseRequestRateLimitRule(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, r)
+		}
+		return res
+	}
+
+	l := newRequestRateLimiter(parse(`^api\.example\.com$=host:1`, "ip:2", "user:1/m"))
+	now := time.Now()
+
+	if err := l.allow("api.example.com", "192.0.2.1", "", now); err != nil {
+		t.Fatal(err)
+	}
+	err := l.allow("api.example.com", "192.0.2.2", "", now)
+	var ra retryAfterError
+	if !errors.Is(err, ErrProxyRateLimited) || !errors.As(err, &ra) || ra.RetryAfter() != time.Second {
+		t.Fatalf("expected host limit, got %v", err)
+	}
+
+	// Rejected request does not take tokens from other buckets.
+	if err := l.allow("www.example.com", "192.0.2.2", "", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.allow("www.example.com", "192.0.2.2", "", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.allow("www.example.com", "192.0.2.2", "", now); !errors.Is(err, ErrProxyRateLimited) {
+		t.Fatalf("expected ip limit, got %v", err)
+	}
+
+	if err := l.allow("www.example.com", "192.0.2.3", "user", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.allow("www.example.com", "192.0.2.4", "user", now.Add(30*time.Second)); !errors.As(err, &ra) || ra.RetryAfter() != 30*time.Second {
+		t.Fatalf("expected user limit, got %v", err)
+	}
+	if err := l.allow("api.example.com", "192.0.2.1", "", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequestRateLimitOverflow(t *testing.T) {
+	r, err := ParseRequestRateLimitRule("host:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newRequestRateLimitBuckets(r)
+	now := time.Now()
+
+	// New keys over the limit share the overflow bucket instead of bypassing the limit.
+	n := 0
+	overflow := func() *rate.Limiter {
+		for ; n <= maxRequestRateLimitEntries; n++ {
+			if l := b.limiter(fmt.Sprintf("%d.example.com", n), now); l == b.overflow {
+				n++
+				return l
+			}
+		}
+		t.Fatal("expected overflow bucket")
+		return nil
+	}
+	if !overflow().AllowN(now, 1) {
+		t.Fatal("expected token in the overflow bucket")
+	}
+	if overflow().AllowN(now, 1) {
+		t.Fatal("expected the overflow bucket to be shared")
+	}
+
+	// Idle entries are removed by sweep.
+	if b.limiter("0.example.com", now.Add(2*time.Minute)) == b.overflow {
+		t.Fatal("expected idle entries to be removed")
+	}
+}
+
+func TestRequestRateLimitErrorResponse(t *testing.T) {
+	hp, err := newHTTPProxy(DefaultHTTPProxyConfig(), nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+	res := hp.errorResponse(req, rateLimitedError{retryAfter: 1500 * time.Millisecond})
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+	if ra := res.Header.Get("Retry-After"); ra != "2" {
+		t.Fatalf("unexpected Retry-After %q", ra)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ruleset
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DomainMatcher matches host names against large lists of domains.
+// Exact domains and domain suffixes are stored in hash sets, so matching takes one lookup per label of the host name.
+// Only true patterns, written as /regexp/, are matched with regular expressions.
+//
+// Rule syntax:
+//   - example.com matches example.com
+//   - .example.com matches example.com and its subdomains
+//   - *.example.com matches subdomains of example.com
+//   - /regexp/ matches host names matching the regexp
+//
+// Prefix a rule with '-' to exclude matching host names.
+// Host names are matched case-insensitively, and trailing dots are ignored.
+type DomainMatcher struct {
+	include domainSet
+	exclude domainSet
+	inverse bool
+}
+
+type domainSet struct {
+	exact    map[string]struct{}
+	suffix   map[string]struct{}
+	wildcard map[string]struct{}
+	patterns []string
+	regexp   *regexp.Regexp
+}
+
+func (s *domainSet) add(rule string) error {
+	switch {
+	case len(rule) > 2 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/"):
+		p := rule[1 : len(rule)-1]
+		if _, err := regexp.Compile(p); err != nil {
+			return err
+		}
+		s.patterns = append(s.patterns, p)
+		s.regexp = nil
+		return nil
+	case strings.HasPrefix(rule, "*."):
+		return addDomain(&s.wildcard, rule[2:])
+	case strings.HasPrefix(rule, "."):
+		return addDomain(&s.suffix, rule[1:])
+	default:
+		return addDomain(&s.exact, rule)
+	}
+}
+
+func addDomain(m *map[string]struct{}, d string) error {
+	d = normalizeDomain(d)
+	if !validDomain(d) {
+		return fmt.Errorf("invalid domain %q", d)
+	}
+	if *m == nil {
+		*m = make(map[string]struct{})
+	}
+	(*m)[d] = struct{}{}
+	return nil
+}
+
+func normalizeDomain(d string) string {
+	return strings.ToLower(strings.TrimSuffix(d, "."))
+}
+
+func validDomain(d string) bool {
+	if d == "" || len(d) > 253 {
+		return false
+	}
+	for _, l := range strings.Split(d, ".") {
+		if l == "" || len(l) > 63 {
+			return false
+		}
+		for i := range len(l) {
+			c := l[i]
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *domainSet) compile() error {
+	if len(s.patterns) == 0 || s.regexp != nil {
+		return nil
+	}
+	re, err := regexp.Compile(strings.Join(s.patterns, "|"))
+	if err != nil {
+		return err
+	}
+	s.regexp = re
+	return nil
+}
+
+func (s *domainSet) empty() bool {
+	return len(s.exact) == 0 && len(s.suffix) == 0 && len(s.wildcard) == 0 && len(s.patterns) == 0
+}
+
+func (s *domainSet) len() int {
+	return len(s.exact) + len(s.suffix) + len(s.wildcard) + len(s.patterns)
+}
+
+func (s *domainSet) match(host string) bool {
+	if _, ok := s.exact[host]; ok {
+		return true
+	}
+	if len(s.suffix) > 0 || len(s.wildcard) > 0 {
+		d := host
+		sub := false
+		for {
+			if _, ok := s.suffix[d]; ok {
+				return true
+			}
+			if _, ok := s.wildcard[d]; ok && sub {
+				return true
+			}
+			i := strings.IndexByte(d, '.')
+			if i < 0 {
+				break
+			}
+			d = d[i+1:]
+			sub = true
+		}
+	}
+	return s.regexp != nil && s.regexp.MatchString(host)
+}
+
+// NewDomainMatcher returns a DomainMatcher with the given rules.
+func NewDomainMatcher(rules []string) (*DomainMatcher, error) {
+	m := new(DomainMatcher)
+	for _, r := range rules {
+		if err := m.add(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.compile(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *DomainMatcher) add(rule string) error {
+	rule = strings.TrimSpace(rule)
+	if r, ok := strings.CutPrefix(rule, "-"); ok {
+		return m.exclude.add(r)
+	}
+	return m.include.add(rule)
+}
+
+func (m *DomainMatcher) compile() error {
+	if m.include.empty() {
+		return ErrNoIncludeRules
+	}
+	if err := m.include.compile(); err != nil {
+		return err
+	}
+	return m.exclude.compile()
+}
+
+// Len returns the number of rules.
+func (m *DomainMatcher) Len() int {
+	return m.include.len() + m.exclude.len()
+}
+
+// Inverse returns a new DomainMatcher that inverts the match result.
+func (m *DomainMatcher) Inverse() *DomainMatcher {
+	return &DomainMatcher{
+		include: m.include,
+		exclude: m.exclude,
+		inverse: !m.inverse,
+	}
+}
+
+// Match returns true if the host name matches at least one of the include rules
+// and does not match the exclude rules.
+func (m *DomainMatcher) Match(host string) bool {
+	host = normalizeDomain(host)
+	ok := m.include.match(host) && !m.exclude.match(host)
+	if m.inverse {
+		ok = !ok
+	}
+	return ok
+}
+
+// ParseDomainList reads rules, one per line, and returns a DomainMatcher.
+// Each line may be in one of the following formats:
+//   - a rule, see DomainMatcher
+//   - hosts file entry i.e. an IP address followed by host names, host names are matched exactly
+//   - adblock filter ||example.com^, it matches example.com and its subdomains,
+//     exception filters @@||example.com^ exclude the domain, filter options after $ are ignored,
+//     other adblock filters e.g. with paths or element hiding rules are ignored
+//
+// Empty lines, and lines starting with #, ! or [ are ignored, text following # is a comment except in /regexp/ rules.
+func ParseDomainList(r io.Reader) (*DomainMatcher, error) {
+	m := new(DomainMatcher)
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	n := 0
+	for s.Scan() {
+		n++
+		if err := m.addLine(s.Text()); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := m.compile(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// hostsFileIgnore are host names in hosts files that are not blocked domains.
+var hostsFileIgnore = map[string]struct{}{
+	"localhost":             {},
+	"localhost.localdomain": {},
+	"local":                 {},
+	"broadcasthost":         {},
+	"ip6-localhost":         {},
+	"ip6-loopback":          {},
+	"ip6-localnet":          {},
+	"ip6-mcastprefix":       {},
+	"ip6-allnodes":          {},
+	"ip6-allrouters":        {},
+	"ip6-allhosts":          {},
+	"0.0.0.0":               {},
+}
+
+func (m *DomainMatcher) addLine(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == '!' || line[0] == '[' {
+		return nil
+	}
+
+	// Adblock filters.
+	if f, exception := strings.CutPrefix(line, "@@"); strings.HasPrefix(f, "||") {
+		d, ok := adblockDomain(f[2:])
+		if !ok {
+			return nil
+		}
+		if exception {
+			return m.exclude.add("." + d)
+		}
+		return m.include.add("." + d)
+	}
+	if strings.Contains(line, "##") || strings.HasPrefix(line, "@@") {
+		return nil
+	}
+	if strings.HasPrefix(line, "/") || strings.HasPrefix(line, "-/") {
+		return m.add(line)
+	}
+
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+	fields := strings.Fields(line)
+
+	// Hosts file entries.
+	if len(fields) > 1 {
+		if _, err := netip.ParseAddr(fields[0]); err != nil {
+			return fmt.Errorf("invalid hosts file entry %q", line)
+		}
+		for _, h := range fields[1:] {
+			if _, ok := hostsFileIgnore[strings.ToLower(h)]; ok {
+				continue
+			}
+			if err := m.include.add(h); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return m.add(line)
+}
+
+// adblockDomain returns the domain of adblock filter ||example.com^ without the || prefix,
+// it returns false if the filter is not a domain filter.
+func adblockDomain(f string) (string, bool) {
+	if i := strings.IndexByte(f, '$'); i >= 0 {
+		f = f[:i]
+	}
+	f, ok := strings.CutSuffix(f, "^")
+	if !ok {
+		f, ok = strings.CutSuffix(f, "^|")
+	}
+	if !ok {
+		return "", false
+	}
+	f = normalizeDomain(f)
+	return f, validDomain(f)
+}
+
+// ReadDomainListFile reads rules from a file, see ParseDomainList.
+func ReadDomainListFile(path string) (*DomainMatcher, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := ParseDomainList(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDomainMatcher(t *testing.T) {
+	m, err := NewDomainMatcher([]string{
+		"exact.com",
+		".suffix.com",
+		"*.wildcard.com",
+		`/^ads[0-9]+\./`,
+		"-allowed.suffix.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match := []string{
+		"exact.com",
+		"EXACT.com.",
+		"suffix.com",
+		"a.suffix.com",
+		"a.b.suffix.com",
+		"a.wildcard.com",
+		"ads1.example.com",
+	}
+	dontMatch := []string{
+		"a.exact.com",
+		"notsuffix.com",
+		"allowed.suffix.com",
+		"wildcard.com",
+		"ads.example.com",
+		"com",
+		"",
+	}
+
+	for _, s := range match {
+		if !m.Match(s) {
+			t.Errorf("expected %q to match", s)
+		}
+		if m.Inverse().Match(s) {
+			t.Errorf("expected %q not to match inverse", s)
+		}
+	}
+	for _, s := range dontMatch {
+		if m.Match(s) {
+			t.Errorf("expected %q not to match", s)
+		}
+	}
+
+	if _, err := NewDomainMatcher([]string{"-example.com"}); !errors.Is(err, ErrNoIncludeRules) {
+		t.Errorf("expected %v, got %v", ErrNoIncludeRules, err)
+	}
+	for _, r := range []string{"exa mple.com", "example..com", "/(/", "*.", "http://example.com"} {
+		if _, err := NewDomainMatcher([]string{r}); err == nil {
+			t.Errorf("%q: expected error", r)
+		}
+	}
+}
+
+func TestParseDomainList(t *testing.T) {
+	const list = `[Adblock Plus 2.0]
+! Title: test
+# comment
+
+plain.com
+.suffix.com # inline comment
+/^tracker[0-9]*\.example\.net$/
+
+0.0.0.0 localhost
+0.0.0.0 hosts1.com hosts2.com
+127.0.0.1 hosts3.com # comment
+::1 ip6-localhost
+
+||adblock.com^
+||adblock-options.com^$important
+@@||ok.adblock.com^
+||adblock.com/path
+example.com##.ad
+`
+	m, err := ParseDomainList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != 9 {
+		t.Errorf("expected 9 rules, got %d", m.Len())
+	}
+
+	match := []string{
+		"plain.com",
+		"a.suffix.com",
+		"tracker1.example.net",
+		"hosts1.com",
+		"hosts2.com",
+		"hosts3.com",
+		"adblock.com",
+		"sub.adblock.com",
+		"adblock-options.com",
+	}
+	dontMatch := []string{
+		"a.plain.com",
+		"localhost",
+		"a.hosts1.com",
+		"ok.adblock.com",
+		"example.com",
+	}
+	for _, s := range match {
+		if !m.Match(s) {
+			t.Errorf("expected %q to match", s)
+		}
+	}
+	for _, s := range dontMatch {
+		if m.Match(s) {
+			t.Errorf("expected %q not to match", s)
+		}
+	}
+
+	if _, err := ParseDomainList(strings.NewReader("ok.com\nnot a domain\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected line 2 error, got %v", err)
+	}
+}
+
+const benchmarkDomains = 10000
+
+func benchmarkHosts() []string {
+	return []string{
+		"www.google.com",
+		fmt.Sprintf("d%d.example.com", benchmarkDomains/2),
+		fmt.Sprintf("a.b.d%d.example.com", benchmarkDomains-1),
+	}
+}
+
+func BenchmarkDomainMatcher(b *testing.B) {
+	rules := make([]string, benchmarkDomains)
+	for i := range rules {
+		rules[i] = fmt.Sprintf(".d%d.example.com", i)
+	}
+	m, err := NewDomainMatcher(rules)
+	if err != nil {
+		b.Fatal(err)
+	}
+	hosts := benchmarkHosts()
+
+	b.ResetTimer()
+	for i := range b.N {
+		m.Match(hosts[i%len(hosts)])
+	}
+}
+
+func BenchmarkRegexpMatcher(b *testing.B) {
+	rules := make([]*regexp.Regexp, benchmarkDomains)
+	for i := range rules {
+		rules[i] = regexp.MustCompile(fmt.Sprintf(`(^|\.)d%d\.example\.com$`, i))
+	}
+	m, err := NewRegexpMatcher(rules, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	hosts := benchmarkHosts()
+
+	b.ResetTimer()
+	for i := range b.N {
+		m.Match(hosts[i%len(hosts)])
+	}
+}
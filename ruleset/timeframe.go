@@ -14,10 +14,21 @@ import (
 	"time"
 )
 
+const dateLayout = "2006-01-02"
+
 type TimeFrameEntry struct {
-	Weekday   time.Weekday // Weekday is 0-6, going from Sunday to Saturday
-	HourStart int          // 24h system
-	HourEnd   int          // 24h system
+	Weekday     time.Weekday // Weekday is 0-6, going from Sunday to Saturday
+	HourStart   int          // 24h system
+	HourEnd     int          // 24h system
+	MinuteStart int
+	MinuteEnd   int
+
+	// Date if not zero, the entry applies to the date instead of the weekday.
+	Date time.Time
+	// Exclude marks exceptions e.g. holidays or maintenance windows, see MatchTimeFrame.
+	Exclude bool
+	// Location is the time zone the entry is evaluated in, if nil the time is matched as is.
+	Location *time.Location
 }
 
 func (t *TimeFrameEntry) Validate() error {
@@ -25,9 +36,7 @@ func (t *TimeFrameEntry) Validate() error {
 		return errors.New("invalid weekday")
 	}
 
-	// We support right now only hour-based ranges, so for any computation
-	// we assume minutes are set to 0. So technically 24:00:00 is a valid end hour
-	// because there will be no way to set 23:59:59
+	// 24:00 is a valid end time, it is the end of the day.
 	if t.HourStart < 0 || t.HourStart > 24 {
 		return errors.New("HourStart outside valid range - <0,24>")
 	}
@@ -36,41 +45,135 @@ func (t *TimeFrameEntry) Validate() error {
 		return errors.New("HourEnd outside valid range - <0,24>")
 	}
 
-	if t.HourEnd < t.HourStart {
-		return errors.New("HourEnd is earlier than HourStart")
+	if t.MinuteStart < 0 || t.MinuteStart > 59 {
+		return errors.New("MinuteStart outside valid range - <0,59>")
+	}
+
+	if t.MinuteEnd < 0 || t.MinuteEnd > 59 {
+		return errors.New("MinuteEnd outside valid range - <0,59>")
+	}
+
+	if t.start() > 24*60 || t.end() > 24*60 {
+		return errors.New("time after 24:00")
 	}
 
 	return nil
 }
 
+func (t *TimeFrameEntry) start() int {
+	return t.HourStart*60 + t.MinuteStart
+}
+
+func (t *TimeFrameEntry) end() int {
+	return t.HourEnd*60 + t.MinuteEnd
+}
+
 // returns true if provided time matches TimeFrameEntry
-// time is always converted to local time
+// time is converted to the entry location if set
+// if the end time is earlier than the start time, the range ends on the next day
 
 func (t *TimeFrameEntry) Match(timeToMatch time.Time) bool {
-	// we expect time to already be in local time
 	localTime := timeToMatch
-
-	if localTime.Weekday() != t.Weekday {
-		return false
+	if t.Location != nil {
+		localTime = localTime.In(t.Location)
 	}
 
 	//  example:
 	//  12-14 matches 12:00 until 13:59
 	//  21-24 matches 21:00 until 23:59
-	if localTime.Hour() >= t.HourStart && localTime.Hour() < t.HourEnd {
-		return true
+	//  22:30-02:00 matches 22:30 until 23:59 and 00:00 until 01:59 on the next day
+	m := localTime.Hour()*60 + localTime.Minute()
+	start, end := t.start(), t.end()
+	switch {
+	case start < end:
+		return t.matchDay(localTime) && m >= start && m < end
+	case start > end:
+		return t.matchDay(localTime) && m >= start || t.matchDay(localTime.AddDate(0, 0, -1)) && m < end
+	default:
+		return false
+	}
+}
+
+func (t *TimeFrameEntry) matchDay(day time.Time) bool {
+	if !t.Date.IsZero() {
+		y, m, d := day.Date()
+		ty, tm, td := t.Date.Date()
+		return y == ty && m == tm && d == td
+	}
+	return day.Weekday() == t.Weekday
+}
+
+func (t TimeFrameEntry) String() string {
+	var sb strings.Builder
+	if t.Exclude {
+		sb.WriteByte('-')
+	}
+	if t.Date.IsZero() {
+		sb.WriteString(strings.ToLower(t.Weekday.String()[:3]))
+	} else {
+		sb.WriteString(t.Date.Format(dateLayout))
 	}
+	fmt.Fprintf(&sb, "/%02d:%02d-%02d:%02d", t.HourStart, t.MinuteStart, t.HourEnd, t.MinuteEnd)
+	return sb.String()
+}
 
-	return false
+// MatchTimeFrame returns true if the time matches at least one of the entries and none of the exclude entries.
+// If there are only exclude entries, any time not matching them matches.
+func MatchTimeFrame(entries []TimeFrameEntry, t time.Time) bool {
+	include, match := false, false
+	for i := range entries {
+		e := &entries[i]
+		if e.Exclude {
+			if e.Match(t) {
+				return false
+			}
+			continue
+		}
+		include = true
+		if !match && e.Match(t) {
+			match = true
+		}
+	}
+	return match || !include
+}
+
+// InLocation returns a copy of the entries evaluated in the location.
+func InLocation(entries []TimeFrameEntry, loc *time.Location) []TimeFrameEntry {
+	if loc == nil {
+		return entries
+	}
+	res := make([]TimeFrameEntry, len(entries))
+	for i, e := range entries {
+		e.Location = loc
+		res[i] = e
+	}
+	return res
 }
 
 func ParseTimeFrameEntry(repr string) (TimeFrameEntry, error) {
-	// repr format: mon/11-13, wed/20-23, fri/23-24
+	// repr format: mon/11-13, wed/08:30-17:45, fri/22:00-02:00, 2025-12-24/10:00-12:00, 2025-12-25
+	// prefix with '-' to exclude
 
 	var newEntry TimeFrameEntry
 
+	if r, ok := strings.CutPrefix(strings.TrimSpace(repr), "-"); ok {
+		newEntry.Exclude = true
+		repr = r
+	}
+
 	split := strings.Split(repr, "/")
 
+	// Date without time range matches the whole day.
+	if len(split) == 1 {
+		d, err := time.Parse(dateLayout, strings.TrimSpace(split[0]))
+		if err != nil {
+			return TimeFrameEntry{}, errors.New("invalid format")
+		}
+		newEntry.Date = d
+		newEntry.HourEnd = 24
+		return newEntry, nil
+	}
+
 	if len(split) != 2 || strings.TrimSpace(split[1]) == "" {
 		return TimeFrameEntry{}, errors.New("invalid format")
 	}
@@ -94,7 +197,11 @@ func ParseTimeFrameEntry(repr string) (TimeFrameEntry, error) {
 		newEntry.Weekday = time.Sunday
 
 	default:
-		return TimeFrameEntry{}, errors.New("invalid weekday name")
+		d, err := time.Parse(dateLayout, weekdayName)
+		if err != nil {
+			return TimeFrameEntry{}, errors.New("invalid weekday name")
+		}
+		newEntry.Date = d
 	}
 
 	hourStartHourEnd := strings.Split(split[1], "-")
@@ -103,19 +210,21 @@ func ParseTimeFrameEntry(repr string) (TimeFrameEntry, error) {
 		return TimeFrameEntry{}, errors.New("invalid format after '/'")
 	}
 
-	hourStart, err := strconv.Atoi(hourStartHourEnd[0])
+	hourStart, minuteStart, err := parseClock(hourStartHourEnd[0])
 	if err != nil {
 		return TimeFrameEntry{}, fmt.Errorf("invalid format of start hour: %w", err)
 	}
 
 	newEntry.HourStart = hourStart
+	newEntry.MinuteStart = minuteStart
 
-	hourEnd, err := strconv.Atoi(hourStartHourEnd[1])
+	hourEnd, minuteEnd, err := parseClock(hourStartHourEnd[1])
 	if err != nil {
 		return TimeFrameEntry{}, fmt.Errorf("invalid format of end hour: %w", err)
 	}
 
 	newEntry.HourEnd = hourEnd
+	newEntry.MinuteEnd = minuteEnd
 
 	// validate data at the end
 
@@ -126,3 +235,22 @@ func ParseTimeFrameEntry(repr string) (TimeFrameEntry, error) {
 
 	return newEntry, nil
 }
+
+// parseClock parses time in the format HH or HH:MM.
+func parseClock(s string) (hour, minute int, err error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hour, err = strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, err
+	}
+	if ok {
+		if len(m) != 2 {
+			return 0, 0, fmt.Errorf("invalid minutes %q", m)
+		}
+		minute, err = strconv.Atoi(m)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return hour, minute, nil
+}
@@ -44,8 +44,20 @@ func TestTimeFrameInvalidFormat(t *testing.T) {
 			expectedError: "time range entry value: HourEnd outside valid range - <0,24>",
 		},
 		{
-			input:         "mon/12-10",
-			expectedError: "time range entry value: HourEnd is earlier than HourStart",
+			input:         "mon/10:60-12",
+			expectedError: "time range entry value: MinuteStart outside valid range - <0,59>",
+		},
+		{
+			input:         "mon/10-24:30",
+			expectedError: "time range entry value: time after 24:00",
+		},
+		{
+			input:         "mon/10:5-12",
+			expectedError: "invalid format of start hour: invalid minutes \"5\"",
+		},
+		{
+			input:         "2025-13-01",
+			expectedError: "invalid format",
 		},
 	}
 
@@ -226,3 +238,69 @@ func TestTimeFrameMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestTimeFrameMatchMinutes(t *testing.T) {
+	// January 1st 2025 was Wednesday
+
+	tests := []struct {
+		currentTime time.Time
+		input       string
+		shouldMatch bool
+	}{
+		{time.Date(2025, time.January, 1, 8, 29, 59, 0, time.UTC), "wed/08:30-17:45", false},
+		{time.Date(2025, time.January, 1, 8, 30, 0, 0, time.UTC), "wed/08:30-17:45", true},
+		{time.Date(2025, time.January, 1, 17, 44, 59, 0, time.UTC), "wed/08:30-17:45", true},
+		{time.Date(2025, time.January, 1, 17, 45, 0, 0, time.UTC), "wed/08:30-17:45", false},
+		// crossing midnight
+		{time.Date(2025, time.January, 1, 22, 0, 0, 0, time.UTC), "wed/22:00-02:00", true},
+		{time.Date(2025, time.January, 2, 1, 59, 0, 0, time.UTC), "wed/22:00-02:00", true},
+		{time.Date(2025, time.January, 2, 2, 0, 0, 0, time.UTC), "wed/22:00-02:00", false},
+		{time.Date(2025, time.January, 1, 1, 0, 0, 0, time.UTC), "wed/22:00-02:00", false},
+		{time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC), "wed/22:00-02:00", false},
+		{time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC), "wed/12-12", false},
+		// dates
+		{time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), "2025-01-01", true},
+		{time.Date(2025, time.January, 1, 23, 59, 0, 0, time.UTC), "2025-01-01", true},
+		{time.Date(2025, time.January, 2, 0, 0, 0, 0, time.UTC), "2025-01-01", false},
+		{time.Date(2025, time.January, 8, 12, 0, 0, 0, time.UTC), "2025-01-01", false},
+		{time.Date(2025, time.January, 1, 10, 30, 0, 0, time.UTC), "2024-12-31/22:00-11:00", true},
+		{time.Date(2024, time.December, 31, 21, 0, 0, 0, time.UTC), "2024-12-31/22:00-11:00", false},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.input+" "+tc.currentTime.String(), func(t *testing.T) {
+			timeframe, err := ParseTimeFrameEntry(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.shouldMatch, timeframe.Match(tc.currentTime))
+		})
+	}
+}
+
+func TestMatchTimeFrame(t *testing.T) {
+	parse := func(entries ...string) []TimeFrameEntry {
+		var res []TimeFrameEntry
+		for _, e := range entries {
+			tf, err := ParseTimeFrameEntry(e)
+			require.NoError(t, err)
+			res = append(res, tf)
+		}
+		return res
+	}
+
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// Wednesday 9:00 in New York is 14:00 UTC.
+	wed14UTC := time.Date(2025, time.January, 1, 14, 0, 0, 0, time.UTC)
+
+	tf := parse("wed/9-17", "thu/9-17", "-2025-01-01/08:00-10:00")
+	assert.True(t, MatchTimeFrame(tf, wed14UTC))
+	assert.False(t, MatchTimeFrame(InLocation(tf, loc), wed14UTC))
+	assert.True(t, MatchTimeFrame(InLocation(tf, loc), wed14UTC.Add(2*time.Hour)))
+	assert.Equal(t, "-2025-01-01/08:00-10:00", tf[2].String())
+
+	holidays := parse("-2025-01-01")
+	assert.False(t, MatchTimeFrame(holidays, wed14UTC))
+	assert.True(t, MatchTimeFrame(holidays, wed14UTC.AddDate(0, 0, 1)))
+}
@@ -9,6 +9,8 @@ package forwarder
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -120,6 +122,51 @@ func (c *TLSClientConfig) loadRootCAs(tlsCfg *tls.Config) error {
 	return nil
 }
 
+//nolint:recvcheck // That is by design.
+type ClientAuthMode string
+
+const (
+	NoClientCert               ClientAuthMode = "none"
+	RequestClientCert          ClientAuthMode = "request"
+	RequireAnyClientCert       ClientAuthMode = "require"
+	VerifyClientCertIfGiven    ClientAuthMode = "verify-if-given"
+	RequireAndVerifyClientCert ClientAuthMode = "require-and-verify"
+)
+
+func (m *ClientAuthMode) UnmarshalText(text []byte) error {
+	if _, ok := ClientAuthMode(text).clientAuthType(); !ok {
+		return fmt.Errorf("invalid mode: %s", text)
+	}
+	*m = ClientAuthMode(text)
+	return nil
+}
+
+func (m ClientAuthMode) String() string {
+	return string(m)
+}
+
+func (m ClientAuthMode) clientAuthType() (tls.ClientAuthType, bool) {
+	switch m {
+	case NoClientCert:
+		return tls.NoClientCert, true
+	case RequestClientCert:
+		return tls.RequestClientCert, true
+	case RequireAnyClientCert:
+		return tls.RequireAnyClientCert, true
+	case VerifyClientCertIfGiven:
+		return tls.VerifyClientCertIfGiven, true
+	case RequireAndVerifyClientCert:
+		return tls.RequireAndVerifyClientCert, true
+	default:
+		return tls.NoClientCert, false
+	}
+}
+
+// verifies returns true if client certificates are verified against the client CAs.
+func (m ClientAuthMode) verifies() bool {
+	return m == VerifyClientCertIfGiven || m == RequireAndVerifyClientCert
+}
+
 type TLSServerConfig struct {
 	// HandshakeTimeout specifies the maximum amount of time waiting to
 	// wait for a TLS handshake. Zero means no timeout.
@@ -130,16 +177,124 @@ type TLSServerConfig struct {
 
 	// KeyFile is the path to the TLS private key of the certificate.
 	KeyFile string
+
+	// ClientCAFiles is a list of paths to CA certificate files used to verify client certificates.
+	ClientCAFiles []string
+
+	// ClientAuth is the policy for TLS client authentication.
+	// If empty, it defaults to require-and-verify if ClientCAFiles is set, and none otherwise.
+	ClientAuth ClientAuthMode
+
+	// ClientCRLFile is the path to a certificate revocation list (PEM or DER) issued by one of the client CAs.
+	// Client certificates listed in it are rejected, the file is reloaded when it changes.
+	ClientCRLFile string
+}
+
+func (c *TLSServerConfig) Validate() error {
+	if c.ClientAuth != "" {
+		if _, ok := c.ClientAuth.clientAuthType(); !ok {
+			return fmt.Errorf("unsupported client auth mode: %s", c.ClientAuth)
+		}
+	}
+	if c.ClientAuth.verifies() && len(c.ClientCAFiles) == 0 {
+		return fmt.Errorf("client auth mode %s requires client CA", c.ClientAuth)
+	}
+	if c.ClientCRLFile != "" && len(c.ClientCAFiles) == 0 {
+		return errors.New("client CRL requires client CA")
+	}
+	return nil
+}
+
+// clientAuthMode returns the effective client auth mode.
+func (c *TLSServerConfig) clientAuthMode() ClientAuthMode {
+	if c.ClientAuth != "" {
+		return c.ClientAuth
+	}
+	if len(c.ClientCAFiles) > 0 {
+		return RequireAndVerifyClientCert
+	}
+	return NoClientCert
 }
 
 func (c *TLSServerConfig) ConfigureTLSConfig(tlsCfg *tls.Config) error {
 	if err := c.loadCertificate(tlsCfg); err != nil {
 		return fmt.Errorf("load certificate: %w", err)
 	}
+	if err := c.configureClientAuth(tlsCfg); err != nil {
+		return fmt.Errorf("client auth: %w", err)
+	}
+
+	return nil
+}
+
+func (c *TLSServerConfig) configureClientAuth(tlsCfg *tls.Config) error {
+	mode := c.clientAuthMode()
+	if mode == NoClientCert {
+		return nil
+	}
+	tlsCfg.ClientAuth, _ = mode.clientAuthType()
+
+	if len(c.ClientCAFiles) == 0 {
+		return nil
+	}
+
+	var cas []*x509.Certificate
+	for _, name := range c.ClientCAFiles {
+		b, err := ReadFileOrBase64(name)
+		if err != nil {
+			return err
+		}
+		certs, err := parseCertificatesPEM(b)
+		if err != nil {
+			return fmt.Errorf("parse CA %q: %w", name, err)
+		}
+		cas = append(cas, certs...)
+	}
+	pool := x509.NewCertPool()
+	for _, ca := range cas {
+		pool.AddCert(ca)
+	}
+	tlsCfg.ClientCAs = pool
+
+	if c.ClientCRLFile != "" {
+		crl, err := openCRL(c.ClientCRLFile, cas)
+		if err != nil {
+			return fmt.Errorf("load CRL: %w", err)
+		}
+		tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return nil
+			}
+			return crl.Check(cs.PeerCertificates[0])
+		}
+	}
 
 	return nil
 }
 
+func parseCertificatesPEM(b []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
 func (c *TLSServerConfig) loadCertificate(tlsCfg *tls.Config) error {
 	var (
 		cert tls.Certificate
@@ -0,0 +1,144 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCertificateRevoked is returned when a client certificate is listed in the CRL.
+	ErrCertificateRevoked = errors.New("certificate revoked")
+	// ErrCRLExpired is returned when the next update time of the CRL has passed.
+	ErrCRLExpired = errors.New("CRL expired")
+)
+
+// crlCheckInterval is the minimum interval between checks for CRL file changes.
+const crlCheckInterval = 5 * time.Second
+
+// crlFile checks certificates against a certificate revocation list file that is reloaded when it changes.
+// If the file cannot be reloaded, or the CRL has expired, all certificates are rejected until it is fixed.
+type crlFile struct {
+	path string
+	cas  []*x509.Certificate
+
+	mu         sync.Mutex
+	issuer     []byte
+	revoked    map[string]struct{}
+	nextUpdate time.Time
+	err        error
+	modTime    time.Time
+	size       int64
+	lastCheck  time.Time
+}
+
+func openCRL(path string, cas []*x509.Certificate) (*crlFile, error) {
+	c := &crlFile{
+		path: path,
+		cas:  cas,
+	}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	c.lastCheck = time.Now()
+	return c, nil
+}
+
+func (c *crlFile) reload() error {
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(c.modTime) && fi.Size() == c.size && c.err == nil {
+		return nil
+	}
+
+	b, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		if block.Type != "X509 CRL" {
+			return fmt.Errorf("unexpected PEM block type %q", block.Type)
+		}
+		b = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(b)
+	if err != nil {
+		return err
+	}
+	if err := c.verify(crl); err != nil {
+		return err
+	}
+	if err := checkCRLExpired(crl.NextUpdate, time.Now()); err != nil {
+		return err
+	}
+
+	c.issuer = crl.RawIssuer
+	c.nextUpdate = crl.NextUpdate
+	c.revoked = make(map[string]struct{}, len(crl.RevokedCertificateEntries))
+	for _, e := range crl.RevokedCertificateEntries {
+		c.revoked[string(e.SerialNumber.Bytes())] = struct{}{}
+	}
+	c.modTime = fi.ModTime()
+	c.size = fi.Size()
+
+	return nil
+}
+
+func (c *crlFile) verify(crl *x509.RevocationList) error {
+	for _, ca := range c.cas {
+		if !bytes.Equal(ca.RawSubject, crl.RawIssuer) {
+			continue
+		}
+		if err := crl.CheckSignatureFrom(ca); err != nil {
+			return fmt.Errorf("verify signature: %w", err)
+		}
+		return nil
+	}
+	return errors.New("CRL issuer is not a client CA")
+}
+
+func checkCRLExpired(nextUpdate, now time.Time) error {
+	if !nextUpdate.IsZero() && now.After(nextUpdate) {
+		return fmt.Errorf("%w at %s", ErrCRLExpired, nextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Check returns an error if the certificate is revoked, or the CRL could not be reloaded or has expired.
+func (c *crlFile) Check(cert *x509.Certificate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastCheck) >= crlCheckInterval {
+		c.lastCheck = now
+		c.err = c.reload()
+	}
+	if c.err != nil {
+		return fmt.Errorf("CRL %s: %w", c.path, c.err)
+	}
+	if err := checkCRLExpired(c.nextUpdate, now); err != nil {
+		return fmt.Errorf("CRL %s: %w", c.path, err)
+	}
+
+	if !bytes.Equal(cert.RawIssuer, c.issuer) {
+		return nil
+	}
+	if _, ok := c.revoked[string(cert.SerialNumber.Bytes())]; ok {
+		return ErrCertificateRevoked
+	}
+	return nil
+}
@@ -7,10 +7,22 @@
 package forwarder
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"io"
+	"math/big"
 	"net"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/saucelabs/forwarder/utils/certutil"
 	"golang.org/x/net/netutil"
@@ -84,3 +96,159 @@ func tls12ServerTLSConfig(t *testing.T, cipherSuite uint16) *tls.Config {
 	}
 	return &tlsCfg
 }
+
+func TestTLSServerConfigClientCRL(t *testing.T) {
+	ca, caKey := testCA(t)
+	good := testClientCert(t, ca, caKey, 2)
+	revoked := testClientCert(t, ca, caKey, 3)
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(3), RevocationTime: time.Now()},
+		},
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	crlFile := filepath.Join(dir, "crl.pem")
+	if err := os.WriteFile(crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := TLSServerConfig{
+		ClientCAFiles: []string{caFile},
+		ClientCRLFile: crlFile,
+	}
+	if err := sc.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	serverCfg := httpsTLSConfigTemplate()
+	if err := sc.ConfigureTLSConfig(serverCfg); err != nil {
+		t.Fatal(err)
+	}
+	if serverCfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Fatalf("expected require-and-verify client auth, got %v", serverCfg.ClientAuth)
+	}
+
+	handshake := func(cert tls.Certificate) error {
+		c, s := net.Pipe()
+		defer c.Close()
+		defer s.Close()
+
+		go func() {
+			tc := tls.Client(c, &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{cert}}) //nolint:gosec // test
+			if tc.Handshake() == nil {
+				io.Copy(io.Discard, tc) //nolint:errcheck // read alerts until the connection is closed
+			}
+		}()
+		return tls.Server(s, serverCfg).Handshake()
+	}
+
+	if err := handshake(good); err != nil {
+		t.Fatalf("expected valid certificate to be accepted, got %v", err)
+	}
+	if err := handshake(revoked); !errors.Is(err, ErrCertificateRevoked) {
+		t.Fatalf("expected revoked certificate to be rejected, got %v", err)
+	}
+
+	expired, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(2),
+		ThisUpdate: time.Now().Add(-2 * time.Hour),
+		NextUpdate: time.Now().Add(-time.Hour),
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: expired}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.ConfigureTLSConfig(httpsTLSConfigTemplate()); !errors.Is(err, ErrCRLExpired) {
+		t.Fatalf("expected expired CRL to be rejected, got %v", err)
+	}
+}
+
+func TestClientCertIdentity(t *testing.T) {
+	u, err := url.Parse("spiffe://example.com/alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice"},
+		DNSNames:       []string{"alice.example.com"},
+		EmailAddresses: []string{"alice@example.com"},
+		URIs:           []*url.URL{u},
+	}
+
+	tests := map[ClientCertIdentity]string{
+		ClientCertIdentityCN:    "alice",
+		ClientCertIdentityDNS:   "alice.example.com",
+		ClientCertIdentityEmail: "alice@example.com",
+		ClientCertIdentityURI:   "spiffe://example.com/alice",
+	}
+	for id, want := range tests {
+		if got := id.Identity(cert); got != want {
+			t.Errorf("%s: expected %q, got %q", id, want, got)
+		}
+	}
+	if got := ClientCertIdentityDNS.Identity(&x509.Certificate{}); got != "" {
+		t.Errorf("expected empty identity, got %q", got)
+	}
+}
+
+func testCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, key
+}
+
+func testClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, serial int64) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
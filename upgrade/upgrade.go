@@ -0,0 +1,260 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package upgrade implements zero-downtime binary upgrades.
+// On signal the process starts a new instance of its executable and passes it the listening sockets.
+// The sockets are described with the socket activation environment variables, see the activation package.
+// Once the new process reports it is ready, the old process stops accepting connections, drains and exits.
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saucelabs/forwarder/activation"
+	"github.com/saucelabs/forwarder/log"
+)
+
+// readyFDEnv is the environment variable that holds the file descriptor the new process writes to when it is ready.
+const readyFDEnv = "UPGRADE_READY_FD"
+
+// readyPollInterval is the interval of readiness checks before the new process reports it is ready.
+const readyPollInterval = 100 * time.Millisecond
+
+// ErrUpgraded is returned by Run when the sockets were handed over to the new process.
+// The caller should stop accepting new connections, drain existing ones and exit.
+var ErrUpgraded = errors.New("upgraded")
+
+// FileListener is a listener that can return a copy of its underlying socket file descriptor.
+type FileListener interface {
+	File() (*os.File, error)
+}
+
+// Socket is a named listener passed to the new process.
+type Socket struct {
+	Name     string
+	Listener FileListener
+}
+
+type Config struct {
+	// ReadyTimeout is the maximum amount of time to wait for the new process to become ready.
+	// If the timeout is exceeded, the new process is killed and the current process continues to serve.
+	ReadyTimeout time.Duration
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		ReadyTimeout: 1 * time.Minute,
+	}
+}
+
+type Upgrader struct {
+	config  Config
+	sockets []Socket
+	log     log.StructuredLogger
+	mu      sync.Mutex
+}
+
+func New(cfg *Config, sockets []Socket, log log.StructuredLogger) *Upgrader {
+	return &Upgrader{
+		config:  *cfg,
+		sockets: sockets,
+		log:     log,
+	}
+}
+
+// Run waits for the upgrade signal and performs the upgrade.
+// If the upgrade fails, the error is logged and the current process continues to serve.
+// It returns ErrUpgraded after successful upgrade, and nil when the context is canceled.
+func (u *Upgrader) Run(ctx context.Context) error {
+	if upgradeSignal == nil {
+		<-ctx.Done()
+		return nil
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, upgradeSignal)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ch:
+			u.log.Info("upgrade requested")
+			if err := u.Upgrade(); err != nil {
+				u.log.Error("upgrade failed", "error", err)
+				continue
+			}
+			u.log.Info("upgrade complete, draining connections")
+			return ErrUpgraded
+		}
+	}
+}
+
+// Upgrade starts a new instance of the executable with the same arguments and passes it the sockets.
+// It returns after the new process reports it is ready.
+func (u *Upgrader) Upgrade() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var (
+		files []*os.File
+		names []string
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, s := range u.sockets {
+		f, err := s.Listener.File()
+		if err != nil {
+			return fmt.Errorf("socket %s: %w", s.Name, err)
+		}
+		files = append(files, f)
+		names = append(names, s.Name)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...) //nolint:noctx // the process outlives the context
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, w) //nolint:gocritic // files are closed in defer
+	cmd.Env = append(childEnv(), activation.Env(names)...)
+	cmd.Env = append(cmd.Env, readyFDEnv+"="+strconv.Itoa(3+len(files)))
+
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	u.log.Info("started new process", "pid", cmd.Process.Pid, "executable", exe)
+
+	if err := waitReady(r, u.config.ReadyTimeout); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("new process: %w", err)
+	}
+
+	return cmd.Process.Release()
+}
+
+func childEnv() []string {
+	var env []string
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, readyFDEnv+"=") || strings.HasPrefix(e, "LISTEN_") {
+			continue
+		}
+		env = append(env, e)
+	}
+	return env
+}
+
+func waitReady(r *os.File, timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := r.Read(b); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("exited before becoming ready")
+			}
+			errCh <- err
+			return
+		}
+		errCh <- nil
+	}()
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timeoutCh = t.C
+	}
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-timeoutCh:
+		return fmt.Errorf("not ready after %s", timeout)
+	}
+}
+
+// ReportReady waits until ready returns nil and then notifies the parent process, see Ready.
+// It is a no-op if the process was not started by an upgrade.
+// If the process is not ready within ReadyTimeout, an error is returned so that the process exits,
+// the parent process then aborts the upgrade and continues to serve.
+// It is meant to run in the same run group as the servers, so that readiness is checked while they are serving.
+func (u *Upgrader) ReportReady(ctx context.Context, ready func(ctx context.Context) error) error {
+	if _, ok := os.LookupEnv(readyFDEnv); !ok {
+		return nil
+	}
+
+	var timeoutCh <-chan time.Time
+	if u.config.ReadyTimeout > 0 {
+		t := time.NewTimer(u.config.ReadyTimeout)
+		defer t.Stop()
+		timeoutCh = t.C
+	}
+	tick := time.NewTicker(readyPollInterval)
+	defer tick.Stop()
+
+	for {
+		err := ready(ctx)
+		if err == nil {
+			u.log.Info("ready, notifying parent process")
+			return Ready()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timeoutCh:
+			return fmt.Errorf("upgrade: not ready after %s: %w", u.config.ReadyTimeout, err)
+		case <-tick.C:
+		}
+	}
+}
+
+// Ready notifies the parent process that this process is ready to serve.
+// It is a no-op if the process was not started by an upgrade.
+func Ready() error {
+	v, ok := os.LookupEnv(readyFDEnv)
+	if !ok {
+		return nil
+	}
+	os.Unsetenv(readyFDEnv)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", readyFDEnv, err)
+	}
+	f := os.NewFile(uintptr(fd), "upgrade-ready") //nolint:gosec // fd is never negative
+	defer f.Close()
+
+	_, err = f.Write([]byte{1})
+	return err
+}
@@ -0,0 +1,120 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/forwarder/log"
+)
+
+func TestWaitReady(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		t.Setenv(readyFDEnv, strconv.Itoa(int(w.Fd())))
+		if err := Ready(); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := os.LookupEnv(readyFDEnv); ok {
+			t.Fatalf("%s not unset", readyFDEnv)
+		}
+		if err := waitReady(r, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("exited", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		w.Close()
+
+		if err := waitReady(r, time.Second); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		defer w.Close()
+
+		if err := waitReady(r, 10*time.Millisecond); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestReadyNoop(t *testing.T) {
+	os.Unsetenv(readyFDEnv)
+	if err := Ready(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReportReady(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		t.Setenv(readyFDEnv, strconv.Itoa(int(w.Fd())))
+		calls := 0
+		ready := func(context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("not serving")
+			}
+			return nil
+		}
+		u := New(&Config{ReadyTimeout: time.Second}, nil, log.NopLogger)
+		if err := u.ReportReady(context.Background(), ready); err != nil {
+			t.Fatal(err)
+		}
+		if calls != 3 {
+			t.Fatalf("expected 3 readiness checks, got %d", calls)
+		}
+		if err := waitReady(r, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		defer w.Close()
+
+		t.Setenv(readyFDEnv, strconv.Itoa(int(w.Fd())))
+		ready := func(context.Context) error {
+			return errors.New("not serving")
+		}
+		u := New(&Config{ReadyTimeout: 10 * time.Millisecond}, nil, log.NopLogger)
+		if err := u.ReportReady(context.Background(), ready); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
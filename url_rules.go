@@ -0,0 +1,306 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/saucelabs/forwarder/internal/martian"
+	"github.com/saucelabs/forwarder/ruleset"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrProxyURLDenied is returned when a URL rule denies the request.
+var ErrProxyURLDenied = errors.New("request denied by URL rule")
+
+type urlRuleError struct {
+	rule   string
+	status int
+}
+
+func (e urlRuleError) Error() string {
+	if e.rule == "" {
+		return ErrProxyURLDenied.Error()
+	}
+	return fmt.Sprintf("%s %q", ErrProxyURLDenied, e.rule)
+}
+
+func (e urlRuleError) Is(target error) bool {
+	return target == ErrProxyURLDenied
+}
+
+type URLRuleAction string
+
+const (
+	URLRuleAllow URLRuleAction = "allow"
+	URLRuleDeny  URLRuleAction = "deny"
+)
+
+// URLRule matches requests by method, scheme, host, path and query.
+// Empty conditions match any request.
+type URLRule struct {
+	Name    string
+	Methods []string
+	Schemes []string
+	Hosts   Matcher
+	// Path is matched against the URL path cleaned with path.Clean, a trailing slash is kept.
+	// The regexp matches any part of the path unless it is anchored with ^ and $,
+	// regexps created from path globs are anchored.
+	Path *regexp.Regexp
+	// Query maps query parameters to regexps, at least one value of each parameter must match.
+	Query  map[string]*regexp.Regexp
+	Action URLRuleAction
+	// Status is the response status code of denied requests.
+	Status int
+}
+
+// Match returns true if the request matches all conditions of the rule.
+func (r *URLRule) Match(req *http.Request) bool {
+	if len(r.Methods) > 0 && !slices.Contains(r.Methods, req.Method) {
+		return false
+	}
+	if len(r.Schemes) > 0 && !slices.Contains(r.Schemes, req.URL.Scheme) {
+		return false
+	}
+	if r.Hosts != nil && !r.Hosts.Match(req.URL.Hostname()) {
+		return false
+	}
+	if r.Path != nil && !r.Path.MatchString(cleanURLPath(req.URL.Path)) {
+		return false
+	}
+	if len(r.Query) > 0 {
+		q := req.URL.Query()
+		for k, re := range r.Query {
+			if !slices.ContainsFunc(q[k], re.MatchString) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// URLRules holds rules evaluated in order, the first matching rule allows or denies the request.
+// Requests not matching any rule are allowed.
+// The rules only apply to plain HTTP requests and requests in MITM tunnels,
+// CONNECT requests and the traffic of tunnels that are not MITMed are not affected.
+type URLRules struct {
+	rules []*URLRule
+}
+
+type urlRulesFile struct {
+	Rules []urlRulesFileRule `yaml:"rules"`
+}
+
+type urlRulesFileRule struct {
+	Name       string            `yaml:"name"`
+	Methods    []string          `yaml:"methods"`
+	Schemes    []string          `yaml:"schemes"`
+	Hosts      []string          `yaml:"hosts"`
+	Path       string            `yaml:"path"`
+	PathRegexp string            `yaml:"path_regexp"`
+	Query      map[string]string `yaml:"query"`
+	Action     URLRuleAction     `yaml:"action"`
+	Status     int               `yaml:"status"`
+}
+
+// ParseURLRules reads URL rules from YAML, the format is:
+//
+//	rules:
+//	  - name: allow downloads
+//	    methods: [GET, HEAD]
+//	    hosts: ['^api\.example\.com$']
+//	    path: /files/*
+//	    action: allow
+//	  - name: no uploads
+//	    methods: [POST, PUT]
+//	    schemes: [https]
+//	    hosts: ['^api\.example\.com$']
+//	    path_regexp: ^/(upload|files)/
+//	    query: {debug: '.*'}
+//	    action: deny
+//	    status: 405
+//
+// Hosts use the same syntax as the --deny-domains flag.
+// Paths are matched against the cleaned URL path, i.e. with . and .. elements and duplicate slashes removed.
+// In path, * matches any sequence of characters including /, and ? matches a single character, the whole path must match.
+// The path_regexp matches any part of the path unless anchored with ^ and $.
+// The status defaults to 403.
+func ParseURLRules(r io.Reader) (*URLRules, error) {
+	var f urlRulesFile
+	d := yaml.NewDecoder(r)
+	d.KnownFields(true)
+	if err := d.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	u := new(URLRules)
+	for i := range f.Rules {
+		rule, err := f.Rules[i].parse()
+		if err != nil {
+			name := f.Rules[i].Name
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		u.rules = append(u.rules, rule)
+	}
+
+	return u, nil
+}
+
+// ReadURLRulesFile reads URL rules from a YAML file, see ParseURLRules.
+func ReadURLRulesFile(path string) (*URLRules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	u, err := ParseURLRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return u, nil
+}
+
+func (fr *urlRulesFileRule) parse() (*URLRule, error) {
+	r := &URLRule{
+		Name:    fr.Name,
+		Schemes: fr.Schemes,
+		Action:  fr.Action,
+		Status:  fr.Status,
+	}
+
+	for _, m := range fr.Methods {
+		r.Methods = append(r.Methods, strings.ToUpper(m))
+	}
+
+	if len(fr.Hosts) > 0 {
+		items := make([]ruleset.RegexpListItem, len(fr.Hosts))
+		for i, v := range fr.Hosts {
+			item, err := ruleset.ParseRegexpListItem(v)
+			if err != nil {
+				return nil, fmt.Errorf("hosts: %w", err)
+			}
+			items[i] = item
+		}
+		m, err := ruleset.NewRegexpMatcherFromList(items)
+		if err != nil {
+			return nil, fmt.Errorf("hosts: %w", err)
+		}
+		r.Hosts = m
+	}
+
+	switch {
+	case fr.Path != "" && fr.PathRegexp != "":
+		return nil, errors.New("path and path_regexp cannot be used together")
+	case fr.Path != "":
+		r.Path = globRegexp(fr.Path)
+	case fr.PathRegexp != "":
+		re, err := regexp.Compile(fr.PathRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("path regexp: %w", err)
+		}
+		r.Path = re
+	}
+
+	if len(fr.Query) > 0 {
+		r.Query = make(map[string]*regexp.Regexp, len(fr.Query))
+		for k, v := range fr.Query {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return nil, fmt.Errorf("query %s: %w", k, err)
+			}
+			r.Query[k] = re
+		}
+	}
+
+	switch r.Action {
+	case URLRuleAllow:
+		if r.Status != 0 {
+			return nil, errors.New("status can only be set for deny rules")
+		}
+	case URLRuleDeny:
+		if r.Status == 0 {
+			r.Status = http.StatusForbidden
+		}
+		if r.Status < 400 || r.Status > 599 {
+			return nil, fmt.Errorf("invalid status %d, must be 4xx or 5xx", r.Status)
+		}
+	default:
+		return nil, fmt.Errorf("invalid action %q, must be allow or deny", r.Action)
+	}
+
+	return r, nil
+}
+
+// cleanURLPath returns the canonical form of the URL path p, so that rules cannot be bypassed with
+// paths like /x/../upload or //upload, a trailing slash is kept.
+func cleanURLPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
+
+// globRegexp returns a regexp matching the whole string against the glob pattern,
+// where * matches any sequence of characters and ? matches a single character.
+func globRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// Match returns the first rule that matches the request, or nil if there is none.
+func (u *URLRules) Match(req *http.Request) *URLRule {
+	for _, r := range u.rules {
+		if r.Match(req) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (hp *HTTPProxy) urlRules(u *URLRules) martian.RequestModifier {
+	return martian.RequestModifierFunc(func(req *http.Request) error {
+		if req.Method == http.MethodConnect {
+			return nil
+		}
+		if r := u.Match(req); r != nil && r.Action == URLRuleDeny {
+			return urlRuleError{rule: r.Name, status: r.Status}
+		}
+		return nil
+	})
+}
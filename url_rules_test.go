@@ -0,0 +1,111 @@
+// Copyright 2022-2026 Sauce Labs Inc., all rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package forwarder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/saucelabs/forwarder/log/slog"
+)
+
+const testURLRules = `
+rules:
+  - name: downloads
+    methods: [get]
+    hosts: ['^api\.example\.com$']
+    path: /upload/*/public
+    action: allow
+  - name: uploads
+    methods: [POST, GET]
+    schemes: [https]
+    hosts: ['^api\.example\.com$']
+    path: /upload/*
+    action: deny
+    status: 405
+  - name: debug
+    path_regexp: ^/admin/
+    query: {debug: '^(1|true)$'}
+    action: deny
+`
+
+func TestURLRules(t *testing.T) {
+	u, err := ParseURLRules(strings.NewReader(testURLRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hp, err := newHTTPProxy(DefaultHTTPProxyConfig(), nil, nil, nil, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := hp.urlRules(u)
+
+	tests := []struct {
+		method, url string
+		status      int
+	}{
+		{http.MethodPost, "https://api.example.com/upload/a/b", http.StatusMethodNotAllowed},
+		{http.MethodGet, "https://api.example.com/upload/a/b", http.StatusMethodNotAllowed},
+		{http.MethodGet, "https://api.example.com/upload/a/public", 0},
+		{http.MethodPost, "http://api.example.com/upload/a/b", 0},
+		{http.MethodPost, "https://www.example.com/upload/a/b", 0},
+		{http.MethodGet, "https://api.example.com/download", 0},
+		{http.MethodGet, "http://example.com/admin/x?debug=1", http.StatusForbidden},
+		{http.MethodGet, "http://example.com/admin/x?debug=0", 0},
+		{http.MethodGet, "http://example.com/admin/x", 0},
+		{http.MethodPost, "https://api.example.com/x/../upload/a", http.StatusMethodNotAllowed},
+		{http.MethodPost, "https://api.example.com/x/%2e%2e/upload/a", http.StatusMethodNotAllowed},
+		{http.MethodPost, "https://api.example.com//upload/a", http.StatusMethodNotAllowed},
+		{http.MethodPost, "https://api.example.com/upload/./a", http.StatusMethodNotAllowed},
+		{http.MethodPost, "https://api.example.com/upload/", http.StatusMethodNotAllowed},
+		{http.MethodGet, "https://api.example.com/upload/a/x/../public", 0},
+		{http.MethodGet, "http://example.com//admin//x?debug=1", http.StatusForbidden},
+		{http.MethodConnect, "api.example.com:443", 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.url, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, http.NoBody)
+			err := m.ModifyRequest(req)
+			if tc.status == 0 {
+				if err != nil {
+					t.Fatalf("expected request to be allowed, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected request to be denied")
+			}
+			if res := hp.errorResponse(req, err); res.StatusCode != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestParseURLRulesErrors(t *testing.T) {
+	tests := []struct {
+		name, rules string
+	}{
+		{"no action", "rules: [{path: /}]"},
+		{"invalid action", "rules: [{path: /, action: block}]"},
+		{"allow status", "rules: [{path: /, action: allow, status: 403}]"},
+		{"invalid status", "rules: [{path: /, action: deny, status: 302}]"},
+		{"path and regexp", "rules: [{path: /, path_regexp: ^/, action: deny}]"},
+		{"invalid regexp", "rules: [{path_regexp: '(', action: deny}]"},
+		{"unknown field", "rules: [{url: /, action: deny}]"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseURLRules(strings.NewReader(tc.rules)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}